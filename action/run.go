@@ -1,6 +1,8 @@
 package action
 
 import (
+	"context"
+
 	"github.com/iter8-tools/iter8/base"
 	"github.com/iter8-tools/iter8/driver"
 )
@@ -10,6 +12,9 @@ type RunOpts struct {
 	// Rundir is the directory of the local experiment.yaml file
 	RunDir string
 
+	// Fresh ignores any previous result and runs the experiment from its first task
+	Fresh bool
+
 	// KubeDriver enables Kubernetes experiment run
 	*driver.KubeDriver
 }
@@ -22,12 +27,19 @@ func NewRunOpts(kd *driver.KubeDriver) *RunOpts {
 	}
 }
 
+// LocalRun runs a local experiment
+// The experiment is aborted when ctx is done
+func (rOpts *RunOpts) LocalRun(ctx context.Context) error {
+	return base.RunExperiment(ctx, rOpts.Fresh, driver.NewFileDriver(rOpts.RunDir))
+}
+
 // KubeRun runs a Kubernetes experiment
-func (rOpts *RunOpts) KubeRun() error {
+// The experiment is aborted when ctx is done
+func (rOpts *RunOpts) KubeRun(ctx context.Context) error {
 	// initialize kube driver
 	if err := rOpts.KubeDriver.InitKube(); err != nil {
 		return err
 	}
 
-	return base.RunExperiment(rOpts.KubeDriver)
+	return base.RunExperiment(ctx, rOpts.Fresh, rOpts.KubeDriver)
 }
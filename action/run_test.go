@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path"
+	"sync/atomic"
 	"testing"
 
 	"fortio.org/fortio/fhttp"
@@ -23,6 +25,30 @@ const (
 	myNamespace = "myNamespace"
 )
 
+func TestLocalRun(t *testing.T) {
+	// create and configure HTTP endpoint for testing
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	url := fmt.Sprintf("http://127.0.0.1:%d/get", addr.Port)
+	var verifyHandlerCalled atomic.Bool
+	mux.HandleFunc("/get", base.GetTrackingHandler(&verifyHandlerCalled))
+
+	dir := t.TempDir()
+	_ = os.Chdir(dir)
+
+	// create experiment.yaml
+	base.CreateExperimentYaml(t, base.CompletePath("../testdata", base.ExperimentTemplateFile), url, base.ExperimentFile)
+
+	// fix rOpts
+	rOpts := NewRunOpts(nil)
+	rOpts.RunDir = dir
+
+	err := rOpts.LocalRun(context.Background())
+	assert.NoError(t, err)
+	// sanity check -- handler was called
+	assert.True(t, verifyHandlerCalled.Load())
+	assert.FileExists(t, path.Join(dir, driver.ResultFile))
+}
+
 func TestKubeRun(t *testing.T) {
 	// define METRICS_SERVER_URL
 	metricsServerURL := "http://iter8.default:8080"
@@ -32,7 +58,7 @@ func TestKubeRun(t *testing.T) {
 	// create and configure HTTP endpoint for testing
 	mux, addr := fhttp.DynamicHTTPServer(false)
 	url := fmt.Sprintf("http://127.0.0.1:%d/get", addr.Port)
-	var verifyHandlerCalled bool
+	var verifyHandlerCalled atomic.Bool
 	mux.HandleFunc("/get", base.GetTrackingHandler(&verifyHandlerCalled))
 
 	// mock metrics server
@@ -81,9 +107,9 @@ func TestKubeRun(t *testing.T) {
 		StringData: map[string]string{base.ExperimentFile: string(byteArray)},
 	}, metav1.CreateOptions{})
 
-	err = rOpts.KubeRun()
+	err = rOpts.KubeRun(context.Background())
 	assert.NoError(t, err)
 	// sanity check -- handler was called
-	assert.True(t, verifyHandlerCalled)
+	assert.True(t, verifyHandlerCalled.Load())
 	assert.True(t, metricsServerCalled)
 }
@@ -0,0 +1,67 @@
+package action
+
+import (
+	"errors"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/iter8-tools/iter8/base"
+	"github.com/iter8-tools/iter8/base/log"
+	"sigs.k8s.io/yaml"
+)
+
+// documentSeparator separates the documents of a multi-document YAML file
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// ValidateOpts are the options used for validating an experiment
+type ValidateOpts struct {
+	// File is the experiment file. If it is -, the experiment is read from standard input
+	// The file may also contain Kubernetes manifests rendered from the Iter8 chart,
+	// in which case the experiment is read from the secret
+	File string
+}
+
+// NewValidateOpts initializes and returns validate opts
+func NewValidateOpts() *ValidateOpts {
+	return &ValidateOpts{
+		File: base.ExperimentFile,
+	}
+}
+
+// LocalValidate validates the experiment and returns the problems found
+func (vOpts *ValidateOpts) LocalValidate(in io.Reader) ([]base.ValidationError, error) {
+	var b []byte
+	var err error
+	if vOpts.File == "-" {
+		b, err = io.ReadAll(in)
+	} else {
+		b, err = os.ReadFile(vOpts.File)
+	}
+	if err != nil {
+		log.Logger.WithStackTrace(err.Error()).Error("unable to read experiment")
+		return nil, errors.New("unable to read experiment")
+	}
+
+	if exp := experimentFromManifests(b); exp != nil {
+		b = exp
+	}
+	return base.ValidateExperiment(b), nil
+}
+
+// experimentFromManifests returns the experiment in the secret of rendered Iter8 chart manifests, if any
+func experimentFromManifests(b []byte) []byte {
+	for _, doc := range documentSeparator.Split(string(b), -1) {
+		secret := struct {
+			Kind       string            `json:"kind"`
+			StringData map[string]string `json:"stringData"`
+		}{}
+		if err := yaml.Unmarshal([]byte(doc), &secret); err != nil {
+			continue
+		}
+		if exp, ok := secret.StringData[base.ExperimentFile]; ok && secret.Kind == "Secret" {
+			return []byte(exp)
+		}
+	}
+	return nil
+}
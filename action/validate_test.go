@@ -0,0 +1,57 @@
+package action
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iter8-tools/iter8/base"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalValidate(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+
+	// experiment file
+	err := os.WriteFile(base.ExperimentFile, []byte(`
+spec:
+- task: http
+  with:
+    url: http://httpbin.default/get
+    duration: 10x
+`), 0600)
+	assert.NoError(t, err)
+
+	vOpts := NewValidateOpts()
+	problems, err := vOpts.LocalValidate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []base.ValidationError{{Path: "spec[0].with.duration", Message: `invalid duration "10x"`}}, problems)
+
+	// rendered chart manifests from standard input
+	vOpts.File = "-"
+	problems, err = vOpts.LocalValidate(strings.NewReader(`
+apiVersion: v1
+kind: Secret
+metadata:
+  name: default
+stringData:
+  experiment.yaml: |
+    spec:
+    - task: ready
+      with:
+        name: httpbin
+        resource: deployments
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: default-job
+`))
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	// missing file
+	vOpts.File = "missing.yaml"
+	_, err = vOpts.LocalValidate(nil)
+	assert.Error(t, err)
+}
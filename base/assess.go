@@ -0,0 +1,482 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fortio.org/fortio/fhttp"
+	"github.com/bojand/ghz/runner"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+	log "github.com/iter8-tools/iter8/base/log"
+)
+
+const (
+	// AssessTaskName is the name of the task which assesses SLOs and objectives
+	AssessTaskName = "assess"
+
+	// metric name prefixes
+	httpMetricPrefix = CollectHTTPTaskName + "/"
+	grpcMetricPrefix = CollectGRPCTaskName + "/"
+
+	// metric names, without prefixes
+	requestCountMetric  = "request-count"
+	errorCountMetric    = "error-count"
+	errorRateMetric     = "error-rate"
+	latencyMeanMetric   = "latency-mean"
+	latencyStdDevMetric = "latency-stddev"
+	latencyMinMetric    = "latency-min"
+	latencyMaxMetric    = "latency-max"
+	latencyPrefix       = "latency-p"
+)
+
+// sloRegexp matches SLOs of the form `<metric> <op> <value>`
+var sloRegexp = regexp.MustCompile(`^\s*(\S+)\s*(<=|>=|<|>)\s*(\S+)\s*$`)
+
+// objective is a named boolean expression over the metrics of an endpoint
+type objective struct {
+	// Name of the objective
+	Name string `json:"name" yaml:"name"`
+	// Expr is a boolean expression. It may reference `metrics`, a map from metric names to values
+	// (example, metrics["http/latency-p99"] < 200), `endpoint`, the name of the endpoint,
+	// and `version` and `track`, the version and track of the endpoint (example, track != "candidate" || metrics["http/error-rate"] == 0).
+	// An objective is assessed for the endpoints of the tasks whose metrics it references; it is not satisfied if a metric has no value.
+	Expr string `json:"expr" yaml:"expr"`
+}
+
+// assessInputs are the inputs to the assess task
+type assessInputs struct {
+	// SLOs is a list of service level objectives of the form `<metric> <op> <value>` (example, `http/latency-p99 <= 200ms`).
+	// Valid operators are <, <=, > and >=. Latency metrics are in milliseconds; their limits may also be specified in the Go duration string format.
+	SLOs []string `json:"SLOs,omitempty" yaml:"SLOs,omitempty"`
+	// Objectives is a list of expression based objectives
+	Objectives []objective `json:"objectives,omitempty" yaml:"objectives,omitempty"`
+}
+
+// assessTask evaluates SLOs and objectives against the results of http and grpc tasks
+type assessTask struct {
+	// TaskMeta has fields common to all tasks
+	TaskMeta
+	// With contains the inputs to this task
+	With assessInputs `json:"with" yaml:"with"`
+}
+
+// SLOResult is the verdict of one SLO or objective for one endpoint
+type SLOResult struct {
+	// SLO is the SLO, or the name of the objective
+	SLO string `json:"slo" yaml:"slo"`
+	// Task is the name of the task whose results were assessed
+	Task string `json:"task" yaml:"task"`
+	// Endpoint is the endpoint whose results were assessed
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Version is the version and track of the endpoint, if they are known (example, candidate (v2))
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Value is the observed value of the metric, if the SLO is of the form `<metric> <op> <value>`
+	Value *float64 `json:"value,omitempty" yaml:"value,omitempty"`
+	// Satisfied is true if the SLO or objective is satisfied
+	Satisfied bool `json:"satisfied" yaml:"satisfied"`
+	// Message explains why the SLO or objective could not be assessed
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// AssessResult is the data produced by the assess task
+type AssessResult struct {
+	// SLOs is the table of verdicts
+	SLOs []SLOResult `json:"slos" yaml:"slos"`
+	// Passed is true if every SLO and objective is satisfied for every endpoint
+	Passed bool `json:"passed" yaml:"passed"`
+}
+
+// parsedSLO is the parsed form of an SLO of the form `<metric> <op> <value>`
+type parsedSLO struct {
+	metric string
+	op     string
+	limit  float64
+}
+
+// parseSLO parses an SLO of the form `<metric> <op> <value>`
+func parseSLO(s string) (*parsedSLO, error) {
+	m := sloRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("invalid SLO %q; expected <metric> <op> <value>", s)
+	}
+	limit, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		d, err := time.ParseDuration(m[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid SLO %q; value must be a number or a duration", s)
+		}
+		limit = durationToMilliseconds(d)
+	}
+	return &parsedSLO{metric: m[1], op: m[2], limit: limit}, nil
+}
+
+// satisfied returns true if value satisfies the SLO
+func (slo *parsedSLO) satisfied(value float64) bool {
+	switch slo.op {
+	case "<":
+		return value < slo.limit
+	case "<=":
+		return value <= slo.limit
+	case ">":
+		return value > slo.limit
+	default:
+		return value >= slo.limit
+	}
+}
+
+// compileObjective compiles the expression of an objective
+func compileObjective(o objective) (*vm.Program, error) {
+	return expr.Compile(o.Expr, expr.Env(objectiveEnv(endpointMetrics{})), expr.AsBool())
+}
+
+// objectiveEnv is the environment in which objectives are evaluated
+// Metrics without values are nil rather than 0, so that comparisons with them fail
+func objectiveEnv(e endpointMetrics) map[string]interface{} {
+	metrics := make(map[string]interface{}, len(e.metrics))
+	for name, value := range e.metrics {
+		metrics[name] = value
+	}
+	return map[string]interface{}{
+		"endpoint": e.endpoint,
+		"version":  e.version.Version,
+		"track":    e.version.Track,
+		"metrics":  metrics,
+	}
+}
+
+// metricsVisitor collects the metrics referenced by name in an objective (example, metrics["http/error-rate"])
+type metricsVisitor struct {
+	metrics []string
+}
+
+// Visit records the metric of a node that accesses metrics by name
+func (v *metricsVisitor) Visit(node *ast.Node) {
+	m, ok := (*node).(*ast.MemberNode)
+	if !ok {
+		return
+	}
+	if id, ok := m.Node.(*ast.IdentifierNode); !ok || id.Value != "metrics" {
+		return
+	}
+	if s, ok := m.Property.(*ast.StringNode); ok {
+		v.metrics = append(v.metrics, s.Value)
+	}
+}
+
+// objectiveMetrics returns the metrics referenced by name in a compiled objective
+func objectiveMetrics(program *vm.Program) []string {
+	v := &metricsVisitor{}
+	node := program.Node()
+	ast.Walk(&node, v)
+	return v.metrics
+}
+
+// metricTask returns the name of the task of a metric (example, http for http/error-rate)
+func metricTask(metric string) string {
+	task, _, _ := strings.Cut(metric, "/")
+	return task
+}
+
+// InitializeDefaults sets default values for the assess task
+func (t *assessTask) InitializeDefaults() {}
+
+// ValidateInputs for this task
+func (t *assessTask) ValidateInputs() error {
+	if len(t.With.SLOs) == 0 && len(t.With.Objectives) == 0 {
+		return errors.New("no SLOs or objectives were provided for assess task")
+	}
+	errs := []error{}
+	for i, s := range t.With.SLOs {
+		if _, err := parseSLO(s); err != nil {
+			errs = append(errs, newFieldError(fmt.Sprintf("with.SLOs[%d]", i), err.Error()))
+		}
+	}
+	for i, o := range t.With.Objectives {
+		if o.Name == "" {
+			errs = append(errs, newFieldError(fmt.Sprintf("with.objectives[%d].name", i), "objective without a name"))
+		}
+		if _, err := compileObjective(o); err != nil {
+			errs = append(errs, newFieldError(fmt.Sprintf("with.objectives[%d].expr", i), "invalid objective %q: %v", o.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// endpointMetrics are the metrics of one endpoint of an http or grpc task
+type endpointMetrics struct {
+	// task is the name of the task that produced the metrics
+	task string
+	// endpoint is the name of the endpoint
+	endpoint string
+	// version is the version of the endpoint
+	version VersionInfo
+	// versionStr is the version and track of the endpoint for display purposes; empty if they are not known
+	versionStr string
+	// metrics maps fully qualified metric names to values
+	metrics map[string]float64
+}
+
+// durationToMilliseconds converts a duration into a number of milliseconds
+func durationToMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// formatPercentile formats a percentile for use in a metric name (example, 99.9)
+func formatPercentile(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// getHTTPMetrics computes the metrics of an http endpoint
+func getHTTPMetrics(r *fhttp.HTTPRunnerResults) map[string]float64 {
+	m := map[string]float64{}
+	if r == nil || r.DurationHistogram == nil {
+		return m
+	}
+
+	count := float64(r.DurationHistogram.Count)
+	errorCount := float64(0)
+	if r.ErrorsDurationHistogram != nil {
+		errorCount = float64(r.ErrorsDurationHistogram.Count)
+	}
+	m[httpMetricPrefix+requestCountMetric] = count
+	m[httpMetricPrefix+errorCountMetric] = errorCount
+	if count > 0 {
+		m[httpMetricPrefix+errorRateMetric] = errorCount / count
+	}
+
+	// fortio durations are in seconds
+	m[httpMetricPrefix+latencyMeanMetric] = r.DurationHistogram.Avg * 1000
+	m[httpMetricPrefix+latencyStdDevMetric] = r.DurationHistogram.StdDev * 1000
+	m[httpMetricPrefix+latencyMinMetric] = r.DurationHistogram.Min * 1000
+	m[httpMetricPrefix+latencyMaxMetric] = r.DurationHistogram.Max * 1000
+	for _, p := range r.DurationHistogram.Percentiles {
+		m[httpMetricPrefix+latencyPrefix+formatPercentile(p.Percentile)] = p.Value * 1000
+	}
+	return m
+}
+
+// getGRPCMetrics computes the metrics of a grpc endpoint
+func getGRPCMetrics(r *runner.Report) map[string]float64 {
+	m := map[string]float64{}
+	if r == nil {
+		return m
+	}
+
+	count := float64(r.Count)
+	errorCount := float64(0)
+	for _, c := range r.ErrorDist {
+		errorCount += float64(c)
+	}
+	m[grpcMetricPrefix+requestCountMetric] = count
+	m[grpcMetricPrefix+errorCountMetric] = errorCount
+	if count > 0 {
+		m[grpcMetricPrefix+errorRateMetric] = errorCount / count
+	}
+
+	m[grpcMetricPrefix+latencyMeanMetric] = durationToMilliseconds(r.Average)
+	m[grpcMetricPrefix+latencyMinMetric] = durationToMilliseconds(r.Fastest)
+	m[grpcMetricPrefix+latencyMaxMetric] = durationToMilliseconds(r.Slowest)
+	for _, ld := range r.LatencyDistribution {
+		m[grpcMetricPrefix+latencyPrefix+strconv.Itoa(ld.Percentage)] = durationToMilliseconds(ld.Latency)
+	}
+	return m
+}
+
+// getTaskData converts the data produced by a task into v
+// Task data may have been produced in this run, or read back from a previous one;
+// a JSON round trip handles both cases
+func getTaskData(exp *Experiment, task string, v interface{}) (bool, error) {
+	if exp.Result == nil || exp.Result.Insights == nil {
+		return false, nil
+	}
+	data, ok := exp.Result.Insights.TaskData[task]
+	if !ok || data == nil {
+		return false, nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// newEndpointMetrics creates the metrics of an endpoint, labelled with its version
+func newEndpointMetrics(exp *Experiment, task string, endpoint string, metrics map[string]float64) endpointMetrics {
+	e := endpointMetrics{task: task, endpoint: endpoint, metrics: metrics}
+	in := exp.Result.Insights
+	if i, ok := in.EndpointVersion(task, endpoint); ok {
+		e.version = in.VersionNames[i]
+		if e.version != (VersionInfo{}) {
+			e.versionStr = in.TrackVersionStr(i)
+		}
+	}
+	return e
+}
+
+// getEndpointMetrics computes the metrics of all endpoints of the http and grpc tasks
+func getEndpointMetrics(exp *Experiment) ([]endpointMetrics, error) {
+	em := []endpointMetrics{}
+
+	httpResult := HTTPResult{}
+	if _, err := getTaskData(exp, CollectHTTPTaskName, &httpResult); err != nil {
+		log.Logger.WithStackTrace(err.Error()).Error("cannot read http task data")
+		return nil, err
+	}
+	for endpoint, r := range httpResult {
+		em = append(em, newEndpointMetrics(exp, CollectHTTPTaskName, endpoint, getHTTPMetrics(r.HTTPRunnerResults)))
+	}
+
+	ghzResult := GHZResult{}
+	if _, err := getTaskData(exp, CollectGRPCTaskName, &ghzResult); err != nil {
+		log.Logger.WithStackTrace(err.Error()).Error("cannot read grpc task data")
+		return nil, err
+	}
+	for endpoint, r := range ghzResult {
+		em = append(em, newEndpointMetrics(exp, CollectGRPCTaskName, endpoint, getGRPCMetrics(r)))
+	}
+
+	// stable ordering of rows
+	sort.Slice(em, func(i, j int) bool {
+		if em[i].task != em[j].task {
+			return em[i].task < em[j].task
+		}
+		return em[i].endpoint < em[j].endpoint
+	})
+	return em, nil
+}
+
+// assessSLO assesses an SLO of the form `<metric> <op> <value>` for every endpoint
+func assessSLO(s string, em []endpointMetrics) []SLOResult {
+	slo, _ := parseSLO(s)
+	results := []SLOResult{}
+	for _, e := range em {
+		if metricTask(slo.metric) != e.task {
+			// metric belongs to the other task
+			continue
+		}
+		r := SLOResult{
+			SLO:      s,
+			Task:     e.task,
+			Endpoint: e.endpoint,
+			Version:  e.versionStr,
+		}
+		if value, ok := e.metrics[slo.metric]; ok {
+			r.Value = float64Pointer(value)
+			r.Satisfied = slo.satisfied(value)
+		} else {
+			// for example, a percentile that was not computed, or the error rate of an endpoint without requests
+			r.Message = fmt.Sprintf("no data for metric %v", slo.metric)
+		}
+		results = append(results, r)
+	}
+	if len(results) == 0 {
+		results = append(results, SLOResult{
+			SLO:     s,
+			Message: fmt.Sprintf("no data for metric %v", slo.metric),
+		})
+	}
+	return results
+}
+
+// assessObjective assesses an objective for every endpoint
+func assessObjective(o objective, em []endpointMetrics) []SLOResult {
+	program, _ := compileObjective(o)
+	metrics := objectiveMetrics(program)
+	results := []SLOResult{}
+	for _, e := range em {
+		// objectives that reference metrics are assessed for the endpoints of the tasks of those metrics
+		if len(metrics) > 0 && !slices.ContainsFunc(metrics, func(m string) bool { return metricTask(m) == e.task }) {
+			continue
+		}
+		r := SLOResult{
+			SLO:      o.Name,
+			Task:     e.task,
+			Endpoint: e.endpoint,
+			Version:  e.versionStr,
+		}
+		if i := slices.IndexFunc(metrics, func(m string) bool { _, ok := e.metrics[m]; return !ok }); i >= 0 {
+			r.Message = fmt.Sprintf("no data for metric %v", metrics[i])
+			results = append(results, r)
+			continue
+		}
+		output, err := expr.Run(program, objectiveEnv(e))
+		if err != nil {
+			r.Message = err.Error()
+		} else {
+			r.Satisfied = output.(bool)
+		}
+		results = append(results, r)
+	}
+	if len(results) == 0 {
+		results = append(results, SLOResult{
+			SLO:     o.Name,
+			Message: "no data",
+		})
+	}
+	return results
+}
+
+// Run executes this task
+func (t *assessTask) Run(_ context.Context, exp *Experiment) error {
+	err := t.ValidateInputs()
+	if err != nil {
+		return err
+	}
+
+	t.InitializeDefaults()
+
+	em, err := getEndpointMetrics(exp)
+	if err != nil {
+		return err
+	}
+
+	result := AssessResult{
+		SLOs:   []SLOResult{},
+		Passed: true,
+	}
+	for _, s := range t.With.SLOs {
+		result.SLOs = append(result.SLOs, assessSLO(s, em)...)
+	}
+	for _, o := range t.With.Objectives {
+		result.SLOs = append(result.SLOs, assessObjective(o, em)...)
+	}
+	for _, r := range result.SLOs {
+		if !r.Satisfied {
+			log.Logger.Infof("SLO %v not satisfied for %v endpoint %v", r.SLO, r.Task, r.Endpoint)
+			result.Passed = false
+		}
+	}
+
+	// this task populates insights in the experiment
+	exp.Result.initInsights()
+
+	// write data to Insights
+	exp.Result.Insights.TaskData[AssessTaskName] = result
+
+	return nil
+}
+
+// SLOsSatisfied returns true if the assess task has run and every SLO and objective is satisfied
+// It is intended to be used in task conditions (example, `if: SLOsSatisfied()`)
+func (exp *Experiment) SLOsSatisfied() bool {
+	result := AssessResult{}
+	ok, err := getTaskData(exp, AssessTaskName, &result)
+	if err != nil {
+		log.Logger.WithStackTrace(err.Error()).Error("cannot read assess task data")
+		return false
+	}
+	return ok && result.Passed
+}
@@ -0,0 +1,311 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"fortio.org/fortio/fhttp"
+	"fortio.org/fortio/periodic"
+	"fortio.org/fortio/stats"
+	"github.com/bojand/ghz/runner"
+	"github.com/stretchr/testify/assert"
+)
+
+// getAssessTestExperiment returns an experiment with http and grpc task data
+func getAssessTestExperiment() *Experiment {
+	exp := &Experiment{}
+	exp.initResults(1)
+	_ = exp.Result.InitInsightsWithNumVersions(1)
+	exp.Result.Insights.TaskData[CollectHTTPTaskName] = HTTPResult{
+		"fast": &HTTPEndpointResult{HTTPRunnerResults: &fhttp.HTTPRunnerResults{
+			RunnerResults: periodic.RunnerResults{
+				DurationHistogram: &stats.HistogramData{
+					Count: 100,
+					Avg:   0.010,
+					Percentiles: []stats.Percentile{
+						{Percentile: 99, Value: 0.050},
+						{Percentile: 99.9, Value: 0.080},
+					},
+				},
+				ErrorsDurationHistogram: &stats.HistogramData{Count: 0},
+			},
+		}},
+		"slow": &HTTPEndpointResult{HTTPRunnerResults: &fhttp.HTTPRunnerResults{
+			RunnerResults: periodic.RunnerResults{
+				DurationHistogram: &stats.HistogramData{
+					Count: 100,
+					Avg:   0.200,
+					Percentiles: []stats.Percentile{
+						{Percentile: 99, Value: 0.500},
+					},
+				},
+				ErrorsDurationHistogram: &stats.HistogramData{Count: 5},
+			},
+		}},
+	}
+	exp.Result.Insights.TaskData[CollectGRPCTaskName] = GHZResult{
+		"hello": &runner.Report{
+			Count:     200,
+			Average:   20 * time.Millisecond,
+			ErrorDist: map[string]int{"unavailable": 1},
+			LatencyDistribution: []runner.LatencyDistribution{
+				{Percentage: 99, Latency: 40 * time.Millisecond},
+			},
+		},
+	}
+	return exp
+}
+
+func TestParseSLO(t *testing.T) {
+	slo, err := parseSLO("http/latency-p99 <= 200ms")
+	assert.NoError(t, err)
+	assert.Equal(t, "http/latency-p99", slo.metric)
+	assert.Equal(t, "<=", slo.op)
+	assert.Equal(t, float64(200), slo.limit)
+
+	slo, err = parseSLO("grpc/error-rate<0.01")
+	assert.NoError(t, err)
+	assert.Equal(t, "grpc/error-rate", slo.metric)
+	assert.Equal(t, "<", slo.op)
+	assert.Equal(t, 0.01, slo.limit)
+	assert.True(t, slo.satisfied(0.005))
+	assert.False(t, slo.satisfied(0.01))
+
+	for _, s := range []string{"http/latency-p99", "http/latency-p99 == 200", "http/latency-p99 < fast"} {
+		_, err = parseSLO(s)
+		assert.Error(t, err)
+	}
+}
+
+func TestAssessValidateInputs(t *testing.T) {
+	tests := []struct {
+		with  assessInputs
+		valid bool
+	}{
+		{with: assessInputs{}, valid: false},
+		{with: assessInputs{SLOs: []string{"http/error-rate < 0.01"}}, valid: true},
+		{with: assessInputs{SLOs: []string{"hello"}}, valid: false},
+		{with: assessInputs{Objectives: []objective{{Name: "o", Expr: `metrics["http/error-count"] == 0`}}}, valid: true},
+		{with: assessInputs{Objectives: []objective{{Expr: "true"}}}, valid: false},
+		{with: assessInputs{Objectives: []objective{{Name: "o", Expr: "1 +"}}}, valid: false},
+		{with: assessInputs{Objectives: []objective{{Name: "o", Expr: "1 + 1"}}}, valid: false},
+	}
+	for _, test := range tests {
+		at := &assessTask{With: test.with}
+		if test.valid {
+			assert.NoError(t, at.ValidateInputs())
+		} else {
+			assert.Error(t, at.ValidateInputs())
+		}
+	}
+}
+
+func TestRunAssess(t *testing.T) {
+	exp := getAssessTestExperiment()
+	at := &assessTask{
+		TaskMeta: TaskMeta{Task: StringPointer(AssessTaskName)},
+		With: assessInputs{
+			SLOs: []string{
+				"http/latency-p99 <= 200ms",
+				"grpc/error-rate < 0.01",
+			},
+			Objectives: []objective{{
+				Name: "no http errors",
+				Expr: `endpoint == "hello" || metrics["http/error-count"] == 0`,
+			}},
+		},
+	}
+	err := at.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	result, ok := exp.Result.Insights.TaskData[AssessTaskName].(AssessResult)
+	assert.True(t, ok)
+	assert.False(t, result.Passed)
+	assert.False(t, exp.SLOsSatisfied())
+
+	verdicts := map[string]bool{}
+	for _, r := range result.SLOs {
+		verdicts[r.SLO+":"+r.Endpoint] = r.Satisfied
+	}
+	assert.Equal(t, map[string]bool{
+		"http/latency-p99 <= 200ms:fast": true,
+		"http/latency-p99 <= 200ms:slow": false,
+		"grpc/error-rate < 0.01:hello":   true,
+		"no http errors:fast":            true,
+		"no http errors:slow":            false,
+	}, verdicts)
+
+	// observed value is recorded in milliseconds
+	assert.Equal(t, "fast", result.SLOs[0].Endpoint)
+	assert.InDelta(t, 50, *result.SLOs[0].Value, 0.001)
+
+	// metric for which there is no data
+	at.With = assessInputs{SLOs: []string{"http/latency-p75 < 1s"}}
+	err = at.Run(context.Background(), exp)
+	assert.NoError(t, err)
+	result = exp.Result.Insights.TaskData[AssessTaskName].(AssessResult)
+	assert.False(t, result.Passed)
+	assert.Equal(t, 2, len(result.SLOs))
+	for _, r := range result.SLOs {
+		assert.False(t, r.Satisfied)
+		assert.Equal(t, "no data for metric http/latency-p75", r.Message)
+	}
+
+	// all satisfied
+	at.With = assessInputs{SLOs: []string{"http/latency-p99 <= 1s", "grpc/latency-p99 < 50"}}
+	err = at.Run(context.Background(), exp)
+	assert.NoError(t, err)
+	assert.True(t, exp.SLOsSatisfied())
+
+	// task data read back from a previous run
+	b, err := json.Marshal(exp.Result)
+	assert.NoError(t, err)
+	exp.Result = &ExperimentResult{}
+	err = json.Unmarshal(b, exp.Result)
+	assert.NoError(t, err)
+	assert.True(t, exp.SLOsSatisfied())
+}
+
+func TestRunAssessMixedTasks(t *testing.T) {
+	exp := getAssessTestExperiment()
+	at := &assessTask{
+		TaskMeta: TaskMeta{Task: StringPointer(AssessTaskName)},
+		With: assessInputs{
+			Objectives: []objective{{
+				Name: "http latency",
+				Expr: `metrics["http/latency-p99"] < 1000`,
+			}, {
+				Name: "grpc latency",
+				Expr: `metrics["grpc/latency-p99"] < 1000`,
+			}, {
+				Name: "any endpoint",
+				Expr: `endpoint != ""`,
+			}},
+		},
+	}
+	err := at.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	result := exp.Result.Insights.TaskData[AssessTaskName].(AssessResult)
+	assert.True(t, result.Passed)
+	verdicts := map[string]bool{}
+	for _, r := range result.SLOs {
+		verdicts[r.SLO+":"+r.Endpoint] = r.Satisfied
+	}
+	// objectives are assessed for the endpoints of the tasks whose metrics they reference
+	assert.Equal(t, map[string]bool{
+		"http latency:fast":  true,
+		"http latency:slow":  true,
+		"grpc latency:hello": true,
+		"any endpoint:fast":  true,
+		"any endpoint:hello": true,
+		"any endpoint:slow":  true,
+	}, verdicts)
+}
+
+func TestRunAssessMissingMetrics(t *testing.T) {
+	exp := getAssessTestExperiment()
+	// endpoint without requests has no error rate
+	exp.Result.Insights.TaskData[CollectHTTPTaskName].(HTTPResult)["idle"] = &HTTPEndpointResult{HTTPRunnerResults: &fhttp.HTTPRunnerResults{
+		RunnerResults: periodic.RunnerResults{
+			DurationHistogram: &stats.HistogramData{Count: 0},
+		},
+	}}
+	at := &assessTask{
+		TaskMeta: TaskMeta{Task: StringPointer(AssessTaskName)},
+		With: assessInputs{
+			// p99.9 was not computed for slow
+			SLOs: []string{"http/latency-p99.9 < 1s"},
+			Objectives: []objective{{
+				Name: "low error rate",
+				Expr: `metrics["http/error-rate"] < 0.1`,
+			}, {
+				Name: "computed name",
+				Expr: `metrics[endpoint] < 1000`,
+			}},
+		},
+	}
+	err := at.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	result := exp.Result.Insights.TaskData[AssessTaskName].(AssessResult)
+	assert.False(t, result.Passed)
+	verdicts := map[string]bool{}
+	messages := map[string]string{}
+	for _, r := range result.SLOs {
+		verdicts[r.SLO+":"+r.Endpoint] = r.Satisfied
+		messages[r.SLO+":"+r.Endpoint] = r.Message
+	}
+	assert.True(t, verdicts["http/latency-p99.9 < 1s:fast"])
+	assert.False(t, verdicts["http/latency-p99.9 < 1s:slow"])
+	assert.Equal(t, "no data for metric http/latency-p99.9", messages["http/latency-p99.9 < 1s:slow"])
+	assert.True(t, verdicts["low error rate:slow"])
+	assert.False(t, verdicts["low error rate:idle"])
+	assert.Equal(t, "no data for metric http/error-rate", messages["low error rate:idle"])
+
+	// objectives with computed metric names are assessed for every endpoint;
+	// missing metrics are nil, so comparisons with them fail
+	assert.False(t, verdicts["computed name:fast"])
+	assert.NotEmpty(t, messages["computed name:fast"])
+	assert.False(t, verdicts["computed name:hello"])
+	assert.NotEmpty(t, messages["computed name:hello"])
+}
+
+func TestRunAssessVersions(t *testing.T) {
+	exp := getAssessTestExperiment()
+	exp.Result.setEndpointVersions(CollectHTTPTaskName, map[string]VersionInfo{
+		"fast": {Track: "candidate", Version: "v2"},
+		"slow": {Track: "stable", Version: "v1"},
+	})
+	at := &assessTask{
+		TaskMeta: TaskMeta{Task: StringPointer(AssessTaskName)},
+		With: assessInputs{
+			SLOs: []string{"http/latency-p99 <= 200ms", "grpc/error-rate < 0.01"},
+			Objectives: []objective{{
+				Name: "candidate has no errors",
+				Expr: `track != "candidate" || metrics["http/error-count"] == 0`,
+			}},
+		},
+	}
+	err := at.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	result := exp.Result.Insights.TaskData[AssessTaskName].(AssessResult)
+	versions := map[string]string{}
+	verdicts := map[string]bool{}
+	for _, r := range result.SLOs {
+		versions[r.Task+":"+r.Endpoint] = r.Version
+		verdicts[r.SLO+":"+r.Endpoint] = r.Satisfied
+	}
+	// endpoints of unknown versions are not labelled
+	assert.Equal(t, map[string]string{
+		"http:fast":  "candidate (v2)",
+		"http:slow":  "stable (v1)",
+		"grpc:hello": "",
+	}, versions)
+	assert.True(t, verdicts["candidate has no errors:fast"])
+	assert.True(t, verdicts["candidate has no errors:slow"])
+	assert.False(t, verdicts["http/latency-p99 <= 200ms:slow"])
+}
+
+func TestSLOsSatisfiedCondition(t *testing.T) {
+	setupMockMetricsServer(t)
+	_ = os.Chdir(t.TempDir())
+
+	exp := getAssessTestExperiment()
+	exp.Spec = []Task{
+		&assessTask{
+			TaskMeta: TaskMeta{Task: StringPointer(AssessTaskName)},
+			With:     assessInputs{SLOs: []string{"http/error-rate <= 0"}},
+		},
+		&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch passed"), If: StringPointer("SLOsSatisfied()")}},
+		&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch failed"), If: StringPointer("not SLOsSatisfied()")}},
+	}
+	err := exp.run(context.Background(), &mockDriver{exp})
+	assert.NoError(t, err)
+	assert.NoFileExists(t, "passed")
+	assert.FileExists(t, "failed")
+}
@@ -0,0 +1,323 @@
+package base
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"fortio.org/fortio/fhttp"
+	log "github.com/iter8-tools/iter8/base/log"
+	"github.com/xeipuuv/gojsonschema"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	// bodyRegexCheck is the name of the check of response bodies against a regular expression
+	bodyRegexCheck = "bodyRegex"
+	// jsonSchemaCheck is the name of the check of response bodies against a JSON Schema
+	jsonSchemaCheck = "jsonSchema"
+	// maxBodySizeCheck is the name of the check of the size of response bodies
+	maxBodySizeCheck = "maxBodySize"
+	// bodyReadCheck is the name under which responses whose bodies cannot be read are counted
+	bodyReadCheck = "bodyRead"
+
+	// checkFailedCode is the status code with which responses that fail a check are reported, so that Fortio counts them as errors
+	// Like the -1 of Fortio for connection errors, it is kept in the results, so that the status codes are consistent with the errors
+	checkFailedCode = -2
+)
+
+// responseChecks are checks of the responses of an endpoint
+// Successful responses (with 2xx status codes) that fail any check, or whose bodies cannot be read, are considered errors
+// Responses are checked by a transport, so tests with checks use the standard HTTP client of Fortio, which is slower than its fast client
+type responseChecks struct {
+	// BodyRegex is a regular expression that response bodies must match; optional
+	BodyRegex *string `json:"bodyRegex,omitempty" yaml:"bodyRegex,omitempty"`
+	// JSONPath is a list of checks of values in JSON response bodies; optional
+	JSONPath []jsonPathCheck `json:"jsonPath,omitempty" yaml:"jsonPath,omitempty"`
+	// JSONSchema is a JSON Schema that response bodies must satisfy; optional
+	JSONSchema map[string]interface{} `json:"jsonSchema,omitempty" yaml:"jsonSchema,omitempty"`
+	// MaxBodySize is the maximum size of response bodies in bytes; optional
+	// At most maxBodySize+1 bytes of bodies are read, and larger bodies fail only this check.
+	// If it is the only check, bodies are not kept in memory; their Content-Length, or at most maxBodySize+1 bytes of them, are read
+	MaxBodySize *int64 `json:"maxBodySize,omitempty" yaml:"maxBodySize,omitempty"`
+}
+
+// jsonPathCheck checks a value in JSON response bodies
+type jsonPathCheck struct {
+	// Path is a JSONPath expression (example, $.predictions[0].label)
+	Path string `json:"path" yaml:"path"`
+	// Equals is the expected value at path. If this field is not specified, a value need only exist at path.
+	Equals interface{} `json:"equals,omitempty" yaml:"equals,omitempty"`
+}
+
+// name is the name of a JSONPath check, used as the key of its failure count
+func (c jsonPathCheck) name() string {
+	return "jsonPath " + c.Path
+}
+
+// template is the JSONPath template of the path of a check
+func (c jsonPathCheck) template() string {
+	return jsonPathTemplate(c.Path)
+}
+
+// jsonPathTemplate returns the JSONPath template of a JSONPath expression, which may omit braces
+func jsonPathTemplate(path string) string {
+	if strings.HasPrefix(path, "{") {
+		return path
+	}
+	return "{" + path + "}"
+}
+
+// validateResponseChecks validates response checks; prefix is the path of the checks
+func validateResponseChecks(prefix string, c *responseChecks) error {
+	if c == nil {
+		return nil
+	}
+	errs := []error{}
+	if c.BodyRegex != nil {
+		if _, err := regexp.Compile(*c.BodyRegex); err != nil {
+			errs = append(errs, newFieldError(prefix+".bodyRegex", "invalid regular expression: %v", err))
+		}
+	}
+	for i, p := range c.JSONPath {
+		if err := jsonpath.New(p.Path).Parse(p.template()); p.Path == "" || err != nil {
+			errs = append(errs, newFieldError(fmt.Sprintf("%v.jsonPath[%d].path", prefix, i), "invalid JSONPath %q", p.Path))
+		}
+	}
+	if c.JSONSchema != nil {
+		if _, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(c.JSONSchema)); err != nil {
+			errs = append(errs, newFieldError(prefix+".jsonSchema", "invalid JSON Schema: %v", err))
+		}
+	}
+	if c.MaxBodySize != nil && *c.MaxBodySize < 0 {
+		errs = append(errs, newFieldError(prefix+".maxBodySize", "must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// responseValidator checks the responses of a Fortio test, and counts the responses that fail each check
+type responseValidator struct {
+	checks    responseChecks
+	bodyRegex *regexp.Regexp
+	schema    *gojsonschema.Schema
+
+	mu sync.Mutex
+	// failures is the number of responses that failed each check
+	failures map[string]int64
+}
+
+// newResponseValidator returns a validator for the given checks
+func newResponseValidator(c responseChecks) (*responseValidator, error) {
+	v := &responseValidator{
+		checks:   c,
+		failures: map[string]int64{},
+	}
+	var err error
+	if c.BodyRegex != nil {
+		if v.bodyRegex, err = regexp.Compile(*c.BodyRegex); err != nil {
+			return nil, err
+		}
+	}
+	if c.JSONSchema != nil {
+		if v.schema, err = gojsonschema.NewSchema(gojsonschema.NewGoLoader(c.JSONSchema)); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// failedChecks returns the names of the checks that a response body fails
+func (v *responseValidator) failedChecks(body []byte) []string {
+	failed := []string{}
+	if v.checks.MaxBodySize != nil && int64(len(body)) > *v.checks.MaxBodySize {
+		failed = append(failed, maxBodySizeCheck)
+	}
+	if v.bodyRegex != nil && !v.bodyRegex.Match(body) {
+		failed = append(failed, bodyRegexCheck)
+	}
+	if len(v.checks.JSONPath) == 0 && v.schema == nil {
+		return failed
+	}
+
+	var doc interface{}
+	isJSON := json.Unmarshal(body, &doc) == nil
+	for _, c := range v.checks.JSONPath {
+		if !isJSON || !jsonPathHolds(c, doc) {
+			failed = append(failed, c.name())
+		}
+	}
+	if v.schema != nil {
+		if !isJSON {
+			failed = append(failed, jsonSchemaCheck)
+		} else if result, err := v.schema.Validate(gojsonschema.NewGoLoader(doc)); err != nil || !result.Valid() {
+			failed = append(failed, jsonSchemaCheck)
+		}
+	}
+	return failed
+}
+
+// jsonPathHolds returns true if the JSONPath check holds for a decoded JSON document
+func jsonPathHolds(c jsonPathCheck, doc interface{}) bool {
+	actual, ok := findJSONPath(c.Path, doc)
+	if !ok {
+		return false
+	}
+	return c.Equals == nil || jsonEqual(c.Equals, actual)
+}
+
+// findJSONPath returns the first value at a JSONPath of a decoded JSON document, if any
+func findJSONPath(path string, doc interface{}) (interface{}, bool) {
+	jp := jsonpath.New(path)
+	if err := jp.Parse(jsonPathTemplate(path)); err != nil {
+		return nil, false
+	}
+	results, err := jp.FindResults(doc)
+	if err != nil || len(results) == 0 || len(results[0]) == 0 {
+		return nil, false
+	}
+	return results[0][0].Interface(), true
+}
+
+// jsonEqual returns true if two values are equal in their JSON form, so that numbers of different types are equal
+func jsonEqual(x interface{}, y interface{}) bool {
+	bx, _ := json.Marshal(x)
+	by, _ := json.Marshal(y)
+	var vx, vy interface{}
+	_ = json.Unmarshal(bx, &vx)
+	_ = json.Unmarshal(by, &vy)
+	return reflect.DeepEqual(vx, vy)
+}
+
+// checksSizeOnly returns true if the size of response bodies is the only check, which does not need whole bodies
+func (v *responseValidator) checksSizeOnly() bool {
+	return v.checks.MaxBodySize != nil && v.bodyRegex == nil && len(v.checks.JSONPath) == 0 && v.schema == nil
+}
+
+// readBody reads the body of a response, up to maxBodySize+1 bytes if maxBodySize is set
+// The bytes that are read are given back to the response
+func (v *responseValidator) readBody(resp *http.Response) ([]byte, error) {
+	r := io.Reader(resp.Body)
+	if v.checks.MaxBodySize != nil {
+		r = io.LimitReader(resp.Body, *v.checks.MaxBodySize+1)
+	}
+	body, err := io.ReadAll(r)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	return body, err
+}
+
+// tooLarge returns true if a body, read by readBody, is larger than maxBodySize
+func (v *responseValidator) tooLarge(body []byte) bool {
+	return v.checks.MaxBodySize != nil && int64(len(body)) > *v.checks.MaxBodySize
+}
+
+// bodyTooLarge returns true if the body of a response is larger than maxBodySize
+// The body is read up to maxBodySize+1 bytes if its length is unknown
+func (v *responseValidator) bodyTooLarge(resp *http.Response) (bool, error) {
+	if resp.ContentLength >= 0 {
+		return resp.ContentLength > *v.checks.MaxBodySize, nil
+	}
+	head, err := v.readBody(resp)
+	return v.tooLarge(head), err
+}
+
+// transport returns a transport that checks successful responses
+// Responses that fail any check, or whose bodies cannot be read, are reported with checkFailedCode
+// If warmup is true, the first response is not checked: Fortio sends a warmup request with each client of tests
+// that are not based on a number of requests, which it does not count, and which aborts the test if it is not successful
+func (v *responseValidator) transport(base http.RoundTripper, warmup bool) http.RoundTripper {
+	var warmedUp atomic.Bool
+	warmedUp.Store(!warmup)
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if !warmedUp.Swap(true) {
+			return base.RoundTrip(req)
+		}
+		resp, err := base.RoundTrip(req)
+		if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return resp, err
+		}
+
+		var failed []string
+		if v.checksSizeOnly() {
+			tooLarge, err := v.bodyTooLarge(resp)
+			switch {
+			case err != nil:
+				failed = []string{bodyReadCheck}
+			case tooLarge:
+				failed = []string{maxBodySizeCheck}
+			}
+		} else {
+			body, err := v.readBody(resp)
+			switch {
+			case err != nil:
+				failed = []string{bodyReadCheck}
+			case v.tooLarge(body):
+				// other checks cannot be evaluated against part of a body
+				failed = []string{maxBodySizeCheck}
+			default:
+				failed = v.failedChecks(body)
+			}
+		}
+		if len(failed) == 0 {
+			return resp, nil
+		}
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		for _, name := range failed {
+			v.failures[name]++
+		}
+		resp.StatusCode = checkFailedCode
+		return resp, nil
+	})
+}
+
+// attach checks the responses of a Fortio test with this validator
+func (v *responseValidator) attach(fo *fhttp.HTTPRunnerOptions) {
+	// responses can only be checked by a transport, which fortio creates for each client
+	warmup := fo.Exactly <= 0
+	addTransport(fo, func(base http.RoundTripper) http.RoundTripper {
+		return v.transport(base, warmup)
+	})
+}
+
+// runCheckedFortio runs a Fortio HTTP test, checking its responses if there are response checks
+// The number of responses that failed each check is also returned
+func runCheckedFortio(ctx context.Context, fo *fhttp.HTTPRunnerOptions, checks *responseChecks) (*fhttp.HTTPRunnerResults, map[string]int64, error) {
+	if checks == nil {
+		r, err := runFortio(ctx, fo)
+		return r, nil, err
+	}
+	v, err := newResponseValidator(*checks)
+	if err != nil {
+		log.Logger.WithStackTrace(err.Error()).Error("unable to compile response checks")
+		return nil, nil, err
+	}
+	v.attach(fo)
+	r, err := runFortio(ctx, fo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, v.failureCounts(), nil
+}
+
+// failureCounts returns the number of responses that failed each check
+func (v *responseValidator) failureCounts() map[string]int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	failures := map[string]int64{}
+	for name, n := range v.failures {
+		failures[name] = n
+	}
+	return failures
+}
@@ -0,0 +1,214 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+
+	"fortio.org/fortio/fhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailedChecks(t *testing.T) {
+	v, err := newResponseValidator(responseChecks{
+		BodyRegex: StringPointer(`"label"`),
+		JSONPath: []jsonPathCheck{
+			{Path: "$.predictions[0].label", Equals: "cat"},
+			{Path: "$.predictions[0].score", Equals: 1},
+			{Path: "$.model"},
+		},
+		JSONSchema: map[string]interface{}{
+			"type":     "object",
+			"required": []interface{}{"predictions"},
+		},
+		MaxBodySize: int64Pointer(100),
+	})
+	assert.NoError(t, err)
+
+	assert.Empty(t, v.failedChecks([]byte(`{"model": "m", "predictions": [{"label": "cat", "score": 1.0}]}`)))
+	assert.Equal(t, []string{"jsonPath $.predictions[0].label", "jsonPath $.model"},
+		v.failedChecks([]byte(`{"predictions": [{"label": "dog", "score": 1}]}`)))
+	assert.Equal(t, []string{maxBodySizeCheck, bodyRegexCheck, "jsonPath $.predictions[0].label", "jsonPath $.predictions[0].score", "jsonPath $.model", jsonSchemaCheck},
+		v.failedChecks(make([]byte, 101)))
+	assert.Equal(t, []string{bodyRegexCheck, "jsonPath $.predictions[0].label", "jsonPath $.predictions[0].score", "jsonPath $.model", jsonSchemaCheck},
+		v.failedChecks([]byte{}))
+}
+
+func TestMaxBodySizeOnly(t *testing.T) {
+	v, err := newResponseValidator(responseChecks{MaxBodySize: int64Pointer(4)})
+	assert.NoError(t, err)
+	assert.True(t, v.checksSizeOnly())
+
+	// bodies of known length are not read
+	resp := &http.Response{ContentLength: 5, Body: io.NopCloser(strings.NewReader("hello"))}
+	tooLarge, err := v.bodyTooLarge(resp)
+	assert.NoError(t, err)
+	assert.True(t, tooLarge)
+	resp = &http.Response{ContentLength: 4, Body: io.NopCloser(strings.NewReader("four"))}
+	tooLarge, err = v.bodyTooLarge(resp)
+	assert.NoError(t, err)
+	assert.False(t, tooLarge)
+
+	// bodies of unknown length are read up to maxBodySize+1 bytes, which are given back to the response
+	resp = &http.Response{ContentLength: -1, Body: io.NopCloser(strings.NewReader("hello world"))}
+	tooLarge, err = v.bodyTooLarge(resp)
+	assert.NoError(t, err)
+	assert.True(t, tooLarge)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+	assert.NoError(t, resp.Body.Close())
+
+	resp = &http.Response{ContentLength: -1, Body: io.NopCloser(strings.NewReader("four"))}
+	tooLarge, err = v.bodyTooLarge(resp)
+	assert.NoError(t, err)
+	assert.False(t, tooLarge)
+
+	// other checks need whole bodies
+	v, err = newResponseValidator(responseChecks{MaxBodySize: int64Pointer(4), BodyRegex: StringPointer("o")})
+	assert.NoError(t, err)
+	assert.False(t, v.checksSizeOnly())
+}
+
+func TestCheckTransport(t *testing.T) {
+	var body io.Reader
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, ContentLength: -1, Body: io.NopCloser(body)}, nil
+	})
+	v, err := newResponseValidator(responseChecks{MaxBodySize: int64Pointer(4), BodyRegex: StringPointer("o")})
+	assert.NoError(t, err)
+	transport := v.transport(base, false)
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:8080", nil)
+
+	body = strings.NewReader("foo")
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	// larger bodies are read up to maxBodySize+1 bytes, and fail only the size check
+	body = strings.NewReader("hello world")
+	resp, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, checkFailedCode, resp.StatusCode)
+	b, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(b))
+
+	// bodies that cannot be read fail, whether or not they are kept in memory
+	body = iotest.ErrReader(errors.New("connection reset"))
+	resp, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, checkFailedCode, resp.StatusCode)
+	v.checks.BodyRegex, v.bodyRegex = nil, nil
+	body = iotest.ErrReader(errors.New("connection reset"))
+	resp, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, checkFailedCode, resp.StatusCode)
+
+	assert.Equal(t, map[string]int64{maxBodySizeCheck: 1, bodyReadCheck: 2}, v.failureCounts())
+
+	// warmup responses are neither checked nor counted
+	transport = v.transport(base, true)
+	body = iotest.ErrReader(errors.New("connection reset"))
+	resp, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	body = iotest.ErrReader(errors.New("connection reset"))
+	resp, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, checkFailedCode, resp.StatusCode)
+	assert.Equal(t, map[string]int64{maxBodySizeCheck: 1, bodyReadCheck: 3}, v.failureCounts())
+}
+
+func TestValidateResponseChecks(t *testing.T) {
+	err := validateEndpoint("with", endpoint{
+		URL: "http://localhost:8080",
+		ResponseChecks: &responseChecks{
+			BodyRegex:   StringPointer("("),
+			JSONPath:    []jsonPathCheck{{Path: "$.a"}, {Path: "$.b["}, {}},
+			JSONSchema:  map[string]interface{}{"type": "unknown"},
+			MaxBodySize: int64Pointer(-1),
+		},
+	}, true)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "with.responseChecks.bodyRegex: invalid regular expression")
+	assert.NotContains(t, err.Error(), "jsonPath[0]")
+	assert.Contains(t, err.Error(), `with.responseChecks.jsonPath[1].path: invalid JSONPath "$.b["`)
+	assert.Contains(t, err.Error(), `with.responseChecks.jsonPath[2].path: invalid JSONPath ""`)
+	assert.Contains(t, err.Error(), "with.responseChecks.jsonSchema: invalid JSON Schema")
+	assert.Contains(t, err.Error(), "with.responseChecks.maxBodySize: must not be negative")
+}
+
+func TestRunCollectHTTPResponseChecks(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	var count atomic.Int64
+	mux.HandleFunc("/"+foo, func(w http.ResponseWriter, r *http.Request) {
+		// every other response has an empty body
+		if count.Add(1)%2 == 0 {
+			w.WriteHeader(200)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte(`{"status": "ok"}`))
+	})
+
+	url := fmt.Sprintf("http://localhost:%d/%v", addr.Port, foo)
+	ct := &collectHTTPTask{
+		TaskMeta: TaskMeta{
+			Task: StringPointer(CollectHTTPTaskName),
+		},
+		With: collectHTTPInputs{
+			endpoint: endpoint{
+				URL:         url,
+				NumRequests: int64Pointer(10),
+				Connections: IntPointer(1),
+				ResponseChecks: &responseChecks{
+					JSONPath: []jsonPathCheck{{Path: "$.status", Equals: "ok"}},
+				},
+			},
+		},
+	}
+
+	exp := &Experiment{
+		Spec:   []Task{ct},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+	err := ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	httpResult, ok := exp.Result.Insights.TaskData[CollectHTTPTaskName].(HTTPResult)
+	assert.True(t, ok)
+	r := httpResult[url]
+	assert.Equal(t, int64(10), r.DurationHistogram.Count)
+
+	// responses that fail checks are errors, but keep their status codes
+	assert.Equal(t, int64(5), r.ErrorsDurationHistogram.Count)
+	assert.Equal(t, map[int]int64{200: 5, checkFailedCode: 5}, r.RetCodes)
+	assert.Equal(t, map[string]int64{"jsonPath $.status": 5}, r.ResponseCheckFailures)
+
+	// tests based on duration start with warmup requests, which are not checked, so that they are not aborted by failed checks
+	count.Store(0)
+	ct.With.NumRequests = nil
+	ct.With.Duration = StringPointer("1s")
+	ct.With.QPS = float32Pointer(5)
+	ct.With.ResponseChecks.JSONPath = []jsonPathCheck{{Path: "$.status", Equals: "failed"}}
+	exp.initResults(1)
+	err = ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	r = exp.Result.Insights.TaskData[CollectHTTPTaskName].(HTTPResult)[url]
+	assert.Greater(t, r.DurationHistogram.Count, int64(0))
+	assert.Equal(t, r.DurationHistogram.Count, r.ErrorsDurationHistogram.Count)
+	assert.Equal(t, map[int]int64{checkFailedCode: r.DurationHistogram.Count}, r.RetCodes)
+	assert.Equal(t, map[string]int64{"jsonPath $.status": r.DurationHistogram.Count}, r.ResponseCheckFailures)
+}
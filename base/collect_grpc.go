@@ -1,7 +1,12 @@
 package base
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"runtime"
+	"sync"
 	"time"
 
 	"dario.cat/mergo"
@@ -19,15 +24,53 @@ const (
 	insecureDefault = true
 )
 
+// grpcEndpoint contains the inputs for one endpoint
+type grpcEndpoint struct {
+	runner.Config
+
+	// Version is the name of the app version served by this endpoint; optional
+	// Endpoints with the same version and track are considered to belong to the same version
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Track is the track of the app version served by this endpoint (example, stable or candidate); optional
+	Track string `json:"track,omitempty" yaml:"track,omitempty"`
+
+	// TLS contains the TLS options used to connect to this endpoint; optional. Default value is the TLS options of the task.
+	TLS *tlsConfig `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// OAuth2 contains the client credentials used to authorize calls to this endpoint; optional. Default value is the client credentials of the task.
+	OAuth2 *oauth2Config `json:"oauth2,omitempty" yaml:"oauth2,omitempty"`
+}
+
 // collectHTTPInputs contain the inputs to the metrics collection task to be executed.
 type collectGRPCInputs struct {
 	runner.Config
 
+	// Version is the name of the app version served by the endpoints of this task; optional
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Track is the track of the app version served by the endpoints of this task (example, stable or candidate); optional
+	Track string `json:"track,omitempty" yaml:"track,omitempty"`
+
+	// TLS contains the TLS options used to connect to the app; optional. If this field is not specified, plaintext connections are used unless cacert, cert or skipTLS is specified.
+	TLS *tlsConfig `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// OAuth2 contains the client credentials used to authorize calls with bearer tokens; optional
+	OAuth2 *oauth2Config `json:"oauth2,omitempty" yaml:"oauth2,omitempty"`
+
 	// Warmup indicates if task execution is for warmup purposes; if so the results will be ignored
 	Warmup *bool `json:"warmup,omitempty" yaml:"warmup,omitempty"`
 
+	// FailOnEndpointError determines if this task fails when one of multiple endpoints cannot be tested. Default value is false.
+	// This task always fails when none of its endpoints can be tested.
+	// Either way, the endpoints that cannot be tested are recorded in the results together with their errors.
+	FailOnEndpointError *bool `json:"failOnEndpointError,omitempty" yaml:"failOnEndpointError,omitempty"`
+
+	// Mode determines how multiple endpoints are tested. Valid values are sequential and concurrent. Default value is sequential.
+	// In concurrent mode, all endpoints are tested at the same time; results are still reported per endpoint.
+	Mode *string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// RPSBudget determines how the rps of this task applies to multiple endpoints. Valid values are per-endpoint and shared. Default value is per-endpoint.
+	// A shared budget requires concurrent mode; the rps of this task is then divided evenly among the endpoints, which cannot set their own rps.
+	RPSBudget *string `json:"rpsBudget,omitempty" yaml:"rpsBudget,omitempty"`
+
 	// Endpoints is used to define multiple endpoints to test
-	Endpoints map[string]runner.Config `json:"endpoints" yaml:"endpoints"`
+	Endpoints map[string]grpcEndpoint `json:"endpoints" yaml:"endpoints"`
 }
 
 // collectGRPCTask enables performance testing of gRPC services.
@@ -44,8 +87,8 @@ type collectGRPCTask struct {
 // Key is the endpoint
 type GHZResult map[string]*runner.Report
 
-// initializeDefaults sets default values for the collect task
-func (t *collectGRPCTask) initializeDefaults() {
+// InitializeDefaults sets default values for the collect task
+func (t *collectGRPCTask) InitializeDefaults() {
 	// set defaults
 	gd.SetDefaults(&t.With)
 	// if dial timeout is zero, then set a default...
@@ -55,108 +98,353 @@ func (t *collectGRPCTask) initializeDefaults() {
 	}
 	// always count errors
 	t.With.CountErrors = countErrorsDefault
-	// todo: document how to use security credentials
-	// remove this default altogether after enabling secure
-	t.With.Insecure = insecureDefault
+	// connections are plaintext unless TLS is configured
+	if t.With.TLS == nil && !usesTLS(t.With.Config) {
+		t.With.Insecure = insecureDefault
+	}
+	setGRPCTLS(&t.With.Config, t.With.TLS)
+	if t.With.FailOnEndpointError == nil {
+		t.With.FailOnEndpointError = BoolPointer(false)
+	}
+	if t.With.Mode == nil {
+		t.With.Mode = StringPointer(EndpointModeSequential)
+	}
+	if t.With.RPSBudget == nil {
+		t.With.RPSBudget = StringPointer(BudgetPerEndpoint)
+	}
 }
 
 // validate task inputs
-func (t *collectGRPCTask) validateInputs() error {
-	return nil
+func (t *collectGRPCTask) ValidateInputs() error {
+	// validate the configuration with the defaults that will be used at run time
+	base := t.With.Config
+	gd.SetDefaults(&base)
+
+	credentialErrs := errors.Join(validateTLSConfig("with.tls", t.With.TLS), validateOAuth2Config("with.oauth2", t.With.OAuth2))
+	if len(t.With.Endpoints) == 0 {
+		return errors.Join(validateGRPCConfig("with", base), credentialErrs, validateEndpointMode(stringValue(t.With.Mode), stringValue(t.With.RPSBudget), "rps", nil, nil))
+	}
+
+	errs := []error{credentialErrs}
+	endpointRates := []string{}
+	for _, id := range sortedEndpointIDs(t.With.Endpoints) {
+		if t.With.Endpoints[id].RPS != 0 {
+			endpointRates = append(endpointRates, id)
+		}
+		// endpoints inherit unspecified options from the task
+		endpoint := t.With.Endpoints[id].Config
+		if err := mergo.Merge(&endpoint, base); err != nil {
+			errs = append(errs, newFieldError("with.endpoints."+id, "cannot merge options: %v", err))
+			continue
+		}
+		errs = append(errs, validateGRPCConfig("with.endpoints."+id, endpoint))
+		errs = append(errs, validateTLSConfig("with.endpoints."+id+".tls", t.With.Endpoints[id].TLS))
+		errs = append(errs, validateOAuth2Config("with.endpoints."+id+".oauth2", t.With.Endpoints[id].OAuth2))
+	}
+	errs = append(errs, validateEndpointMode(stringValue(t.With.Mode), stringValue(t.With.RPSBudget), "rps", endpointRates, nil))
+	return errors.Join(errs...)
+}
+
+// validateGRPCSchedule checks a ghz load or concurrency schedule; kind is load or concurrency
+func validateGRPCSchedule(prefix string, kind string, schedule string, start uint, end uint, step int, stepDuration runner.Duration) error {
+	switch schedule {
+	case "", runner.ScheduleConst:
+		return nil
+	case runner.ScheduleStep, runner.ScheduleLine:
+	default:
+		return newFieldError(fmt.Sprintf("%v.%v-schedule", prefix, kind), "invalid schedule %q; must be const, step or line", schedule)
+	}
+
+	errs := []error{}
+	if start == end {
+		errs = append(errs, newFieldError(fmt.Sprintf("%v.%v-end", prefix, kind), "%v end cannot equal %v start", kind, kind))
+	}
+	if step == 0 {
+		errs = append(errs, newFieldError(fmt.Sprintf("%v.%v-step", prefix, kind), "%v step is required for %v schedule", kind, schedule))
+	}
+	if schedule == runner.ScheduleStep && stepDuration == 0 {
+		errs = append(errs, newFieldError(fmt.Sprintf("%v.%v-step-duration", prefix, kind), "%v step duration is required for step schedule", kind))
+	}
+	return errors.Join(errs...)
+}
+
+// grpcCallRegexp matches fully qualified gRPC method names (example, helloworld.Greeter.SayHello or helloworld.Greeter/SayHello)
+var grpcCallRegexp = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*\.)*[A-Za-z_][A-Za-z0-9_]*[./][A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateGRPCConfig checks that a ghz configuration is consistent; prefix is the path of the configuration
+func validateGRPCConfig(prefix string, c runner.Config) error {
+	errs := []error{}
+	if c.Call == "" {
+		errs = append(errs, newFieldError(prefix+".call", "call is required"))
+	} else if !grpcCallRegexp.MatchString(c.Call) {
+		errs = append(errs, newFieldError(prefix+".call", "invalid call %q; expected a fully qualified method name (example, helloworld.Greeter.SayHello)", c.Call))
+	}
+	if c.Host == "" {
+		errs = append(errs, newFieldError(prefix+".host", "host is required"))
+	}
+	if c.Proto != "" && c.Protoset != "" {
+		errs = append(errs, newFieldError(prefix, "specify at most one of proto and protoset"))
+	}
+	numData := 0
+	for _, d := range []bool{c.Data != nil, c.DataPath != "", c.BinDataPath != ""} {
+		if d {
+			numData++
+		}
+	}
+	if numData > 1 {
+		errs = append(errs, newFieldError(prefix, "specify at most one of data, data-file and binary-file"))
+	}
+	if c.Connections > c.C {
+		errs = append(errs, newFieldError(prefix+".connections", "connections %v is greater than concurrency %v", c.Connections, c.C))
+	}
+	if c.Z == 0 && c.SkipFirst > c.N {
+		errs = append(errs, newFieldError(prefix+".skipFirst", "skipFirst %v is greater than total %v", c.SkipFirst, c.N))
+	}
+	if c.BinDataPath != "" && c.StreamDynamicMessages {
+		errs = append(errs, newFieldError(prefix+".stream-dynamic-messages", "cannot use dynamic messages with binary data"))
+	}
+	errs = append(errs, validateGRPCSchedule(prefix, "load", c.LoadSchedule, c.LoadStart, c.LoadEnd, c.LoadStep, c.LoadStepDuration))
+	errs = append(errs, validateGRPCSchedule(prefix, "concurrency", c.CSchedule, c.CStart, c.CEnd, c.CStep, c.CStepDuration))
+	return errors.Join(errs...)
+}
+
+// setCPUs sets GOMAXPROCS to cpus, if positive, and returns a function that restores it
+func setCPUs(cpus uint) func() {
+	if cpus == 0 {
+		return func() {}
+	}
+	oldCPUs := runtime.GOMAXPROCS(int(cpus))
+	return func() { runtime.GOMAXPROCS(oldCPUs) }
+}
+
+// maxCPUs returns the largest number of CPUs used by the given configurations
+func maxCPUs(configs map[string]*runner.Config) uint {
+	cpus := uint(0)
+	for _, cfg := range configs {
+		cpus = max(cpus, cfg.CPUs)
+	}
+	return cpus
+}
+
+// runGHZ runs a ghz gRPC test, which is stopped when ctx is done; options are applied after those of cfg
+// This is like runner.Run, except that the test is stopped by ctx instead of by an interrupt signal,
+// and GOMAXPROCS is left to the caller (see setCPUs), since endpoints may be tested concurrently
+func runGHZ(ctx context.Context, call string, host string, cfg *runner.Config, options ...runner.Option) (*runner.Report, error) {
+	c, err := runner.NewConfig(call, host, append([]runner.Option{runner.WithConfig(cfg)}, options...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	reqr, err := runner.NewRequester(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// the requester closes its stop channel when the test ends, so it is only stopped while the test is in progress
+	var mu sync.Mutex
+	finished := false
+	stop := func(reason runner.StopReason) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !finished {
+			reqr.Stop(reason)
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		var timeout <-chan time.Time
+		if cfg.Z > 0 {
+			timer := time.NewTimer(time.Duration(cfg.Z))
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Logger.Debug("stopping ghz gRPC test")
+			stop(runner.ReasonCancel)
+		case <-timeout:
+			stop(runner.ReasonTimeout)
+		case <-done:
+		}
+	}()
+
+	report, err := reqr.Run()
+	mu.Lock()
+	finished = true
+	mu.Unlock()
+	return report, err
 }
 
 // resultForVersion collects gRPC test result for a given version
-func (t *collectGRPCTask) resultForVersion() (GHZResult, error) {
+// The errors of endpoints that could not be tested are also returned, keyed by endpoint
+// Endpoints that have not been tested when ctx is done are skipped
+func (t *collectGRPCTask) resultForVersion(ctx context.Context) (GHZResult, map[string]string, error) {
 	// the main idea is to run ghz with proper options
 
-	var err error
 	results := GHZResult{}
+	endpointErrors := map[string]string{}
 
 	if len(t.With.Endpoints) > 0 {
 		log.Logger.Trace("multiple endpoints")
-		for endpointID, endpoint := range t.With.Endpoints {
-			endpoint := endpoint // prevent implicit memory aliasing
-			log.Logger.Trace(fmt.Sprintf("endpoint: %s", endpointID))
+		ids := sortedEndpointIDs(t.With.Endpoints)
+		configs := map[string]*runner.Config{}
+		credentials := map[string][]runner.Option{}
+		for _, endpointID := range ids {
+			endpoint := t.With.Endpoints[endpointID]
+			ownTLS := usesTLS(endpoint.Config)
 
 			// default from baseline
-			call := t.With.Call
-			if endpoint.Call != "" {
-				call = endpoint.Call
+			if endpoint.Call == "" {
+				endpoint.Call = t.With.Call
 			}
-
-			host := t.With.Host
-			if endpoint.Host != "" {
-				host = endpoint.Host
+			if endpoint.Host == "" {
+				endpoint.Host = t.With.Host
 			}
 
 			// merge endpoint options with baseline options
-			if err := mergo.Merge(&endpoint, t.With.Config); err != nil {
+			if err := mergo.Merge(&endpoint.Config, t.With.Config); err != nil {
 				log.Logger.Error(fmt.Sprintf("could not merge ghz options for endpoint \"%s\"", endpointID))
-				return nil, err
+				return nil, nil, err
 			}
-			eOpts := runner.WithConfig(&endpoint) // endpoint options
 
-			log.Logger.Trace("run ghz gRPC test")
-			igr, err := runner.Run(call, host, eOpts)
+			// endpoints inherit the credentials of the task if they do not specify their own
+			tc, oc := endpoint.TLS, endpoint.OAuth2
+			if tc == nil && !ownTLS {
+				tc = t.With.TLS
+			}
+			if oc == nil {
+				oc = t.With.OAuth2
+			}
+			if ownTLS {
+				endpoint.Insecure = false
+			}
+			setGRPCTLS(&endpoint.Config, tc)
+			options, err := getGRPCCredentialOptions(ctx, &endpoint.Config, oc)
 			if err != nil {
-				log.Logger.WithStackTrace(err.Error()).Error(err)
+				log.Logger.WithStackTrace(err.Error()).Error(fmt.Sprintf("could not get credentials for endpoint \"%s\"", endpointID))
+				endpointErrors[endpointID] = err.Error()
 				continue
 			}
 
-			results[endpointID] = igr
+			configs[endpointID] = &endpoint.Config
+			credentials[endpointID] = options
+		}
+
+		// divide a shared rps budget evenly among the endpoints that can be tested; each endpoint is sent at least one request per second
+		if stringValue(t.With.RPSBudget) == BudgetShared && t.With.RPS > 0 && len(configs) > 0 {
+			rps := max(t.With.RPS/uint(len(configs)), 1)
+			for _, cfg := range configs {
+				cfg.RPS = rps
+			}
 		}
+
+		// GOMAXPROCS is process-wide, so it is set once for all endpoints
+		defer setCPUs(maxCPUs(configs))()
+
+		var mu sync.Mutex
+		runEndpoints(ctx, stringValue(t.With.Mode), ids, func(endpointID string) {
+			cfg := configs[endpointID]
+			if cfg == nil {
+				return
+			}
+			log.Logger.Trace("run ghz gRPC test")
+			igr, err := runGHZ(ctx, cfg.Call, cfg.Host, cfg, credentials[endpointID]...)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Logger.WithStackTrace(err.Error()).Error(fmt.Sprintf("ghz failed for endpoint \"%s\"", endpointID))
+				endpointErrors[endpointID] = err.Error()
+				return
+			}
+			results[endpointID] = igr
+		})
 	} else {
-		// TODO: supply all the allowed options
-		opts := runner.WithConfig(&t.With.Config)
+		options, err := getGRPCCredentialOptions(ctx, &t.With.Config, t.With.OAuth2)
+		if err != nil {
+			return results, nil, err
+		}
+
+		defer setCPUs(t.With.CPUs)()
 
 		log.Logger.Trace("run ghz gRPC test")
-		igr, err := runner.Run(t.With.Call, t.With.Host, opts)
+		igr, err := runGHZ(ctx, t.With.Call, t.With.Host, &t.With.Config, options...)
 		if err != nil {
 			log.Logger.WithStackTrace(err.Error()).Error(err)
-			return results, err
+			return results, nil, err
 		}
 
 		results[t.With.Call] = igr
 	}
 
-	return results, err
+	return results, endpointErrors, nil
+}
+
+// endpointVersions returns the version of each endpoint, keyed like the results of this task
+// Endpoints inherit the version and track of the task if they do not specify their own
+func (t *collectGRPCTask) endpointVersions() map[string]VersionInfo {
+	base := VersionInfo{Version: t.With.Version, Track: t.With.Track}
+	if len(t.With.Endpoints) == 0 {
+		return map[string]VersionInfo{t.With.Call: base}
+	}
+	versions := map[string]VersionInfo{}
+	for endpointID, e := range t.With.Endpoints {
+		versions[endpointID] = inheritVersion(VersionInfo{Version: e.Version, Track: e.Track}, base)
+	}
+	return versions
 }
 
 // Run executes this task
-func (t *collectGRPCTask) run(exp *Experiment) error {
+// If ctx is done before the test completes, the partial results are recorded and an error is returned
+func (t *collectGRPCTask) Run(ctx context.Context, exp *Experiment) error {
 	// 1. initialize defaults
 	var err error
 
-	err = t.validateInputs()
+	err = t.ValidateInputs()
 	if err != nil {
 		return err
 	}
 
-	t.initializeDefaults()
+	t.InitializeDefaults()
 
 	// 2. collect raw results from ghz
 
 	// run ghz test
 	// collect ghz report
 	// ghz reports will be further processed to populate metrics
-	data, err := t.resultForVersion()
+	data, endpointErrors, err := t.resultForVersion(ctx)
 	if err != nil {
 		return err
 	}
 
+	// failed endpoints fail this task if so configured, or if no endpoint could be tested
+	var failure error
+	if *t.With.FailOnEndpointError || len(data) == 0 {
+		failure = failedEndpointsError(endpointErrors)
+	}
+
 	// ignore results if warmup
 	if t.With.Warmup != nil && *t.With.Warmup {
 		log.Logger.Debug("warmup: ignoring results")
-		return nil
+		return errors.Join(failure, ctx.Err())
 	}
 
-	// 3. init insights with num versions: always 1 in this task
-	if err = exp.Result.initInsightsWithNumVersions(1); err != nil {
-		return err
-	}
+	// 3. init insights; the versions of the app are those of the endpoints
+	exp.Result.setEndpointVersions(CollectGRPCTaskName, t.endpointVersions())
 
 	// 4. write data to Insights
 	exp.Result.Insights.TaskData[CollectGRPCTaskName] = data
+	exp.Result.setEndpointErrors(CollectGRPCTaskName, endpointErrors)
+
+	// 5. publish metrics as outputs
+	metrics := map[string]map[string]float64{}
+	for endpoint, r := range data {
+		metrics[endpoint] = getGRPCMetrics(r)
+	}
+	exp.setMetricsOutputs(t.TaskMeta, grpcMetricPrefix, metrics)
 
-	return nil
+	return errors.Join(failure, ctx.Err())
 }
@@ -1,10 +1,12 @@
 package base
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bojand/ghz/runner"
 	"github.com/iter8-tools/iter8/base/internal"
@@ -64,7 +66,7 @@ func TestRunCollectGRPCUnary(t *testing.T) {
 		},
 	}
 	exp.initResults(1)
-	err = ct.run(exp)
+	err = ct.Run(context.Background(), exp)
 
 	log.Logger.Debug("dial timeout after defaulting... ", ct.With.DialTimeout.String())
 
@@ -111,7 +113,7 @@ func TestRunCollectGRPCUnaryNoEndpoint(t *testing.T) {
 		Result: &ExperimentResult{},
 	}
 	exp.initResults(1)
-	err := ct.run(exp)
+	err := ct.Run(context.Background(), exp)
 
 	// Error should be a connection error, not a nil pointer dereference error
 	// Test written like this because of conversion between localhost and 127.0.0.1
@@ -143,23 +145,23 @@ func TestRunCollectGRPCMultipleEndpoints(t *testing.T) {
 			Config: runner.Config{
 				Host: internal.LocalHostPort,
 			},
-			Endpoints: map[string]runner.Config{
-				unary: {
+			Endpoints: map[string]grpcEndpoint{
+				unary: {Config: runner.Config{
 					Data: map[string]interface{}{"name": "bob"},
 					Call: "helloworld.Greeter.SayHello",
-				},
-				server: {
+				}},
+				server: {Config: runner.Config{
 					Data: map[string]interface{}{"name": "bob"},
 					Call: "helloworld.Greeter.SayHelloCS",
-				},
-				client: {
+				}},
+				client: {Config: runner.Config{
 					Data: map[string]interface{}{"name": "bob"},
 					Call: "helloworld.Greeter.SayHellos",
-				},
-				bidirectional: {
+				}},
+				bidirectional: {Config: runner.Config{
 					Data: map[string]interface{}{"name": "bob"},
 					Call: "helloworld.Greeter.SayHelloBidi",
-				},
+				}},
 			},
 		},
 	}
@@ -175,7 +177,7 @@ func TestRunCollectGRPCMultipleEndpoints(t *testing.T) {
 		},
 	}
 	exp.initResults(1)
-	err = ct.run(exp)
+	err = ct.Run(context.Background(), exp)
 
 	log.Logger.Debug("dial timeout after defaulting... ", ct.With.DialTimeout.String())
 
@@ -201,10 +203,95 @@ func TestRunCollectGRPCMultipleEndpoints(t *testing.T) {
 	assert.NotNil(t, ghzResult[bidirectional])
 }
 
+func TestRunCollectGRPCConcurrentEndpoints(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	callType := helloworld.Unary
+	gs, s, err := internal.StartServer(false)
+	if err != nil {
+		assert.FailNow(t, err.Error())
+	}
+	t.Cleanup(s.Stop)
+
+	ct := &collectGRPCTask{
+		TaskMeta: TaskMeta{
+			Task: StringPointer(CollectGRPCTaskName),
+		},
+		With: collectGRPCInputs{
+			Config: runner.Config{
+				Data: map[string]interface{}{"name": "bob"},
+				Call: "helloworld.Greeter.SayHello",
+				Host: internal.LocalHostPort,
+				N:    10,
+				C:    1,
+				RPS:  40,
+			},
+			Mode:      StringPointer(EndpointModeConcurrent),
+			RPSBudget: StringPointer(BudgetShared),
+			Endpoints: map[string]grpcEndpoint{
+				unary:  {},
+				unary2: {},
+			},
+		},
+	}
+
+	exp := &Experiment{
+		Spec:   []Task{ct},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+	err = ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, gs.GetCount(callType))
+
+	ghzResult, ok := exp.Result.Insights.TaskData[CollectGRPCTaskName].(GHZResult)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(ghzResult))
+	for _, id := range []string{unary, unary2} {
+		// the shared budget is divided evenly among endpoints
+		assert.Equal(t, 20, ghzResult[id].Options.RPS)
+		assert.Equal(t, uint64(10), ghzResult[id].Count)
+	}
+
+	// the endpoints are tested at the same time
+	r1, r2 := ghzResult[unary], ghzResult[unary2]
+	assert.True(t, r1.Date.Before(r2.Date.Add(r2.Total)) && r2.Date.Before(r1.Date.Add(r1.Total)))
+}
+
+func TestValidateCollectGRPCMode(t *testing.T) {
+	ct := &collectGRPCTask{
+		With: collectGRPCInputs{
+			Config: runner.Config{
+				Call: "helloworld.Greeter.SayHello",
+				Host: internal.LocalHostPort,
+			},
+			RPSBudget: StringPointer("unlimited"),
+		},
+	}
+	assert.ErrorContains(t, ct.ValidateInputs(), `with.rpsBudget: invalid budget "unlimited"`)
+
+	ct.With.Mode = StringPointer(EndpointModeConcurrent)
+	ct.With.RPSBudget = StringPointer(BudgetShared)
+	ct.With.Endpoints = map[string]grpcEndpoint{
+		unary:  {Config: runner.Config{RPS: 10}},
+		unary2: {},
+	}
+	assert.ErrorContains(t, ct.ValidateInputs(), "with.endpoints.unary.rps: cannot be set when the rps budget is shared")
+
+	delete(ct.With.Endpoints, unary)
+	assert.NoError(t, ct.ValidateInputs())
+
+	// endpoints are tested one after another with their own rps, and may fail without failing the task, by default
+	ct.With.Mode, ct.With.RPSBudget = nil, nil
+	ct.InitializeDefaults()
+	assert.False(t, *ct.With.FailOnEndpointError)
+	assert.Equal(t, EndpointModeSequential, stringValue(ct.With.Mode))
+	assert.Equal(t, BudgetPerEndpoint, stringValue(ct.With.RPSBudget))
+}
+
 // TODO: should this still return insights even though the endpoints cannot be reached?
 // This would mean no Grafana dashboard would be produced
 //
-// If the endpoints cannot be reached, then do not throw an error
+// If none of the endpoints can be reached, then the task fails, even if failOnEndpointError is not set
 // Should not return an nil pointer dereference error (see #1451)
 func TestRunCollectGRPCMultipleNoEndpoints(t *testing.T) {
 	// define METRICS_SERVER_URL
@@ -226,23 +313,23 @@ func TestRunCollectGRPCMultipleNoEndpoints(t *testing.T) {
 			Config: runner.Config{
 				Host: internal.LocalHostPort,
 			},
-			Endpoints: map[string]runner.Config{
-				unary: {
+			Endpoints: map[string]grpcEndpoint{
+				unary: {Config: runner.Config{
 					Data: map[string]interface{}{"name": "bob"},
 					Call: unaryCall,
-				},
-				server: {
+				}},
+				server: {Config: runner.Config{
 					Data: map[string]interface{}{"name": "bob"},
 					Call: serverCall,
-				},
-				client: {
+				}},
+				client: {Config: runner.Config{
 					Data: map[string]interface{}{"name": "bob"},
 					Call: clientCall,
-				},
-				bidirectional: {
+				}},
+				bidirectional: {Config: runner.Config{
 					Data: map[string]interface{}{"name": "bob"},
 					Call: bidirectionalCall,
-				},
+				}},
 			},
 		},
 	}
@@ -258,8 +345,8 @@ func TestRunCollectGRPCMultipleNoEndpoints(t *testing.T) {
 		},
 	}
 	exp.initResults(1)
-	err = ct.run(exp)
-	assert.NoError(t, err)
+	err = ct.Run(context.Background(), exp)
+	assert.EqualError(t, err, "unable to test endpoints: bidirectional, client, server, unary")
 
 	taskData := exp.Result.Insights.TaskData[CollectGRPCTaskName]
 	assert.NotNil(t, taskData)
@@ -271,6 +358,16 @@ func TestRunCollectGRPCMultipleNoEndpoints(t *testing.T) {
 	assert.NoError(t, err)
 
 	assert.Equal(t, 0, len(ghzResult))
+
+	// the endpoints are recorded with their errors
+	assert.Equal(t, []string{bidirectional, client, server, unary}, sortedEndpointIDs(exp.Result.Insights.EndpointErrors[CollectGRPCTaskName]))
+
+	// failed endpoints fail the task if so configured
+	ct.With.FailOnEndpointError = BoolPointer(true)
+	exp.initResults(1)
+	err = ct.Run(context.Background(), exp)
+	assert.EqualError(t, err, "unable to test endpoints: bidirectional, client, server, unary")
+	assert.Equal(t, 4, len(exp.Result.Insights.EndpointErrors[CollectGRPCTaskName]))
 }
 
 func TestRunCollectGRPCSingleEndpointMultipleCalls(t *testing.T) {
@@ -297,13 +394,13 @@ func TestRunCollectGRPCSingleEndpointMultipleCalls(t *testing.T) {
 				Host: internal.LocalHostPort,
 				Call: "helloworld.Greeter.SayHello",
 			},
-			Endpoints: map[string]runner.Config{
-				unary: {
+			Endpoints: map[string]grpcEndpoint{
+				unary: {Config: runner.Config{
 					Data: map[string]interface{}{"name": "bob"},
-				},
-				unary2: {
+				}},
+				unary2: {Config: runner.Config{
 					Data: map[string]interface{}{"name": "charles"},
-				},
+				}},
 			},
 		},
 	}
@@ -319,7 +416,7 @@ func TestRunCollectGRPCSingleEndpointMultipleCalls(t *testing.T) {
 		},
 	}
 	exp.initResults(1)
-	err = ct.run(exp)
+	err = ct.Run(context.Background(), exp)
 
 	log.Logger.Debug("dial timeout after defaulting... ", ct.With.DialTimeout.String())
 
@@ -386,7 +483,7 @@ func TestRunCollectGRPCWithWarmup(t *testing.T) {
 		},
 	}
 	exp.initResults(1)
-	err = ct.run(exp)
+	err = ct.Run(context.Background(), exp)
 
 	log.Logger.Debug("dial timeout after defaulting... ", ct.With.DialTimeout.String())
 
@@ -401,14 +498,7 @@ func TestRunCollectGRPCWithWarmup(t *testing.T) {
 
 // Credit: Several of the tests in this file are based on
 // https://github.com/bojand/ghz/blob/master/runner/run_test.go
-func TestRunCollectGRPCWithIncorrectNumVersions(t *testing.T) {
-	// define METRICS_SERVER_URL
-	metricsServerURL := "http://iter8.default:8080"
-	err := os.Setenv(MetricsServerURL, metricsServerURL)
-	assert.NoError(t, err)
-
-	call := "helloworld.Greeter.SayHello"
-
+func TestRunCollectGRPCWithVersions(t *testing.T) {
 	_ = os.Chdir(t.TempDir())
 	callType := helloworld.Unary
 	gs, s, err := internal.StartServer(false)
@@ -417,7 +507,7 @@ func TestRunCollectGRPCWithIncorrectNumVersions(t *testing.T) {
 	}
 	t.Cleanup(s.Stop)
 
-	// valid collect GRPC task... should succeed
+	// endpoints inherit the version of the task unless they specify their own
 	ct := &collectGRPCTask{
 		TaskMeta: TaskMeta{
 			Task: StringPointer(CollectGRPCTaskName),
@@ -425,38 +515,81 @@ func TestRunCollectGRPCWithIncorrectNumVersions(t *testing.T) {
 		With: collectGRPCInputs{
 			Config: runner.Config{
 				Data: map[string]interface{}{"name": "bob"},
-				Call: call,
+				Call: "helloworld.Greeter.SayHello",
 				Host: internal.LocalHostPort,
+				N:    10,
+			},
+			Track: "stable",
+			Endpoints: map[string]grpcEndpoint{
+				"stable": {},
+				"candidate": {
+					Track: "candidate",
+				},
 			},
 		},
 	}
 
-	log.Logger.Debug("dial timeout before defaulting... ", ct.With.DialTimeout.String())
-
 	exp := &Experiment{
 		Spec:   []Task{ct},
 		Result: &ExperimentResult{},
-		Metadata: ExperimentMetadata{
-			Name:      myName,
-			Namespace: myNamespace,
-		},
 	}
 	exp.initResults(1)
 
-	exp.Result.Insights = &Insights{
-		NumVersions: 2, // will cause grpc task to fail; grpc task expects insights been nil or numVersions set to 1
-	}
+	err = ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, gs.GetCount(callType))
 
-	err = ct.run(exp)
+	in := exp.Result.Insights
+	assert.Equal(t, 2, in.NumVersions)
+	assert.Equal(t, []VersionInfo{{Track: "stable"}, {Track: "candidate"}}, in.VersionNames)
+	assert.Equal(t, "stable", in.EndpointVersionStr(CollectGRPCTaskName, "stable"))
+	assert.Equal(t, "candidate", in.EndpointVersionStr(CollectGRPCTaskName, "candidate"))
 
-	log.Logger.Debug("dial timeout after defaulting... ", ct.With.DialTimeout.String())
+	ghzResult, ok := in.TaskData[CollectGRPCTaskName].(GHZResult)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(ghzResult))
+}
+
+func TestRunGHZStopped(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	_, s, err := internal.StartServer(false)
+	if err != nil {
+		assert.FailNow(t, err.Error())
+	}
+	t.Cleanup(s.Stop)
 
-	// fail because of initInsightsWithNumVersions()
-	assert.Error(t, err)
+	call := "helloworld.Greeter.SayHello"
+	cfg := &runner.Config{
+		Data:        map[string]interface{}{"name": "bob"},
+		Insecure:    true,
+		C:           1,
+		Connections: 1,
+		DialTimeout: runner.Duration(10 * time.Second),
+		Timeout:     runner.Duration(10 * time.Second),
+	}
 
-	count := gs.GetCount(callType)
-	assert.Equal(t, 200, count)
+	// a test is stopped when ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	report, err := runGHZ(ctx, call, internal.LocalHostPort, cfg, runner.WithTotalRequests(1000000), runner.WithRPS(10))
+	assert.NoError(t, err)
+	assert.Equal(t, runner.ReasonCancel, report.EndReason)
+	assert.Less(t, report.Count, uint64(1000000))
 
-	// error ensures that ghz results are not written to insights
-	assert.Nil(t, exp.Result.Insights.TaskData)
+	// a test that ends as ctx is done is not stopped once it has ended
+	start := time.Now()
+	_, err = runGHZ(context.Background(), call, internal.LocalHostPort, cfg, runner.WithTotalRequests(1))
+	assert.NoError(t, err)
+	d := time.Since(start)
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := d/2 + time.Duration(i)*d/10
+		go func() {
+			time.Sleep(wait)
+			cancel()
+		}()
+		_, err = runGHZ(ctx, call, internal.LocalHostPort, cfg, runner.WithTotalRequests(1))
+		assert.NoError(t, err)
+		cancel()
+	}
 }
@@ -1,10 +1,13 @@
 package base
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"dario.cat/mergo"
@@ -35,6 +38,8 @@ type endpoint struct {
 	PayloadStr *string `json:"payloadStr,omitempty" yaml:"payloadStr,omitempty"`
 	// PayloadFile is payload file. If this field is specified, Iter8 will send HTTP POST requests to the app using data in this file. If both `payloadStr` and `payloadFile` are specified, the former is ignored.
 	PayloadFile *string `json:"payloadFile,omitempty" yaml:"payloadFile,omitempty"`
+	// PayloadData is a dataset of payloads that are replayed, one payload per request. If this field is specified, Iter8 will send HTTP POST requests to the app; `payloadStr` and `payloadFile` cannot be specified.
+	PayloadData *payloadData `json:"payloadData,omitempty" yaml:"payloadData,omitempty"`
 	// ContentType is the type of the payload. Indicated using the Content-Type HTTP header value. This is intended to be used in conjunction with one of the `payload*` fields above. If this field is specified, Iter8 will send HTTP POST requests to the app using this content type header value.
 	ContentType *string `json:"contentType,omitempty" yaml:"contentType,omitempty"`
 	// ErrorRanges is a list of errorRange values. Each range specifies an upper and/or lower limit on HTTP status codes. HTTP responses that fall within these error ranges are considered error. Default value is {{lower: 400},} - i.e., HTTP status codes >= 400 are considered as error.
@@ -47,6 +52,22 @@ type endpoint struct {
 	URL string `json:"url" yaml:"url"`
 	// AllowInitialErrors allows and doesn't abort on initial warmup errors
 	AllowInitialErrors *bool `json:"allowInitialErrors,omitempty" yaml:"allowInitialErrors,omitempty"`
+	// Version is the name of the app version served by this endpoint; optional
+	// Endpoints with the same version and track are considered to belong to the same version
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Track is the track of the app version served by this endpoint (example, stable or candidate); optional
+	Track string `json:"track,omitempty" yaml:"track,omitempty"`
+	// Stages is the load profile of this endpoint; optional. Stages are run in order, and override qps, duration and numRequests.
+	// Results are reported for each stage, and aggregated over all stages. allowInitialErrors applies to the first stage only, so that later stages measure the errors of the app;
+	// if a stage cannot be run, the results of the stages before it are kept.
+	Stages []stage `json:"stages,omitempty" yaml:"stages,omitempty"`
+	// ResponseChecks are checks of successful responses; optional. Responses that fail any check are counted as errors, with status code -2.
+	// Endpoints with checks are tested with the standard HTTP client of Fortio, which is slower than its fast client.
+	ResponseChecks *responseChecks `json:"responseChecks,omitempty" yaml:"responseChecks,omitempty"`
+	// TLS contains the TLS options used to connect to the app over https; optional
+	TLS *tlsConfig `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// OAuth2 contains the client credentials used to authorize requests with bearer tokens; optional
+	OAuth2 *oauth2Config `json:"oauth2,omitempty" yaml:"oauth2,omitempty"`
 }
 
 // collectHTTPInputs contain the inputs to the metrics collection task to be executed.
@@ -56,6 +77,18 @@ type collectHTTPInputs struct {
 	// Warmup indicates if task execution is for warmup purposes; if so the results will be ignored
 	Warmup *bool `json:"warmup,omitempty" yaml:"warmup,omitempty"`
 
+	// FailOnEndpointError determines if this task fails when one of multiple endpoints cannot be tested. Default value is false.
+	// This task always fails when none of its endpoints can be tested.
+	// Either way, the endpoints that cannot be tested are recorded in the results together with their errors.
+	FailOnEndpointError *bool `json:"failOnEndpointError,omitempty" yaml:"failOnEndpointError,omitempty"`
+
+	// Mode determines how multiple endpoints are tested. Valid values are sequential and concurrent. Default value is sequential.
+	// In concurrent mode, all endpoints are tested at the same time; results are still reported per endpoint.
+	Mode *string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// QPSBudget determines how the QPS of this task applies to multiple endpoints. Valid values are per-endpoint and shared. Default value is per-endpoint.
+	// A shared budget requires concurrent mode; the QPS of this task is then divided evenly among the endpoints, which cannot set their own QPS or stages.
+	QPSBudget *string `json:"qpsBudget,omitempty" yaml:"qpsBudget,omitempty"`
+
 	// Endpoints is used to define multiple endpoints to test
 	Endpoints map[string]endpoint `json:"endpoints" yaml:"endpoints"`
 }
@@ -63,7 +96,22 @@ type collectHTTPInputs struct {
 // HTTPResult is the raw data sent to the metrics server
 // This data will be transformed into httpDashboard when getHTTPGrafana is called
 // Key is the endpoint
-type HTTPResult map[string]*fhttp.HTTPRunnerResults
+type HTTPResult map[string]*HTTPEndpointResult
+
+// HTTPEndpointResult is the raw data of an endpoint
+type HTTPEndpointResult struct {
+	*fhttp.HTTPRunnerResults
+	// ResponseCheckFailures is the number of responses that failed each response check
+	ResponseCheckFailures map[string]int64 `json:"ResponseCheckFailures,omitempty"`
+}
+
+// newHTTPEndpointResult returns the raw data of an endpoint; check failures are omitted if there are none
+func newHTTPEndpointResult(r *fhttp.HTTPRunnerResults, failures map[string]int64) *HTTPEndpointResult {
+	if len(failures) == 0 {
+		failures = nil
+	}
+	return &HTTPEndpointResult{HTTPRunnerResults: r, ResponseCheckFailures: failures}
+}
 
 const (
 	// CollectHTTPTaskName is the name of this task which performs load generation and metrics collection.
@@ -91,8 +139,8 @@ type collectHTTPTask struct {
 	With collectHTTPInputs `json:"with" yaml:"with"`
 }
 
-// initializeDefaults sets default values for the collect task
-func (t *collectHTTPTask) initializeDefaults() {
+// InitializeDefaults sets default values for the collect task
+func (t *collectHTTPTask) InitializeDefaults() {
 	if t.With.NumRequests == nil && t.With.Duration == nil {
 		t.With.NumRequests = int64Pointer(defaultHTTPNumRequests)
 	}
@@ -118,15 +166,98 @@ func (t *collectHTTPTask) initializeDefaults() {
 	if t.With.AllowInitialErrors == nil {
 		t.With.AllowInitialErrors = BoolPointer(false)
 	}
+	if t.With.FailOnEndpointError == nil {
+		t.With.FailOnEndpointError = BoolPointer(false)
+	}
+	if t.With.Mode == nil {
+		t.With.Mode = StringPointer(EndpointModeSequential)
+	}
+	if t.With.QPSBudget == nil {
+		t.With.QPSBudget = StringPointer(BudgetPerEndpoint)
+	}
 }
 
-// validateInputs for this task
-func (t *collectHTTPTask) validateInputs() error {
-	return nil
+// ValidateInputs for this task
+func (t *collectHTTPTask) ValidateInputs() error {
+	if len(t.With.Endpoints) == 0 {
+		return errors.Join(validateEndpoint("with", t.With.endpoint, true), validateEndpointMode(stringValue(t.With.Mode), stringValue(t.With.QPSBudget), "qps", nil, nil))
+	}
+
+	// endpoints inherit unspecified inputs, including the URL, from the task
+	errs := []error{validateEndpoint("with", t.With.endpoint, false)}
+	endpointRates := []string{}
+	// load profiles ignore the QPS of the task, and are inherited by endpoints
+	stages := []string{}
+	if len(t.With.Stages) > 0 {
+		stages = append(stages, "with.stages")
+	}
+	for _, id := range sortedEndpointIDs(t.With.Endpoints) {
+		errs = append(errs, validateEndpoint("with.endpoints."+id, t.With.Endpoints[id], t.With.URL == ""))
+		if t.With.Endpoints[id].QPS != nil {
+			endpointRates = append(endpointRates, id)
+		}
+		if len(t.With.Endpoints[id].Stages) > 0 {
+			stages = append(stages, "with.endpoints."+id+".stages")
+		}
+	}
+	errs = append(errs, validateEndpointMode(stringValue(t.With.Mode), stringValue(t.With.QPSBudget), "qps", endpointRates, stages))
+	return errors.Join(errs...)
+}
+
+// validateEndpoint validates the inputs of an endpoint; prefix is the path of the endpoint
+func validateEndpoint(prefix string, e endpoint, requireURL bool) error {
+	errs := []error{}
+	if requireURL || e.URL != "" {
+		errs = append(errs, validateURL(prefix+".url", e.URL))
+	}
+	if e.NumRequests != nil && *e.NumRequests <= 0 {
+		errs = append(errs, newFieldError(prefix+".numRequests", "must be positive"))
+	}
+	errs = append(errs, validateDuration(prefix+".duration", e.Duration))
+	if e.QPS != nil && *e.QPS < 0 {
+		errs = append(errs, newFieldError(prefix+".qps", "must not be negative"))
+	}
+	if e.Connections != nil && *e.Connections <= 0 {
+		errs = append(errs, newFieldError(prefix+".connections", "must be positive"))
+	}
+	for i, r := range e.ErrorRanges {
+		field := fmt.Sprintf("%v.errorRanges[%d]", prefix, i)
+		switch {
+		case r.Lower == nil && r.Upper == nil:
+			errs = append(errs, newFieldError(field, "at least one of lower and upper is required"))
+		case r.Lower != nil && r.Upper != nil && *r.Lower > *r.Upper:
+			errs = append(errs, newFieldError(field, "lower %v is greater than upper %v", *r.Lower, *r.Upper))
+		}
+		for _, limit := range []*int{r.Lower, r.Upper} {
+			if limit != nil && (*limit < 100 || *limit > 599) {
+				errs = append(errs, newFieldError(field, "%v is not an HTTP status code", *limit))
+			}
+		}
+	}
+	for i, p := range e.Percentiles {
+		if p <= 0 || p > 100 {
+			errs = append(errs, newFieldError(fmt.Sprintf("%v.percentiles[%d]", prefix, i), "%v is not in the range (0, 100]", p))
+		}
+	}
+	for key := range e.Headers {
+		if strings.TrimSpace(key) == "" {
+			errs = append(errs, newFieldError(prefix+".headers", "header name cannot be empty"))
+		}
+	}
+	if e.PayloadData != nil && (e.PayloadStr != nil || e.PayloadFile != nil) {
+		errs = append(errs, newFieldError(prefix+".payloadData", "cannot be specified together with payloadStr or payloadFile"))
+	}
+	errs = append(errs, validatePayloadData(prefix+".payloadData", e.PayloadData))
+	errs = append(errs, validateStages(prefix, e.Stages))
+	errs = append(errs, validateResponseChecks(prefix+".responseChecks", e.ResponseChecks))
+	errs = append(errs, validateTLSConfig(prefix+".tls", e.TLS))
+	errs = append(errs, validateOAuth2Config(prefix+".oauth2", e.OAuth2))
+	return errors.Join(errs...)
 }
 
 // getFortioOptions constructs Fortio's HTTP runner options based on collect task inputs
-func getFortioOptions(c endpoint) (*fhttp.HTTPRunnerOptions, error) {
+// OAuth2 tokens are fetched with ctx
+func getFortioOptions(ctx context.Context, c endpoint) (*fhttp.HTTPRunnerOptions, error) {
 	if c.QPS == nil {
 		return nil, errors.New("no value for QPS")
 	}
@@ -172,6 +303,11 @@ func getFortioOptions(c endpoint) (*fhttp.HTTPRunnerOptions, error) {
 		}
 	}
 
+	// credentials
+	if err = setFortioCredentials(ctx, fo, c.TLS, c.OAuth2); err != nil {
+		return nil, err
+	}
+
 	// content type & payload
 	if c.ContentType != nil {
 		fo.ContentType = *c.ContentType
@@ -186,6 +322,18 @@ func getFortioOptions(c endpoint) (*fhttp.HTTPRunnerOptions, error) {
 		}
 		fo.Payload = b
 	}
+	if c.PayloadData != nil {
+		ps, err := c.PayloadData.getSource()
+		if err != nil {
+			return nil, err
+		}
+		// payloads are replaced for each request by a transport
+		addTransport(fo, ps.transport)
+		fo.Payload = ps.payloads[0].body
+		if c.ContentType == nil && ps.payloads[0].fields != nil {
+			fo.ContentType = "application/json"
+		}
+	}
 
 	// headers
 	for key, value := range c.Headers {
@@ -198,98 +346,199 @@ func getFortioOptions(c endpoint) (*fhttp.HTTPRunnerOptions, error) {
 	return fo, nil
 }
 
+// runFortio runs a Fortio HTTP test, which is aborted when ctx is done
+// The results of an aborted test are those of the requests sent before it was aborted
+func runFortio(ctx context.Context, fo *fhttp.HTTPRunnerOptions) (*fhttp.HTTPRunnerResults, error) {
+	// Fortio resets fo.Stop when the test starts, so keep a reference to the aborter
+	aborter := periodic.NewAborter()
+	fo.Stop = aborter
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.Logger.Debug("aborting fortio HTTP test")
+			aborter.Abort(false)
+		case <-done:
+		}
+	}()
+
+	return fhttp.RunHTTPTest(fo)
+}
+
+// runHTTPEndpoint tests an endpoint with the given Fortio options, or with its load profile if it has stages
+// The results of the stages, if any, are also returned; a load profile that fails returns the results of the stages run before it failed
+func runHTTPEndpoint(ctx context.Context, e endpoint, fo *fhttp.HTTPRunnerOptions) (*HTTPEndpointResult, []*fhttp.HTTPRunnerResults, error) {
+	if len(e.Stages) > 0 {
+		return runStages(ctx, e)
+	}
+	ifr, failures, err := runCheckedFortio(ctx, fo, e.ResponseChecks)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newHTTPEndpointResult(ifr, failures), nil, nil
+}
+
 // getFortioResults collects Fortio run results
-// func (t *collectHTTPTask) getFortioResults() (*fhttp.HTTPRunnerResults, error) {
-// key is the metric prefix
 // key is the endpoint
-func (t *collectHTTPTask) getFortioResults() (HTTPResult, error) {
+// The results of the stages of endpoints with load profiles, and the errors of endpoints that could not be tested, are also returned, keyed by endpoint
+// Endpoints that have not been tested when ctx is done are skipped
+// Endpoints whose load profiles fail keep the results of the stages run before the failure
+func (t *collectHTTPTask) getFortioResults(ctx context.Context) (HTTPResult, HTTPStageResult, map[string]string, error) {
 	// the main idea is to run Fortio with proper options
 
-	var err error
 	results := HTTPResult{}
+	stageResults := HTTPStageResult{}
+	endpointErrors := map[string]string{}
+	var runErr error
 	if len(t.With.Endpoints) > 0 {
 		log.Logger.Trace("multiple endpoints")
-		for endpointID, endpoint := range t.With.Endpoints {
-			endpoint := endpoint // prevent implicit memory aliasing
-			log.Logger.Trace(fmt.Sprintf("endpoint: %s", endpointID))
+		ids := sortedEndpointIDs(t.With.Endpoints)
+		endpoints := map[string]endpoint{}
+		options := map[string]*fhttp.HTTPRunnerOptions{}
+		for _, endpointID := range ids {
+			endpoint := t.With.Endpoints[endpointID]
 
 			// merge endpoint config with baseline config
 			if err := mergo.Merge(&endpoint, t.With.endpoint); err != nil {
 				log.Logger.Error(fmt.Sprintf("could not merge Fortio options for endpoint \"%s\"", endpointID))
-				return nil, err
+				return nil, nil, nil, err
 			}
 
-			efo, err := getFortioOptions(endpoint)
+			efo, err := getFortioOptions(ctx, endpoint)
 			if err != nil {
-				log.Logger.Error(fmt.Sprintf("could not get Fortio options for endpoint \"%s\"", endpointID))
-				return nil, err
+				log.Logger.WithStackTrace(err.Error()).Error(fmt.Sprintf("could not get Fortio options for endpoint \"%s\"", endpointID))
+				endpointErrors[endpointID] = err.Error()
+				continue
 			}
 
 			log.Logger.Trace("got fortio options")
 			log.Logger.Trace("URL: ", efo.URL)
+			endpoints[endpointID] = endpoint
+			options[endpointID] = efo
+		}
 
+		// divide a shared QPS budget evenly among the endpoints that can be tested
+		if stringValue(t.With.QPSBudget) == BudgetShared && t.With.QPS != nil && len(options) > 0 {
+			qps := *t.With.QPS / float32(len(options))
+			for endpointID, efo := range options {
+				endpoint := endpoints[endpointID]
+				endpoint.QPS = float32Pointer(qps)
+				endpoints[endpointID] = endpoint
+				efo.QPS = float64(qps)
+			}
+		}
+
+		var mu sync.Mutex
+		runEndpoints(ctx, stringValue(t.With.Mode), ids, func(endpointID string) {
+			if options[endpointID] == nil {
+				return
+			}
 			log.Logger.Trace("run fortio HTTP test")
-			ifr, err := fhttp.RunHTTPTest(efo)
+			ifr, stages, err := runHTTPEndpoint(ctx, endpoints[endpointID], options[endpointID])
+
+			mu.Lock()
+			defer mu.Unlock()
 			if err != nil {
-				log.Logger.WithStackTrace(err.Error()).Error("fortio failed")
-				continue
+				log.Logger.WithStackTrace(err.Error()).Error(fmt.Sprintf("fortio failed for endpoint \"%s\"", endpointID))
+				endpointErrors[endpointID] = err.Error()
+			}
+			if ifr == nil {
+				return
 			}
-
 			results[endpointID] = ifr
-		}
+			if stages != nil {
+				stageResults[endpointID] = stages
+			}
+		})
 	} else {
-		fo, err := getFortioOptions(t.With.endpoint)
+		fo, err := getFortioOptions(ctx, t.With.endpoint)
 		if err != nil {
 			log.Logger.Error("could not get Fortio options")
-			return nil, err
+			return nil, nil, nil, err
 		}
 
 		log.Logger.Trace("got fortio options")
 		log.Logger.Trace("URL: ", fo.URL)
 
 		log.Logger.Trace("run fortio HTTP test")
-		ifr, err := fhttp.RunHTTPTest(fo)
+		ifr, stages, err := runHTTPEndpoint(ctx, t.With.endpoint, fo)
 		if err != nil {
 			log.Logger.WithStackTrace(err.Error()).Error("fortio failed")
-			return nil, err
+			if ifr == nil {
+				return nil, nil, nil, err
+			}
+			// the partial results of a load profile are kept
+			runErr = err
 		}
 
 		results[t.With.URL] = ifr
+		if stages != nil {
+			stageResults[t.With.URL] = stages
+		}
 	}
 
-	return results, err
+	return results, stageResults, endpointErrors, runErr
+}
+
+// endpointVersions returns the version of each endpoint, keyed like the results of this task
+// Endpoints inherit the version and track of the task if they do not specify their own
+func (t *collectHTTPTask) endpointVersions() map[string]VersionInfo {
+	base := VersionInfo{Version: t.With.Version, Track: t.With.Track}
+	if len(t.With.Endpoints) == 0 {
+		return map[string]VersionInfo{t.With.URL: base}
+	}
+	versions := map[string]VersionInfo{}
+	for endpointID, e := range t.With.Endpoints {
+		versions[endpointID] = inheritVersion(VersionInfo{Version: e.Version, Track: e.Track}, base)
+	}
+	return versions
 }
 
-// run executes this task
-func (t *collectHTTPTask) run(exp *Experiment) error {
-	err := t.validateInputs()
+// Run executes this task
+// If ctx is done before the test completes, the partial results are recorded and an error is returned
+func (t *collectHTTPTask) Run(ctx context.Context, exp *Experiment) error {
+	err := t.ValidateInputs()
 	if err != nil {
 		return err
 	}
 
-	t.initializeDefaults()
+	t.InitializeDefaults()
 
-	// run fortio
-	data, err := t.getFortioResults()
-	if err != nil {
-		return err
+	// run fortio; the partial results of a failed load profile are recorded, and its error is returned
+	data, stageData, endpointErrors, runErr := t.getFortioResults(ctx)
+	if runErr != nil && len(data) == 0 {
+		return runErr
+	}
+
+	// failed endpoints fail this task if so configured, or if no endpoint could be tested
+	var failure error
+	if *t.With.FailOnEndpointError || len(data) == 0 {
+		failure = failedEndpointsError(endpointErrors)
 	}
 
 	// ignore results if warmup
 	if t.With.Warmup != nil && *t.With.Warmup {
 		log.Logger.Debug("warmup: ignoring results")
-		return nil
+		return errors.Join(runErr, failure, ctx.Err())
 	}
 
 	// this task populates insights in the experiment
-	// hence, initialize insights with num versions (= 1)
-	err = exp.Result.initInsightsWithNumVersions(1)
-	if err != nil {
-		return err
-	}
+	// the versions of the app are those of the endpoints
+	exp.Result.setEndpointVersions(CollectHTTPTaskName, t.endpointVersions())
 
 	// write data to Insights
 	exp.Result.Insights.TaskData[CollectHTTPTaskName] = data
+	exp.Result.setEndpointErrors(CollectHTTPTaskName, endpointErrors)
+	exp.Result.setStageData(CollectHTTPTaskName, stageData)
+
+	// publish metrics as outputs
+	metrics := map[string]map[string]float64{}
+	for endpoint, r := range data {
+		metrics[endpoint] = getHTTPMetrics(r.HTTPRunnerResults)
+	}
+	exp.setMetricsOutputs(t.TaskMeta, httpMetricPrefix, metrics)
 
-	return nil
+	return errors.Join(runErr, failure, ctx.Err())
 }
@@ -2,12 +2,16 @@ package base
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"fortio.org/fortio/fhttp"
 	"github.com/stretchr/testify/assert"
@@ -73,7 +77,7 @@ func TestRunCollectHTTP(t *testing.T) {
 		},
 	}
 	exp.initResults(1)
-	err = ct.run(exp)
+	err = ct.Run(context.Background(), exp)
 	assert.NoError(t, err)
 	assert.True(t, called) // ensure that the /foo/ handler is called
 	assert.Equal(t, exp.Result.Insights.NumVersions, 1)
@@ -91,6 +95,48 @@ func TestRunCollectHTTP(t *testing.T) {
 	assert.NotNil(t, httpResult[url])
 }
 
+func TestRunCollectHTTPCancel(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	mux.HandleFunc("/"+foo, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(200)
+	})
+	url := fmt.Sprintf("http://localhost:%d/", addr.Port) + foo
+
+	ct := &collectHTTPTask{
+		TaskMeta: TaskMeta{
+			Task: StringPointer(CollectHTTPTaskName),
+		},
+		With: collectHTTPInputs{
+			endpoint: endpoint{
+				Duration: StringPointer("1m"),
+				QPS:      float32Pointer(10),
+				Headers:  map[string]string{},
+				URL:      url,
+			},
+		},
+	}
+
+	exp := &Experiment{
+		Spec:   []Task{ct},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := ct.Run(ctx, exp)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	// results of the requests sent before cancellation are recorded
+	httpResult, ok := exp.Result.Insights.TaskData[CollectHTTPTaskName].(HTTPResult)
+	assert.True(t, ok)
+	assert.NotNil(t, httpResult[url])
+	assert.Greater(t, httpResult[url].DurationHistogram.Count, int64(0))
+}
+
 // If the endpoint does not exist, fail gracefully
 // Should not return an nil pointer dereference error (see #1451)
 func TestRunCollectHTTPNoEndpoint(t *testing.T) {
@@ -118,7 +164,7 @@ func TestRunCollectHTTPNoEndpoint(t *testing.T) {
 		Result: &ExperimentResult{},
 	}
 	exp.initResults(1)
-	err := ct.run(exp)
+	err := ct.Run(context.Background(), exp)
 
 	assert.EqualError(t, err, fmt.Sprintf("error 404 for %s (176 bytes)", baseURL))
 }
@@ -199,7 +245,7 @@ func TestRunCollectHTTPMultipleEndpoints(t *testing.T) {
 		},
 	}
 	exp.initResults(1)
-	err = ct.run(exp)
+	err = ct.Run(context.Background(), exp)
 	assert.NoError(t, err)
 	assert.True(t, fooCalled) // ensure that the /foo/ handler is called
 	assert.True(t, barCalled) // ensure that the /bar/ handler is called
@@ -219,6 +265,106 @@ func TestRunCollectHTTPMultipleEndpoints(t *testing.T) {
 	assert.NotNil(t, httpResult[endpoint2])
 }
 
+func TestRunCollectHTTPConcurrentEndpoints(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	mux, addr := fhttp.DynamicHTTPServer(false)
+
+	// each request is slow enough to overlap with requests to the other endpoint
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.WriteHeader(200)
+	}
+	mux.HandleFunc("/"+foo, handler)
+	mux.HandleFunc("/"+bar, handler)
+
+	baseURL := fmt.Sprintf("http://localhost:%d/", addr.Port)
+	ct := &collectHTTPTask{
+		TaskMeta: TaskMeta{
+			Task: StringPointer(CollectHTTPTaskName),
+		},
+		With: collectHTTPInputs{
+			endpoint: endpoint{
+				NumRequests: int64Pointer(10),
+				QPS:         float32Pointer(40),
+				Connections: IntPointer(1),
+			},
+			Mode:      StringPointer(EndpointModeConcurrent),
+			QPSBudget: StringPointer(BudgetShared),
+			Endpoints: map[string]endpoint{
+				endpoint1: {URL: baseURL + foo},
+				endpoint2: {URL: baseURL + bar},
+				// endpoints that cannot be tested do not take a share of the budget
+				"invalid": {URL: baseURL + bar, PayloadFile: StringPointer("missing.json")},
+			},
+		},
+	}
+
+	exp := &Experiment{
+		Spec:   []Task{ct},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+	err := ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+	assert.Contains(t, exp.Result.Insights.EndpointErrors[CollectHTTPTaskName], "invalid")
+
+	// each endpoint uses one connection, so requests overlap only if endpoints are tested at the same time
+	assert.Equal(t, 2, maxInFlight)
+
+	httpResult, ok := exp.Result.Insights.TaskData[CollectHTTPTaskName].(HTTPResult)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(httpResult))
+	for _, id := range []string{endpoint1, endpoint2} {
+		assert.Equal(t, int64(10), httpResult[id].DurationHistogram.Count)
+		// the shared budget is divided evenly among endpoints
+		assert.Equal(t, "20", httpResult[id].RequestedQPS)
+	}
+}
+
+func TestValidateCollectHTTPMode(t *testing.T) {
+	ct := &collectHTTPTask{
+		With: collectHTTPInputs{
+			endpoint: endpoint{URL: "http://localhost:8080"},
+			Mode:     StringPointer("parallel"),
+		},
+	}
+	assert.ErrorContains(t, ct.ValidateInputs(), `with.mode: invalid mode "parallel"`)
+
+	// a shared budget requires concurrent mode and endpoints without their own QPS
+	ct.With.Mode = StringPointer(EndpointModeSequential)
+	ct.With.QPSBudget = StringPointer(BudgetShared)
+	ct.With.Endpoints = map[string]endpoint{
+		endpoint1: {QPS: float32Pointer(10)},
+		endpoint2: {},
+	}
+	err := ct.ValidateInputs()
+	assert.ErrorContains(t, err, "with.qpsBudget: a shared budget requires concurrent mode")
+	assert.ErrorContains(t, err, "with.endpoints.endpoint1.qps: cannot be set when the qps budget is shared")
+
+	ct.With.Mode = StringPointer(EndpointModeConcurrent)
+	delete(ct.With.Endpoints, endpoint1)
+	assert.NoError(t, ct.ValidateInputs())
+
+	// load profiles, of the task or of endpoints, do not use the shared budget
+	stages := []stage{{QPS: 10, Duration: "1s"}}
+	ct.With.Stages = stages
+	ct.With.Endpoints[endpoint1] = endpoint{Stages: stages}
+	err = ct.ValidateInputs()
+	assert.ErrorContains(t, err, "with.stages: cannot be set when the qps budget is shared")
+	assert.ErrorContains(t, err, "with.endpoints.endpoint1.stages: cannot be set when the qps budget is shared")
+}
+
 // Multiple endpoints are provided but they share one URL
 // Test that the base-level URL is provided to each endpoint
 // Make multiple calls to the same URL but with different headers
@@ -283,7 +429,7 @@ func TestRunCollectHTTPSingleEndpointMultipleCalls(t *testing.T) {
 		},
 	}
 	exp.initResults(1)
-	err = ct.run(exp)
+	err = ct.Run(context.Background(), exp)
 	assert.NoError(t, err)
 	assert.True(t, fooCalled) // ensure that the /foo/ handler is called
 	assert.True(t, barCalled) // ensure that the /bar/ handler is called
@@ -306,7 +452,7 @@ func TestRunCollectHTTPSingleEndpointMultipleCalls(t *testing.T) {
 // TODO: should this still return insights even though the endpoints cannot be reached?
 // This would mean no Grafana dashboard would be produced
 //
-// If the endpoints cannot be reached, then do not throw an error
+// If none of the endpoints can be reached, then the task fails, even if failOnEndpointError is not set
 // Should not return an nil pointer dereference error (see #1451)
 func TestRunCollectHTTPMultipleNoEndpoints(t *testing.T) {
 	// define METRICS_SERVER_URL
@@ -355,8 +501,8 @@ func TestRunCollectHTTPMultipleNoEndpoints(t *testing.T) {
 		},
 	}
 	exp.initResults(1)
-	err = ct.run(exp)
-	assert.NoError(t, err)
+	err = ct.Run(context.Background(), exp)
+	assert.EqualError(t, err, "unable to test endpoints: endpoint1, endpoint2")
 
 	taskData := exp.Result.Insights.TaskData[CollectHTTPTaskName]
 	assert.NotNil(t, taskData)
@@ -370,6 +516,72 @@ func TestRunCollectHTTPMultipleNoEndpoints(t *testing.T) {
 	assert.Equal(t, 0, len(httpResult))
 }
 
+func TestRunCollectHTTPFailedEndpoints(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	mux.HandleFunc("/"+foo, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	// endpoint2 cannot be reached, so fortio fails for it
+	baseURL := fmt.Sprintf("http://localhost:%d/", addr.Port)
+	ct := &collectHTTPTask{
+		TaskMeta: TaskMeta{
+			Task: StringPointer(CollectHTTPTaskName),
+		},
+		With: collectHTTPInputs{
+			// fortio checks that endpoints can be reached when tests are based on duration
+			endpoint: endpoint{
+				Duration: StringPointer("1s"),
+			},
+			Endpoints: map[string]endpoint{
+				endpoint1: {URL: baseURL + foo},
+				endpoint2: {URL: "http://localhost:1/" + bar},
+			},
+		},
+	}
+
+	exp := &Experiment{
+		Spec:   []Task{ct},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+	err := ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	httpResult, ok := exp.Result.Insights.TaskData[CollectHTTPTaskName].(HTTPResult)
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(httpResult))
+	assert.NotNil(t, httpResult[endpoint1])
+	assert.Equal(t, []string{endpoint2}, sortedEndpointIDs(exp.Result.Insights.EndpointErrors[CollectHTTPTaskName]))
+	assert.NotEmpty(t, exp.Result.Insights.EndpointErrors[CollectHTTPTaskName][endpoint2])
+
+	// failed endpoints fail the task if so configured, and are still recorded
+	ct.With.FailOnEndpointError = BoolPointer(true)
+	exp.initResults(1)
+	err = ct.Run(context.Background(), exp)
+	assert.EqualError(t, err, "unable to test endpoints: endpoint2")
+	assert.Contains(t, exp.Result.Insights.EndpointErrors[CollectHTTPTaskName], endpoint2)
+	assert.Contains(t, exp.Result.Insights.TaskData[CollectHTTPTaskName], endpoint1)
+
+	// endpoints whose options are invalid are recorded like those that cannot be reached
+	ct.With.FailOnEndpointError = BoolPointer(false)
+	ct.With.Endpoints[endpoint2] = endpoint{URL: baseURL + bar, PayloadFile: StringPointer("missing.json")}
+	exp.initResults(1)
+	err = ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+	assert.Contains(t, exp.Result.Insights.EndpointErrors[CollectHTTPTaskName][endpoint2], "missing.json")
+	assert.Contains(t, exp.Result.Insights.TaskData[CollectHTTPTaskName], endpoint1)
+
+	// the task fails when no endpoint can be tested, even if failOnEndpointError is not set
+	ct.With.Endpoints[endpoint1] = endpoint{URL: baseURL + foo, PayloadFile: StringPointer("missing.json")}
+	exp.initResults(1)
+	err = ct.Run(context.Background(), exp)
+	assert.EqualError(t, err, "unable to test endpoints: endpoint1, endpoint2")
+	assert.Equal(t, []string{endpoint1, endpoint2}, sortedEndpointIDs(exp.Result.Insights.EndpointErrors[CollectHTTPTaskName]))
+	assert.Empty(t, exp.Result.Insights.TaskData[CollectHTTPTaskName])
+}
+
 func TestRunCollectHTTPWithWarmup(t *testing.T) {
 	// define METRICS_SERVER_URL
 	metricsServerURL := "http://iter8.default:8080"
@@ -420,7 +632,7 @@ func TestRunCollectHTTPWithWarmup(t *testing.T) {
 		},
 	}
 	exp.initResults(1)
-	err = ct.run(exp)
+	err = ct.Run(context.Background(), exp)
 	assert.NoError(t, err)
 	assert.True(t, called) // ensure that the /foo/ handler is called
 
@@ -428,41 +640,32 @@ func TestRunCollectHTTPWithWarmup(t *testing.T) {
 	assert.Nil(t, exp.Result.Insights)
 }
 
-func TestRunCollectHTTPWithIncorrectNumVersions(t *testing.T) {
-	// define METRICS_SERVER_URL
-	metricsServerURL := "http://iter8.default:8080"
-	err := os.Setenv(MetricsServerURL, metricsServerURL)
-	assert.NoError(t, err)
-
+func TestRunCollectHTTPWithVersions(t *testing.T) {
 	mux, addr := fhttp.DynamicHTTPServer(false)
+	mux.HandleFunc("/"+foo, GetTrackingHandler(new(atomic.Bool)))
+	mux.HandleFunc("/"+bar, GetTrackingHandler(new(atomic.Bool)))
+	baseURL := fmt.Sprintf("http://localhost:%d/", addr.Port)
 
-	// /foo/ handler
-	called := false // ensure that the /foo/ handler is called
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		called = true
-		data, _ := io.ReadAll(r.Body)
-		testData, _ := os.ReadFile(CompletePath("../", "testdata/payload/ukpolice.json"))
-
-		// assert that PayloadFile is working
-		assert.True(t, bytes.Equal(data, testData))
-
-		w.WriteHeader(200)
-	}
-	mux.HandleFunc("/"+foo, handler)
-
-	url := fmt.Sprintf("http://localhost:%d/", addr.Port) + foo
-
-	// valid collect HTTP task... should succeed
+	// endpoints inherit the version of the task unless they specify their own
 	ct := &collectHTTPTask{
 		TaskMeta: TaskMeta{
 			Task: StringPointer(CollectHTTPTaskName),
 		},
 		With: collectHTTPInputs{
 			endpoint: endpoint{
-				Duration:    StringPointer("1s"),
-				PayloadFile: StringPointer(CompletePath("../", "testdata/payload/ukpolice.json")),
-				Headers:     map[string]string{},
-				URL:         url,
+				NumRequests: int64Pointer(5),
+				Version:     "v1",
+				Track:       "stable",
+			},
+			Endpoints: map[string]endpoint{
+				"stable": {
+					URL: baseURL + foo,
+				},
+				"candidate": {
+					URL:     baseURL + bar,
+					Version: "v2",
+					Track:   "candidate",
+				},
 			},
 		},
 	}
@@ -470,41 +673,42 @@ func TestRunCollectHTTPWithIncorrectNumVersions(t *testing.T) {
 	exp := &Experiment{
 		Spec:   []Task{ct},
 		Result: &ExperimentResult{},
-		Metadata: ExperimentMetadata{
-			Name:      myName,
-			Namespace: myNamespace,
-		},
 	}
 	exp.initResults(1)
-
+	// insights from a previous task without versions
 	exp.Result.Insights = &Insights{
-		NumVersions: 2, // will cause http task to fail; grpc task expects insights been nil or numVersions set to 1
+		NumVersions: 1,
 	}
 
-	err = ct.run(exp)
-	assert.Error(t, err) // fail because of initInsightsWithNumVersions()
+	err := ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
 
-	assert.True(t, called) // ensure that the /foo/ handler is called
+	in := exp.Result.Insights
+	assert.Equal(t, 2, in.NumVersions)
+	assert.Equal(t, []VersionInfo{{Version: "v1", Track: "stable"}, {Version: "v2", Track: "candidate"}}, in.VersionNames)
+	assert.Equal(t, "stable (v1)", in.EndpointVersionStr(CollectHTTPTaskName, "stable"))
+	assert.Equal(t, "candidate (v2)", in.EndpointVersionStr(CollectHTTPTaskName, "candidate"))
 
-	// error ensures that Fortio results are not written to insights
-	assert.Nil(t, exp.Result.Insights.TaskData)
+	httpResult, ok := in.TaskData[CollectHTTPTaskName].(HTTPResult)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(httpResult))
 }
 
 func TestGetFortioOptions(t *testing.T) {
 	// check to catch nil QPS
-	_, err := getFortioOptions(endpoint{})
+	_, err := getFortioOptions(context.Background(), endpoint{})
 	assert.Error(t, err)
 
 	// check for catch nil connections
 	QPS := float32(8)
-	_, err = getFortioOptions(endpoint{
+	_, err = getFortioOptions(context.Background(), endpoint{
 		QPS: &QPS,
 	})
 	assert.Error(t, err)
 
 	// check to catch nil allowInitialErrors
 	connections := 8
-	_, err = getFortioOptions(endpoint{
+	_, err = getFortioOptions(context.Background(), endpoint{
 		QPS:         &QPS,
 		Connections: &connections,
 	})
@@ -515,7 +719,7 @@ func TestGetFortioOptions(t *testing.T) {
 	payloadStr := "testPayload"
 	allowInitialErrors := true
 
-	options, err := getFortioOptions(endpoint{
+	options, err := getFortioOptions(context.Background(), endpoint{
 		NumRequests:        &numRequests,
 		ContentType:        &contentType,
 		PayloadStr:         &payloadStr,
@@ -0,0 +1,275 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"fortio.org/fortio/fhttp"
+	"github.com/bojand/ghz/runner"
+	"github.com/dustin/go-humanize"
+	log "github.com/iter8-tools/iter8/base/log"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/grpc"
+)
+
+// tlsConfig contains the TLS options used to connect to an app
+// Certificates and keys are read from files, such as those of a Kubernetes secret mounted as a volume
+type tlsConfig struct {
+	// CAFile is the path of a PEM file with the CA certificates used to verify the app; optional. Default is the CA certificates of the host.
+	CAFile string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	// CertFile is the path of a PEM file with the client certificate used for mutual TLS; optional. Requires keyFile.
+	CertFile string `json:"certFile,omitempty" yaml:"certFile,omitempty"`
+	// KeyFile is the path of a PEM file with the key of the client certificate; optional. Requires certFile.
+	KeyFile string `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
+	// ServerName is sent as SNI and used to verify the certificate of the app; optional. Default value is the host of the app.
+	ServerName string `json:"serverName,omitempty" yaml:"serverName,omitempty"`
+	// InsecureSkipVerify disables verification of the certificate of the app
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"`
+}
+
+// oauth2Config contains the OAuth2 client credentials used to obtain bearer tokens for requests to an app
+// Tokens are fetched before the first request, and refreshed when they expire
+type oauth2Config struct {
+	// TokenURL is the URL of the token endpoint of the authorization server
+	TokenURL string `json:"tokenURL" yaml:"tokenURL"`
+	// ClientID is the client ID; specify either this field or clientIDFile
+	ClientID string `json:"clientID,omitempty" yaml:"clientID,omitempty"`
+	// ClientIDFile is the path of a file with the client ID
+	ClientIDFile string `json:"clientIDFile,omitempty" yaml:"clientIDFile,omitempty"`
+	// ClientSecret is the client secret; specify either this field or clientSecretFile
+	ClientSecret string `json:"clientSecret,omitempty" yaml:"clientSecret,omitempty"`
+	// ClientSecretFile is the path of a file with the client secret
+	ClientSecretFile string `json:"clientSecretFile,omitempty" yaml:"clientSecretFile,omitempty"`
+	// Scopes are the scopes requested; optional
+	Scopes []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+	// EndpointParams are additional parameters of token requests (example, audience); optional
+	EndpointParams map[string]string `json:"endpointParams,omitempty" yaml:"endpointParams,omitempty"`
+	// AllowInsecure allows tokens to be sent over plaintext connections, to http:// URLs and to gRPC apps without TLS (example, to a service mesh sidecar that encrypts traffic). Default value is false.
+	AllowInsecure bool `json:"allowInsecure,omitempty" yaml:"allowInsecure,omitempty"`
+
+	// the token source is shared by the tests that use it, while the context it was created with is not done
+	// Token sources are only kept once a token is fetched, so that attempts after a failure fetch a token again
+	mu          sync.Mutex
+	tokenSource oauth2.TokenSource
+	tokenCtx    context.Context
+}
+
+// validateTLSConfig validates TLS options; prefix is the path of the options
+func validateTLSConfig(prefix string, c *tlsConfig) error {
+	if c == nil {
+		return nil
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return newFieldError(prefix, "certFile and keyFile must be specified together")
+	}
+	return nil
+}
+
+// validateOAuth2Config validates OAuth2 client credentials; prefix is the path of the credentials
+func validateOAuth2Config(prefix string, c *oauth2Config) error {
+	if c == nil {
+		return nil
+	}
+	errs := []error{validateURL(prefix+".tokenURL", c.TokenURL)}
+	if (c.ClientID == "") == (c.ClientIDFile == "") {
+		errs = append(errs, newFieldError(prefix, "specify exactly one of clientID and clientIDFile"))
+	}
+	if (c.ClientSecret == "") == (c.ClientSecretFile == "") {
+		errs = append(errs, newFieldError(prefix, "specify exactly one of clientSecret and clientSecretFile"))
+	}
+	return errors.Join(errs...)
+}
+
+// readCredential returns value, or the content of file if value is empty
+func readCredential(value string, file string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	b, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// getTokenSource returns the token source of these client credentials, fetching the first token the first time
+// Tokens are fetched with ctx, so that slow token endpoints are bounded by the timeout of the task
+func (c *oauth2Config) getTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokenSource != nil && c.tokenCtx.Err() == nil {
+		return c.tokenSource, nil
+	}
+	ts, err := newTokenSource(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	c.tokenSource, c.tokenCtx = ts, ctx
+	return ts, nil
+}
+
+// newTokenSource returns a token source that fetches a token with client credentials, and fetches a new one when it expires
+func newTokenSource(ctx context.Context, c *oauth2Config) (oauth2.TokenSource, error) {
+	clientID, err := readCredential(c.ClientID, c.ClientIDFile)
+	if err != nil {
+		e := errors.New("unable to read OAuth2 client ID")
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	clientSecret, err := readCredential(c.ClientSecret, c.ClientSecretFile)
+	if err != nil {
+		e := errors.New("unable to read OAuth2 client secret")
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	log.AddSecret(clientSecret)
+
+	params := url.Values{}
+	for key, value := range c.EndpointParams {
+		params.Set(key, value)
+	}
+	cc := &clientcredentials.Config{
+		ClientID:       clientID,
+		ClientSecret:   clientSecret,
+		TokenURL:       c.TokenURL,
+		Scopes:         c.Scopes,
+		EndpointParams: params,
+	}
+	ts := cc.TokenSource(ctx)
+
+	// a token is fetched before the test, so that a test with invalid credentials fails instead of sending unauthorized requests
+	if _, err := ts.Token(); err != nil {
+		e := fmt.Errorf("unable to fetch OAuth2 token from %v", c.TokenURL)
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	return ts, nil
+}
+
+// addTransport wraps the transport of a Fortio test; transports added later wrap those added earlier
+// Transports are only used by the standard HTTP client
+func addTransport(fo *fhttp.HTTPRunnerOptions, wrap func(http.RoundTripper) http.RoundTripper) {
+	fo.DisableFastClient = true
+	previous := fo.Transport
+	if previous == nil {
+		fo.Transport = wrap
+		return
+	}
+	fo.Transport = func(base http.RoundTripper) http.RoundTripper {
+		return wrap(previous(base))
+	}
+}
+
+// setFortioCredentials sets the TLS options and OAuth2 client credentials of a Fortio test
+// Tokens are fetched with ctx
+func setFortioCredentials(ctx context.Context, fo *fhttp.HTTPRunnerOptions, tc *tlsConfig, oc *oauth2Config) error {
+	if tc != nil {
+		fo.TLSOptions.CACert = tc.CAFile
+		fo.TLSOptions.Cert = tc.CertFile
+		fo.TLSOptions.Key = tc.KeyFile
+		fo.TLSOptions.Insecure = tc.InsecureSkipVerify
+		if tc.ServerName != "" {
+			serverName := tc.ServerName
+			addTransport(fo, func(base http.RoundTripper) http.RoundTripper {
+				// the standard HTTP client connects to the app with this transport
+				if t, ok := base.(*http.Transport); ok && t.TLSClientConfig != nil {
+					t.TLSClientConfig.ServerName = serverName
+				}
+				return base
+			})
+		}
+	}
+	if oc != nil {
+		if u, err := url.Parse(fo.URL); (err != nil || !strings.EqualFold(u.Scheme, "https")) && !oc.AllowInsecure {
+			return errors.New("OAuth2 tokens are only sent to https URLs; use https, or allow insecure connections in the OAuth2 client credentials")
+		}
+		ts, err := oc.getTokenSource(ctx)
+		if err != nil {
+			return err
+		}
+		addTransport(fo, func(base http.RoundTripper) http.RoundTripper {
+			return &oauth2.Transport{Source: ts, Base: base}
+		})
+	}
+	return nil
+}
+
+// usesTLS returns true if a ghz configuration connects to the app with TLS
+func usesTLS(c runner.Config) bool {
+	return c.RootCert != "" || c.Cert != "" || c.SkipTLSVerify || c.CName != ""
+}
+
+// setGRPCTLS sets the TLS options of a ghz configuration
+func setGRPCTLS(c *runner.Config, tc *tlsConfig) {
+	if tc == nil {
+		return
+	}
+	c.Insecure = false
+	c.RootCert = tc.CAFile
+	c.Cert = tc.CertFile
+	c.Key = tc.KeyFile
+	c.CName = tc.ServerName
+	c.SkipTLSVerify = tc.InsecureSkipVerify
+}
+
+// tokenCredentials authorizes gRPC calls with OAuth2 bearer tokens
+// Tokens are only sent over plaintext connections, such as those to a service mesh sidecar, if the credentials allow it
+type tokenCredentials struct {
+	oauth2.TokenSource
+	allowInsecure bool
+}
+
+// GetRequestMetadata returns the authorization metadata of a call
+func (tc tokenCredentials) GetRequestMetadata(_ context.Context, _ ...string) (map[string]string, error) {
+	token, err := tc.Token()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": token.Type() + " " + token.AccessToken}, nil
+}
+
+// RequireTransportSecurity returns true unless tokens may be sent over plaintext connections
+func (tc tokenCredentials) RequireTransportSecurity() bool {
+	return !tc.allowInsecure
+}
+
+// getGRPCCredentialOptions returns the ghz options that authorize calls with OAuth2 bearer tokens
+// Tokens are fetched with ctx
+func getGRPCCredentialOptions(ctx context.Context, c *runner.Config, oc *oauth2Config) ([]runner.Option, error) {
+	if oc == nil {
+		return nil, nil
+	}
+	if c.Insecure && !oc.AllowInsecure {
+		return nil, errors.New("OAuth2 tokens are only sent over TLS; configure TLS, or allow insecure connections in the OAuth2 client credentials")
+	}
+	ts, err := oc.getTokenSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// default call options replace those of the configuration, which are therefore included
+	callOptions := []grpc.CallOption{grpc.PerRPCCredentials(tokenCredentials{ts, oc.AllowInsecure})}
+	if c.MaxCallRecvMsgSize != "" {
+		v, err := humanize.ParseBytes(c.MaxCallRecvMsgSize)
+		if err != nil {
+			return nil, err
+		}
+		callOptions = append(callOptions, grpc.MaxCallRecvMsgSize(int(v)))
+	}
+	if c.MaxCallSendMsgSize != "" {
+		v, err := humanize.ParseBytes(c.MaxCallSendMsgSize)
+		if err != nil {
+			return nil, err
+		}
+		callOptions = append(callOptions, grpc.MaxCallSendMsgSize(int(v)))
+	}
+	return []runner.Option{runner.WithDefaultCallOptions(callOptions)}, nil
+}
@@ -0,0 +1,275 @@
+package base
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bojand/ghz/runner"
+	"github.com/iter8-tools/iter8/base/internal/helloworld/helloworld"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+)
+
+// startTokenServer starts an OAuth2 token endpoint that issues tokens for the given client credentials
+func startTokenServer(t *testing.T, clientID string, clientSecret string) (*httptest.Server, *atomic.Int64) {
+	var count atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != clientID || secret != clientSecret || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := count.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "bearer", "expires_in": 3600}`, n)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &count
+}
+
+func TestValidateCredentials(t *testing.T) {
+	err := validateEndpoint("with", endpoint{
+		URL: "https://localhost:8443",
+		TLS: &tlsConfig{CertFile: "tls.crt"},
+		OAuth2: &oauth2Config{
+			TokenURL:         "not a url",
+			ClientSecret:     "secret",
+			ClientSecretFile: "/etc/secret",
+		},
+	}, true)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "with.tls: certFile and keyFile must be specified together")
+	assert.Contains(t, err.Error(), "with.oauth2.tokenURL")
+	assert.Contains(t, err.Error(), "with.oauth2: specify exactly one of clientID and clientIDFile")
+	assert.Contains(t, err.Error(), "with.oauth2: specify exactly one of clientSecret and clientSecretFile")
+
+	assert.NoError(t, validateOAuth2Config("with.oauth2", &oauth2Config{
+		TokenURL:         "http://auth.default/token",
+		ClientID:         "iter8",
+		ClientSecretFile: "/etc/secret",
+	}))
+}
+
+func TestRunCollectHTTPTLSOAuth2(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	tokenServer, tokenCount := startTokenServer(t, "iter8", "s3cret")
+
+	var mu sync.Mutex
+	authorizations, serverNames := map[string]int{}, map[string]bool{}
+	app := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		authorizations[r.Header.Get("Authorization")]++
+		serverNames[r.TLS.ServerName] = true
+		w.WriteHeader(200)
+	}))
+	t.Cleanup(app.Close)
+
+	// credentials are read from files, as if mounted from a secret
+	assert.NoError(t, os.WriteFile("ca.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: app.Certificate().Raw}), 0600))
+	assert.NoError(t, os.WriteFile("client-secret", []byte("s3cret\n"), 0600))
+
+	ct := &collectHTTPTask{
+		TaskMeta: TaskMeta{
+			Task: StringPointer(CollectHTTPTaskName),
+		},
+		With: collectHTTPInputs{
+			endpoint: endpoint{
+				URL:         app.URL,
+				NumRequests: int64Pointer(10),
+				// the certificate of the test server is valid for example.com
+				TLS: &tlsConfig{CAFile: "ca.crt", ServerName: "example.com"},
+				OAuth2: &oauth2Config{
+					TokenURL:         tokenServer.URL,
+					ClientID:         "iter8",
+					ClientSecretFile: "client-secret",
+				},
+			},
+		},
+	}
+
+	exp := &Experiment{
+		Spec:   []Task{ct},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+	err := ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	httpResult, ok := exp.Result.Insights.TaskData[CollectHTTPTaskName].(HTTPResult)
+	assert.True(t, ok)
+	assert.Equal(t, map[int]int64{200: 10}, httpResult[app.URL].RetCodes)
+
+	// a token is fetched once, and reused until it expires
+	assert.Equal(t, int64(1), tokenCount.Load())
+	assert.Equal(t, 10, authorizations["Bearer token-1"])
+	assert.Equal(t, map[string]bool{"example.com": true}, serverNames)
+
+	// invalid credentials fail the test
+	ct.With.OAuth2 = &oauth2Config{TokenURL: tokenServer.URL, ClientID: "iter8", ClientSecret: "wrong"}
+	err = ct.Run(context.Background(), exp)
+	assert.ErrorContains(t, err, "unable to fetch OAuth2 token")
+
+	// tokens are not sent to http URLs unless the credentials allow it
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		authorizations[r.Header.Get("Authorization")]++
+		w.WriteHeader(200)
+	}))
+	t.Cleanup(plain.Close)
+	ct.With.URL = plain.URL
+	ct.With.TLS = nil
+	ct.With.OAuth2 = &oauth2Config{TokenURL: tokenServer.URL, ClientID: "iter8", ClientSecret: "s3cret"}
+	err = ct.Run(context.Background(), exp)
+	assert.ErrorContains(t, err, "OAuth2 tokens are only sent to https URLs")
+	assert.Equal(t, int64(1), tokenCount.Load())
+
+	ct.With.OAuth2.AllowInsecure = true
+	err = ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, authorizations["Bearer token-2"])
+}
+
+func TestOAuth2TokenSource(t *testing.T) {
+	// the token endpoint is unavailable at first
+	var available atomic.Bool
+	tokenServer, tokenCount := startTokenServer(t, "iter8", "s3cret")
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		tokenServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(flaky.Close)
+
+	oc := &oauth2Config{TokenURL: flaky.URL, ClientID: "iter8", ClientSecret: "s3cret"}
+	_, err := oc.getTokenSource(context.Background())
+	assert.ErrorContains(t, err, "unable to fetch OAuth2 token")
+
+	// failures are not cached, so that retries fetch a token again
+	available.Store(true)
+	ts, err := oc.getTokenSource(context.Background())
+	assert.NoError(t, err)
+	token, err := ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+
+	// token sources are reused while their context is not done
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = oc.getTokenSource(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tokenCount.Load())
+
+	// tokens are fetched with the context of the task
+	oc = &oauth2Config{TokenURL: flaky.URL, ClientID: "iter8", ClientSecret: "s3cret"}
+	cancel()
+	_, err = oc.getTokenSource(ctx)
+	assert.ErrorContains(t, err, "unable to fetch OAuth2 token")
+	assert.Equal(t, int64(1), tokenCount.Load())
+}
+
+func TestGRPCTLS(t *testing.T) {
+	// connections are plaintext by default
+	ct := &collectGRPCTask{}
+	ct.InitializeDefaults()
+	assert.True(t, ct.With.Insecure)
+
+	ct = &collectGRPCTask{
+		With: collectGRPCInputs{
+			TLS: &tlsConfig{CAFile: "ca.crt", CertFile: "tls.crt", KeyFile: "tls.key", ServerName: "hello.example.com"},
+		},
+	}
+	ct.InitializeDefaults()
+	assert.False(t, ct.With.Insecure)
+	assert.Equal(t, "ca.crt", ct.With.RootCert)
+	assert.Equal(t, "tls.crt", ct.With.Cert)
+	assert.Equal(t, "tls.key", ct.With.Key)
+	assert.Equal(t, "hello.example.com", ct.With.CName)
+
+	// TLS options of ghz are also honored
+	ct = &collectGRPCTask{
+		With: collectGRPCInputs{
+			Config: runner.Config{SkipTLSVerify: true},
+		},
+	}
+	ct.InitializeDefaults()
+	assert.False(t, ct.With.Insecure)
+}
+
+func TestRunCollectGRPCOAuth2(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	tokenServer, tokenCount := startTokenServer(t, "iter8", "s3cret")
+
+	// the server records the authorization metadata of calls
+	var mu sync.Mutex
+	authorizations := map[string]int{}
+	lis, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		mu.Lock()
+		for _, a := range md.Get("authorization") {
+			authorizations[a]++
+		}
+		mu.Unlock()
+		return handler(ctx, req)
+	}))
+	helloworld.RegisterGreeterServer(s, helloworld.NewGreeter())
+	reflection.Register(s)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	ct := &collectGRPCTask{
+		TaskMeta: TaskMeta{
+			Task: StringPointer(CollectGRPCTaskName),
+		},
+		With: collectGRPCInputs{
+			Config: runner.Config{
+				Data:               map[string]interface{}{"name": "bob"},
+				Call:               "helloworld.Greeter.SayHello",
+				Host:               lis.Addr().String(),
+				N:                  20,
+				MaxCallRecvMsgSize: "1MB",
+			},
+			OAuth2: &oauth2Config{
+				TokenURL:     tokenServer.URL,
+				ClientID:     "iter8",
+				ClientSecret: "s3cret",
+			},
+		},
+	}
+
+	exp := &Experiment{
+		Spec:   []Task{ct},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+
+	// tokens are not sent over plaintext connections unless the credentials allow it
+	err = ct.Run(context.Background(), exp)
+	assert.ErrorContains(t, err, "OAuth2 tokens are only sent over TLS")
+	assert.Equal(t, int64(0), tokenCount.Load())
+	assert.Empty(t, authorizations)
+	assert.True(t, tokenCredentials{}.RequireTransportSecurity())
+
+	ct.With.OAuth2.AllowInsecure = true
+	err = ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(1), tokenCount.Load())
+	assert.Equal(t, map[string]int{"Bearer token-1": 20}, authorizations)
+}
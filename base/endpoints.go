@@ -0,0 +1,96 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/iter8-tools/iter8/base/log"
+)
+
+const (
+	// EndpointModeSequential indicates that the endpoints of a load test task are tested one after another
+	EndpointModeSequential = "sequential"
+	// EndpointModeConcurrent indicates that the endpoints of a load test task are tested at the same time
+	EndpointModeConcurrent = "concurrent"
+
+	// BudgetPerEndpoint indicates that each endpoint is sent requests at the rate of the task or its own rate
+	BudgetPerEndpoint = "per-endpoint"
+	// BudgetShared indicates that the rate of the task is divided evenly among its endpoints
+	BudgetShared = "shared"
+)
+
+// validateEndpointMode checks the mode and rate budget of a load test task
+// rateField is the name of the rate input of the task (example, qps); endpointRates are the endpoints that set their own rate
+// stages are the paths of the load profiles of the task and its endpoints, which do not use the rate of the task
+func validateEndpointMode(mode string, budget string, rateField string, endpointRates []string, stages []string) error {
+	errs := []error{}
+	if mode != "" && mode != EndpointModeSequential && mode != EndpointModeConcurrent {
+		errs = append(errs, newFieldError("with.mode", "invalid mode %q; must be %v or %v", mode, EndpointModeSequential, EndpointModeConcurrent))
+	}
+	budgetField := "with." + rateField + "Budget"
+	switch budget {
+	case "", BudgetPerEndpoint:
+	case BudgetShared:
+		if mode != EndpointModeConcurrent {
+			errs = append(errs, newFieldError(budgetField, "a shared budget requires %v mode", EndpointModeConcurrent))
+		}
+		for _, id := range endpointRates {
+			errs = append(errs, newFieldError(fmt.Sprintf("with.endpoints.%v.%v", id, rateField), "cannot be set when the %v budget is shared", rateField))
+		}
+		for _, path := range stages {
+			errs = append(errs, newFieldError(path, "cannot be set when the %v budget is shared", rateField))
+		}
+	default:
+		errs = append(errs, newFieldError(budgetField, "invalid budget %q; must be %v or %v", budget, BudgetPerEndpoint, BudgetShared))
+	}
+	return errors.Join(errs...)
+}
+
+// failedEndpointsError returns an error that names the endpoints that could not be tested, or nil if there are none
+func failedEndpointsError(errs map[string]string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("unable to test endpoints: %v", strings.Join(sortedEndpointIDs(errs), ", "))
+}
+
+// sortedEndpointIDs returns the IDs of endpoints in sorted order
+func sortedEndpointIDs[E any](endpoints map[string]E) []string {
+	ids := make([]string, 0, len(endpoints))
+	for id := range endpoints {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// runEndpoints calls run for each endpoint, either one after another or, in concurrent mode, all at once
+// In sequential mode, endpoints that have not been tested when ctx is done are skipped
+func runEndpoints(ctx context.Context, mode string, ids []string, run func(id string)) {
+	if mode != EndpointModeConcurrent {
+		for _, id := range ids {
+			log.Logger.Trace(fmt.Sprintf("endpoint: %s", id))
+			if ctx.Err() != nil {
+				log.Logger.Debug(fmt.Sprintf("skipping endpoint \"%s\"", id))
+				continue
+			}
+			run(id)
+		}
+		return
+	}
+
+	log.Logger.Trace(fmt.Sprintf("testing %d endpoints concurrently", len(ids)))
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			run(id)
+		}(id)
+	}
+	wg.Wait()
+}
@@ -1,26 +1,30 @@
 package base
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 
-	"github.com/expr-lang/expr"
 	log "github.com/iter8-tools/iter8/base/log"
 	"helm.sh/helm/v3/pkg/time"
 )
 
 // Task is the building block of an experiment spec
 // An experiment spec is a sequence of tasks
+// Tasks other than the built-in ones can be added using RegisterTask
 type Task interface {
-	// validateInputs for this task
-	validateInputs() error
+	// ValidateInputs for this task
+	ValidateInputs() error
 
-	// initializeDefaults of the input values to this task
-	initializeDefaults()
+	// InitializeDefaults of the input values to this task
+	InitializeDefaults()
 
-	// run this task
-	run(exp *Experiment) error
+	// Run this task
+	// The task should stop promptly and return an error when ctx is done
+	Run(ctx context.Context, exp *Experiment) error
 }
 
 // ExperimentSpec specifies the set of tasks in this experiment
@@ -43,12 +47,23 @@ type Experiment struct {
 	// Spec is the sequence of tasks that constitute this experiment
 	Spec ExperimentSpec `json:"spec" yaml:"spec"`
 
+	// Finally is the sequence of tasks that run after the tasks in the spec, even if they failed,
+	// were aborted, or the experiment deadline expired. The experiment deadline does not apply to them.
+	Finally ExperimentSpec `json:"finally,omitempty" yaml:"finally,omitempty"`
+
+	// Deadline is the maximum duration of the experiment run. Specified in the Go duration string format (example, 30m).
+	// Measured from the start of each run, including a run that resumes an interrupted one. Once it expires, the running task fails and remaining tasks are not run.
+	Deadline *string `json:"deadline,omitempty" yaml:"deadline,omitempty"`
+
 	// Result is the current results from this experiment.
 	// The experiment may not have completed in which case results may be partial.
 	Result *ExperimentResult `json:"result" yaml:"result"`
 
 	// driver enables interacting with experiment result stored externally
 	driver Driver
+
+	// taskKey identifies the running task by its position (example, 2 or finally-1); see setRunTaskData
+	taskKey string
 }
 
 // ExperimentResult defines the current results from the experiment
@@ -71,6 +86,19 @@ type ExperimentResult struct {
 	// Failure is true if any of its tasks failed
 	Failure bool `json:"failure" yaml:"failure"`
 
+	// Aborted is true if the experiment run was cancelled before it completed, for example, by a signal
+	Aborted bool `json:"aborted,omitempty" yaml:"aborted,omitempty"`
+
+	// Halted is true if the experiment run stopped before it completed because a task failed with onFailure abort,
+	// or because the deadline expired; unlike interrupted runs, such runs are not resumed
+	Halted bool `json:"halted,omitempty" yaml:"halted,omitempty"`
+
+	// Outputs are the outputs published by tasks, keyed by task ID and output name
+	Outputs map[string]map[string]interface{} `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+
+	// TaskResults records the execution of each task that has run or been skipped
+	TaskResults []TaskResult `json:"taskResults,omitempty" yaml:"taskResults,omitempty"`
+
 	// Insights produced in this experiment
 	Insights *Insights `json:"insights,omitempty" yaml:"insights,omitempty"`
 
@@ -78,6 +106,48 @@ type ExperimentResult struct {
 	Iter8Version string `json:"iter8Version" yaml:"iter8Version"`
 }
 
+// TaskResult is the execution record of a task in an experiment
+type TaskResult struct {
+	// Name is the name of the task
+	Name string `json:"name" yaml:"name"`
+
+	// Index is the (1-based) position of the task in the spec, or in the finally section
+	Index int `json:"index" yaml:"index"`
+
+	// Finally is true if the task is in the finally section
+	Finally bool `json:"finally,omitempty" yaml:"finally,omitempty"`
+
+	// Status is one of succeeded, failed, skipped or aborted
+	Status string `json:"status" yaml:"status"`
+
+	// StartTime is the time when the task started
+	StartTime time.Time `json:"startTime" yaml:"startTime"`
+
+	// EndTime is the time when the task ended
+	EndTime time.Time `json:"endTime" yaml:"endTime"`
+
+	// Duration is the time taken by the task, including retries. Specified in the Go duration string format (example, 1.5s).
+	Duration string `json:"duration" yaml:"duration"`
+
+	// Error is the error message of a failed task
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+
+	// Command is the result of the command of a run task
+	Command *CommandResult `json:"command,omitempty" yaml:"command,omitempty"`
+}
+
+// CommandResult is the result of the command of a run task
+type CommandResult struct {
+	// ExitCode is the exit code of the command; it is -1 if the command did not start or was killed
+	ExitCode int `json:"exitCode" yaml:"exitCode"`
+
+	// Stdout is the standard output of the command, truncated to its end if it is long
+	Stdout string `json:"stdout,omitempty" yaml:"stdout,omitempty"`
+
+	// Stderr is the standard error of the command, truncated to its end if it is long
+	Stderr string `json:"stderr,omitempty" yaml:"stderr,omitempty"`
+}
+
 // Insights records the number of versions in this experiment
 type Insights struct {
 	// NumVersions is the number of app versions detected by Iter8
@@ -88,6 +158,17 @@ type Insights struct {
 
 	// TaskData is a map of task names to the data produced by said task
 	TaskData map[string]interface{} `json:"taskData" yaml:"taskData"`
+
+	// EndpointVersions maps task names to the endpoints tested by said task,
+	// and each endpoint to the index of its version in VersionNames
+	EndpointVersions map[string]map[string]int `json:"endpointVersions,omitempty" yaml:"endpointVersions,omitempty"`
+
+	// EndpointErrors maps task names to the endpoints that said task failed to test,
+	// and each endpoint to the error of its load generator
+	EndpointErrors map[string]map[string]string `json:"endpointErrors,omitempty" yaml:"endpointErrors,omitempty"`
+
+	// StageData is a map of task names to the data produced by said task in each stage of the load profiles of its endpoints
+	StageData map[string]interface{} `json:"stageData,omitempty" yaml:"stageData,omitempty"`
 }
 
 // VersionInfo is basic information about a version
@@ -101,6 +182,9 @@ type VersionInfo struct {
 
 // TaskMeta provides common fields used across all tasks
 type TaskMeta struct {
+	// ID identifies this task, so that later tasks can reference its outputs (example, {{ .Outputs.login.stdout }})
+	// It must start with a letter and contain only letters, digits and underscores
+	ID *string `json:"id,omitempty" yaml:"id,omitempty"`
 	// Task is the name of the task
 	Task *string `json:"task,omitempty" yaml:"task,omitempty"`
 	// Run is the script used in a run task
@@ -109,6 +193,19 @@ type TaskMeta struct {
 	// If is the condition used to determine if this task needs to run
 	// If the condition is not satisfied, then it is skipped in an experiment
 	If *string `json:"if,omitempty" yaml:"if,omitempty"`
+	// Timeout is the maximum duration of a single attempt of this task. Specified in the Go duration string format (example, 5m).
+	// If unspecified, an attempt is limited only by the experiment deadline.
+	Timeout *string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Retries is the number of times this task is retried after a failed attempt. Default value is 0.
+	Retries *int `json:"retries,omitempty" yaml:"retries,omitempty"`
+	// Backoff is the duration to wait between attempts. Specified in the Go duration string format (example, 5s). Default value is 1s.
+	Backoff *string `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	// OnFailure determines what happens when this task fails. Valid values are abort and continue. Default value is continue.
+	// If abort, remaining tasks are not run; if continue, the experiment is marked as failed and remaining tasks are run.
+	OnFailure *string `json:"onFailure,omitempty" yaml:"onFailure,omitempty"`
+
+	// refs are the references in the inputs of the task, which are resolved when the task runs
+	refs []valueFromRef
 }
 
 // taskMetaWith enables unmarshaling of tasks
@@ -136,58 +233,45 @@ func (s *ExperimentSpec) UnmarshalJSON(data []byte) error {
 			return err
 		}
 
+		// references to secret values are resolved when the task runs
+		var refs []valueFromRef
+		if t.With != nil {
+			var err error
+			if _, refs, err = extractValueFrom("with", nil, t.With); err != nil {
+				log.Logger.Error(err)
+				return err
+			}
+		}
+
 		// get byte data for this task
 		tBytes, _ := json.Marshal(t)
 		var tsk Task
 		// this is a run task
 		if t.Run != nil {
 			log.Logger.Debug("found run task: ", *t.Run)
-			rt := &runTask{}
-			if err := json.Unmarshal(tBytes, rt); err != nil {
-				e := errors.New("json unmarshal error")
-				log.Logger.WithStackTrace(err.Error()).Error(e)
-				return e
-			}
-			tsk = rt
+			tsk = &runTask{}
 		} else {
 			// this is some other task
-			switch *t.Task {
-			case ReadinessTaskName:
-				rt := &readinessTask{}
-				if err := json.Unmarshal(tBytes, rt); err != nil {
-					e := errors.New("json unmarshal error")
-					log.Logger.WithStackTrace(err.Error()).Error(e)
-					return e
-				}
-				tsk = rt
-			case CollectHTTPTaskName:
-				cht := &collectHTTPTask{}
-				if err := json.Unmarshal(tBytes, cht); err != nil {
-					e := errors.New("json unmarshal error")
-					log.Logger.WithStackTrace(err.Error()).Error(e)
-					return e
-				}
-				tsk = cht
-			case CollectGRPCTaskName:
-				cgt := &collectGRPCTask{}
-				if err := json.Unmarshal(tBytes, cgt); err != nil {
-					e := errors.New("json unmarshal error")
-					log.Logger.WithStackTrace(err.Error()).Error(e)
-					return e
-				}
-				tsk = cgt
-			case NotifyTaskName:
-				nt := &notifyTask{}
-				if err := json.Unmarshal(tBytes, nt); err != nil {
-					e := errors.New("json unmarshal error")
-					log.Logger.WithStackTrace(err.Error()).Error(e)
-					return e
-				}
-				tsk = nt
-			default:
+			factory, ok := getTaskFactory(*t.Task)
+			if !ok {
 				log.Logger.Error("unknown task: " + *t.Task)
 				return errors.New("unknown task: " + *t.Task)
 			}
+			tsk = factory()
+		}
+		if err := json.Unmarshal(tBytes, tsk); err != nil {
+			e := errors.New("json unmarshal error")
+			log.Logger.WithStackTrace(err.Error()).Error(e)
+			return e
+		}
+		if len(refs) > 0 {
+			vt, ok := tsk.(valueFromTask)
+			if !ok {
+				err := fmt.Errorf("task %v does not support references to values", *getName(tsk))
+				log.Logger.Error(err)
+				return err
+			}
+			vt.setValueFromRefs(refs)
 		}
 		n := append(*s, tsk)
 		*s = n
@@ -219,6 +303,28 @@ func (in *Insights) TrackVersionStr(i int) string {
 	return in.VersionNames[i].Track + " (" + in.VersionNames[i].Version + ")"
 }
 
+// EndpointVersion returns the index in VersionNames of the version of an endpoint tested by a task
+func (in *Insights) EndpointVersion(task string, endpoint string) (int, bool) {
+	if in == nil || in.EndpointVersions == nil {
+		return 0, false
+	}
+	i, ok := in.EndpointVersions[task][endpoint]
+	if !ok || i >= len(in.VersionNames) {
+		return 0, false
+	}
+	return i, true
+}
+
+// EndpointVersionStr creates a string of the version name/track of an endpoint tested by a task for display purposes
+// Endpoints of unknown versions are considered to belong to the first version
+func (in *Insights) EndpointVersionStr(task string, endpoint string) string {
+	i, ok := in.EndpointVersion(task, endpoint)
+	if !ok {
+		return fmt.Sprintf("version %d", 0)
+	}
+	return in.TrackVersionStr(i)
+}
+
 // initResults initializes the results section of an experiment
 func (exp *Experiment) initResults(revision int) {
 	exp.Result = &ExperimentResult{
@@ -232,10 +338,10 @@ func (exp *Experiment) initResults(revision int) {
 	}
 }
 
-// initInsightsWithNumVersions is also going to initialize insights data structure
+// InitInsightsWithNumVersions is also going to initialize insights data structure
 // insights data structure contains metrics data structures, so this will also
 // init metrics
-func (r *ExperimentResult) initInsightsWithNumVersions(n int) error {
+func (r *ExperimentResult) InitInsightsWithNumVersions(n int) error {
 	if r.Insights == nil {
 		r.Insights = &Insights{
 			NumVersions: n,
@@ -252,6 +358,126 @@ func (r *ExperimentResult) initInsightsWithNumVersions(n int) error {
 	return nil
 }
 
+// initInsights initializes the insights data structure, if it is not already initialized
+func (r *ExperimentResult) initInsights() {
+	if r.Insights == nil {
+		r.Insights = &Insights{
+			NumVersions: 1,
+		}
+	}
+	if r.Insights.TaskData == nil {
+		r.Insights.TaskData = map[string]interface{}{}
+	}
+}
+
+// baselineTracks are the tracks of the versions that others are compared with
+var baselineTracks = []string{"stable", "baseline", "primary"}
+
+// trackRank orders versions so that baseline versions come first, followed by versions without a track
+func trackRank(v VersionInfo) int {
+	switch {
+	case slices.Contains(baselineTracks, v.Track):
+		return 0
+	case v.Track == "":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// setEndpointVersions records the versions of the endpoints tested by a task
+// Versions are numbered in the order in which they are first seen; endpoints are considered with baseline versions
+// (example, track stable) first, followed by versions without a track and then other versions (example, track candidate)
+func (r *ExperimentResult) setEndpointVersions(task string, versions map[string]VersionInfo) {
+	r.initInsights()
+	in := r.Insights
+	if in.EndpointVersions == nil {
+		// no versions have been recorded yet
+		in.VersionNames = nil
+		in.EndpointVersions = map[string]map[string]int{}
+	}
+
+	endpoints := make([]string, 0, len(versions))
+	for endpoint := range versions {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		vi, vj := versions[endpoints[i]], versions[endpoints[j]]
+		if ri, rj := trackRank(vi), trackRank(vj); ri != rj {
+			return ri < rj
+		}
+		if vi.Version != vj.Version {
+			return vi.Version < vj.Version
+		}
+		if vi.Track != vj.Track {
+			return vi.Track < vj.Track
+		}
+		return endpoints[i] < endpoints[j]
+	})
+
+	in.EndpointVersions[task] = map[string]int{}
+	for _, endpoint := range endpoints {
+		i := indexOfVersion(in.VersionNames, versions[endpoint])
+		if i < 0 {
+			in.VersionNames = append(in.VersionNames, versions[endpoint])
+			i = len(in.VersionNames) - 1
+		}
+		in.EndpointVersions[task][endpoint] = i
+	}
+	if len(in.VersionNames) > 0 {
+		in.NumVersions = len(in.VersionNames)
+	}
+}
+
+// setEndpointErrors records the errors of the endpoints that a task failed to test
+func (r *ExperimentResult) setEndpointErrors(task string, errs map[string]string) {
+	r.initInsights()
+	in := r.Insights
+	if len(errs) == 0 {
+		delete(in.EndpointErrors, task)
+		return
+	}
+	if in.EndpointErrors == nil {
+		in.EndpointErrors = map[string]map[string]string{}
+	}
+	in.EndpointErrors[task] = errs
+}
+
+// setStageData records the data produced by a task in each stage of the load profiles of its endpoints
+func (r *ExperimentResult) setStageData(task string, data HTTPStageResult) {
+	r.initInsights()
+	in := r.Insights
+	if len(data) == 0 {
+		delete(in.StageData, task)
+		return
+	}
+	if in.StageData == nil {
+		in.StageData = map[string]interface{}{}
+	}
+	in.StageData[task] = data
+}
+
+// inheritVersion fills in the fields of a version that are not specified from a base version
+func inheritVersion(v VersionInfo, base VersionInfo) VersionInfo {
+	if v.Version == "" {
+		v.Version = base.Version
+	}
+	if v.Track == "" {
+		v.Track = base.Track
+	}
+	return v
+}
+
+// indexOfVersion returns the index of a version in a list of versions, or -1 if it is not in the list
+func indexOfVersion(versions []VersionInfo, v VersionInfo) int {
+	for i := range versions {
+		if versions[i] == v {
+			return i
+		}
+	}
+	return -1
+}
+
 // Driver enables interacting with experiment result stored externally
 type Driver interface {
 	// Read the experiment
@@ -260,6 +486,10 @@ type Driver interface {
 	// Write the experiment
 	Write(e *Experiment) error
 
+	// ReadResult reads the experiment result that was previously written for the experiment, if any
+	// A nil result with no error is returned if no result was previously written
+	ReadResult(e *Experiment) (*ExperimentResult, error)
+
 	// GetRevision returns the experiment revision
 	GetRevision() int
 }
@@ -282,7 +512,8 @@ func (exp *Experiment) NoFailure() bool {
 }
 
 // run the experiment
-func (exp *Experiment) run(driver Driver) error {
+// If ctx is cancelled, the experiment is aborted; its finally tasks are run and its partial result is written
+func (exp *Experiment) run(ctx context.Context, driver Driver) error {
 	var err error
 
 	exp.driver = driver
@@ -293,52 +524,27 @@ func (exp *Experiment) run(driver Driver) error {
 	}
 	log.Logger.Debug("exp result exists now ... ")
 
-	log.Logger.Debugf("attempting to execute %v tasks", len(exp.Spec))
-	for i, t := range exp.Spec {
-		log.Logger.Info("task " + fmt.Sprintf("%v: %v", i+1, *getName(t)) + ": started")
-
-		shouldRun := true
-		// if task has a condition
-		if cond := getIf(t); cond != nil {
-			// condition evaluates to false ... then shouldRun is false
-			program, err := expr.Compile(*cond, expr.Env(exp), expr.AsBool())
-			if err != nil {
-				log.Logger.WithStackTrace(err.Error()).Error("unable to compile if clause")
-				return err
-			}
-
-			output, err := expr.Run(program, exp)
-			if err != nil {
-				log.Logger.WithStackTrace(err.Error()).Error("unable to run if clause")
-				return err
-			}
-
-			shouldRun = output.(bool)
-		}
-		if shouldRun {
-			err = t.run(exp)
-			if err != nil {
-				log.Logger.Error("task " + fmt.Sprintf("%v: %v", i+1, *getName(t)) + ": " + "failure")
-				exp.failExperiment()
-
-				err = driver.Write(exp)
-				if err != nil {
-					return err
-				}
-			}
-			log.Logger.Info("task " + fmt.Sprintf("%v: %v", i+1, *getName(t)) + ": " + "completed")
-		} else {
-			log.Logger.WithStackTrace(fmt.Sprint("false condition: ", *getIf(t))).Info("task " + fmt.Sprintf("%v: %v", i+1, *getName(t)) + ": " + "skipped")
-		}
+	deadline, err := exp.getDeadline(time.Now().Time)
+	if err != nil {
+		return err
+	}
 
-		exp.incrementNumCompletedTasks()
+	specCtx := ctx
+	if deadline != nil {
+		var cancel context.CancelFunc
+		specCtx, cancel = context.WithDeadlineCause(ctx, *deadline, errDeadlineExceeded)
+		defer cancel()
+	}
+	err = exp.runSpec(specCtx, driver)
 
-		err = driver.Write(exp)
-		if err != nil {
-			return err
-		}
+	// finally tasks always run, even if the spec failed, was aborted or ran out of time
+	if ferr := exp.runFinally(ctx, driver); err == nil {
+		err = ferr
 	}
-	return nil
+	if err == nil && exp.Result.Aborted {
+		err = errAborted
+	}
+	return err
 }
 
 // failExperiment sets the experiment failure status to true
@@ -346,31 +552,41 @@ func (exp *Experiment) failExperiment() {
 	exp.Result.Failure = true
 }
 
+// abortExperiment sets the experiment aborted status to true
+func (exp *Experiment) abortExperiment() {
+	exp.Result.Aborted = true
+}
+
+// haltExperiment sets the experiment halted status to true
+func (exp *Experiment) haltExperiment() {
+	exp.Result.Halted = true
+}
+
 // incrementNumCompletedTasks increments the number of completed tasks in the experiment
 func (exp *Experiment) incrementNumCompletedTasks() {
 	exp.Result.NumCompletedTasks++
 }
 
-// getIf returns the condition (if any) which determine
-// whether of not if this task needs to run
-func getIf(t Task) *string {
+// getTaskMeta returns the fields common to all tasks
+func getTaskMeta(t Task) TaskMeta {
 	var jsonBytes []byte
 	var tm TaskMeta
 	// convert t to jsonBytes
 	jsonBytes, _ = json.Marshal(t)
 	// convert jsonBytes to TaskMeta
 	_ = json.Unmarshal(jsonBytes, &tm)
-	return tm.If
+	return tm
+}
+
+// getIf returns the condition (if any) which determine
+// whether of not if this task needs to run
+func getIf(t Task) *string {
+	return getTaskMeta(t).If
 }
 
 // getName returns the name of this task
 func getName(t Task) *string {
-	var jsonBytes []byte
-	var tm TaskMeta
-	// convert t to jsonBytes
-	jsonBytes, _ = json.Marshal(t)
-	// convert jsonBytes to TaskMeta
-	_ = json.Unmarshal(jsonBytes, &tm)
+	tm := getTaskMeta(t)
 
 	if tm.Task == nil {
 		if tm.Run != nil {
@@ -392,8 +608,50 @@ func BuildExperiment(driver Driver) (*Experiment, error) {
 	return e, nil
 }
 
+// resumeResults replaces the results section of an experiment with the result
+// previously written for the same revision, if that result is from an interrupted run
+// Runs that were halted by a failed task with onFailure abort, or by the deadline, are not resumed
+func (exp *Experiment) resumeResults(driver Driver) error {
+	r, err := driver.ReadResult(exp)
+	if err != nil {
+		return err
+	}
+
+	if r == nil {
+		log.Logger.Debug("no previous experiment result found")
+		return nil
+	}
+
+	if r.Revision != exp.Result.Revision ||
+		r.Name != exp.Result.Name ||
+		r.Namespace != exp.Result.Namespace {
+		log.Logger.Debug("previous experiment result is for a different experiment or revision")
+		return nil
+	}
+
+	if r.NumCompletedTasks <= 0 || r.NumCompletedTasks >= len(exp.Spec) {
+		log.Logger.Debug("previous experiment result is not from an interrupted run")
+		return nil
+	}
+
+	if r.Halted {
+		log.Logger.Debug("previous experiment run was halted")
+		return nil
+	}
+
+	log.Logger.Infof("resuming experiment after %v completed tasks", r.NumCompletedTasks)
+	r.Iter8Version = MajorMinor
+	// a run aborted by a signal is resumed like any other interrupted run
+	r.Aborted = false
+	exp.Result = r
+	return nil
+}
+
 // RunExperiment runs an experiment
-func RunExperiment(driver Driver) error {
+// Unless fresh is true, an experiment whose previous run was interrupted
+// is resumed from the first task that did not complete
+// Cancelling ctx aborts the experiment; its partial result is written before RunExperiment returns
+func RunExperiment(ctx context.Context, fresh bool, driver Driver) error {
 	var exp *Experiment
 	var err error
 	if exp, err = BuildExperiment(driver); err != nil {
@@ -402,5 +660,11 @@ func RunExperiment(driver Driver) error {
 
 	exp.initResults(driver.GetRevision())
 
-	return exp.run(driver)
+	if !fresh {
+		if err = exp.resumeResults(driver); err != nil {
+			return err
+		}
+	}
+
+	return exp.run(ctx, driver)
 }
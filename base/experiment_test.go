@@ -1,11 +1,13 @@
 package base
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"testing"
 
 	"fortio.org/fortio/fhttp"
@@ -31,6 +33,23 @@ func TestReadExperiment(t *testing.T) {
 	assert.Equal(t, 1, len(e.Spec))
 }
 
+func TestReadExperimentWithFinally(t *testing.T) {
+	e := &Experiment{}
+	err := yaml.Unmarshal([]byte(`
+spec:
+- run: echo hello
+finally:
+- task: notify
+  with:
+    url: http://example.com
+- run: echo cleanup
+`), e)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(e.Spec))
+	assert.Equal(t, 2, len(e.Finally))
+	assert.Equal(t, NotifyTaskName, *getName(e.Finally[0]))
+}
+
 func TestRunningTasks(t *testing.T) {
 	// define METRICS_SERVER_URL
 	metricsServerURL := "http://iter8.default:8080"
@@ -40,7 +59,7 @@ func TestRunningTasks(t *testing.T) {
 	// create and configure HTTP endpoint for testing
 	mux, addr := fhttp.DynamicHTTPServer(false)
 	url := fmt.Sprintf("http://127.0.0.1:%d/get", addr.Port)
-	var verifyHandlerCalled bool
+	var verifyHandlerCalled atomic.Bool
 	mux.HandleFunc("/get", GetTrackingHandler(&verifyHandlerCalled))
 
 	_ = os.Chdir(t.TempDir())
@@ -68,11 +87,11 @@ func TestRunningTasks(t *testing.T) {
 		},
 	}
 	exp.initResults(1)
-	err = ct.run(exp)
+	err = ct.Run(context.Background(), exp)
 	assert.NoError(t, err)
 	assert.Equal(t, exp.Result.Insights.NumVersions, 1)
 	// sanity check -- handler was called
-	assert.True(t, verifyHandlerCalled)
+	assert.True(t, verifyHandlerCalled.Load())
 }
 
 func TestRunExperiment(t *testing.T) {
@@ -84,7 +103,7 @@ func TestRunExperiment(t *testing.T) {
 	// create and configure HTTP endpoint for testing
 	mux, addr := fhttp.DynamicHTTPServer(false)
 	url := fmt.Sprintf("http://127.0.0.1:%d/get", addr.Port)
-	var verifyHandlerCalled bool
+	var verifyHandlerCalled atomic.Bool
 	mux.HandleFunc("/get", GetTrackingHandler(&verifyHandlerCalled))
 
 	// mock metrics server
@@ -124,16 +143,75 @@ func TestRunExperiment(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(e.Spec))
 
-	err = RunExperiment(&mockDriver{e})
+	err = RunExperiment(context.Background(), false, &mockDriver{e})
 	assert.NoError(t, err)
 	assert.True(t, metricsServerCalled)
 	// sanity check -- handler was called
-	assert.True(t, verifyHandlerCalled)
+	assert.True(t, verifyHandlerCalled.Load())
 
 	assert.True(t, e.Completed())
 	assert.True(t, e.NoFailure())
 }
 
+func TestResumeResults(t *testing.T) {
+	spec := ExperimentSpec{
+		&runTask{TaskMeta: TaskMeta{Run: StringPointer("echo hello")}},
+		&runTask{TaskMeta: TaskMeta{Run: StringPointer("echo world")}},
+	}
+	previous := &ExperimentResult{
+		Name:              myName,
+		Namespace:         myNamespace,
+		Revision:          1,
+		NumCompletedTasks: 1,
+		Insights: &Insights{
+			NumVersions: 1,
+			TaskData:    map[string]interface{}{"hello": "world"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		previous *ExperimentResult
+		revision int
+		resumed  bool
+	}{
+		{name: "no previous result", previous: nil, revision: 1, resumed: false},
+		{name: "interrupted run", previous: previous, revision: 1, resumed: true},
+		{name: "different revision", previous: previous, revision: 2, resumed: false},
+		{name: "halted run", previous: &ExperimentResult{
+			Name:              myName,
+			Namespace:         myNamespace,
+			Revision:          1,
+			NumCompletedTasks: 1,
+			Failure:           true,
+			Halted:            true,
+		}, revision: 1, resumed: false},
+		{name: "completed run", previous: &ExperimentResult{
+			Name:              myName,
+			Namespace:         myNamespace,
+			Revision:          1,
+			NumCompletedTasks: 2,
+		}, revision: 1, resumed: false},
+	}
+
+	for _, test := range tests {
+		exp := &Experiment{
+			Metadata: ExperimentMetadata{Name: myName, Namespace: myNamespace},
+			Spec:     spec,
+		}
+		exp.initResults(test.revision)
+		err := exp.resumeResults(&mockDriver{&Experiment{Result: test.previous}})
+		assert.NoError(t, err, test.name)
+		if test.resumed {
+			assert.Equal(t, 1, exp.Result.NumCompletedTasks, test.name)
+			assert.Equal(t, "world", exp.Result.Insights.TaskData["hello"], test.name)
+		} else {
+			assert.Equal(t, 0, exp.Result.NumCompletedTasks, test.name)
+			assert.Nil(t, exp.Result.Insights, test.name)
+		}
+	}
+}
+
 func TestFailExperiment(t *testing.T) {
 	_ = os.Chdir(t.TempDir())
 	exp := Experiment{
@@ -162,6 +240,9 @@ func TestUnmarshalJSON(t *testing.T) {
 		{
 			specBytes: `[{"task":"notify"}]`,
 		},
+		{
+			specBytes: `[{"task":"assess"}]`,
+		},
 	}
 
 	for _, test := range tests {
@@ -205,10 +286,10 @@ func TestInitInsightsWithNumVersions(t *testing.T) {
 		},
 	}
 
-	err := r.initInsightsWithNumVersions(1)
+	err := r.InitInsightsWithNumVersions(1)
 	assert.NoError(t, err)
 
 	// Mismatching version numbers
-	err = r.initInsightsWithNumVersions(2)
+	err = r.InitInsightsWithNumVersions(2)
 	assert.Error(t, err)
 }
@@ -24,3 +24,38 @@ func TestTrackVersionStr(t *testing.T) {
 		})
 	}
 }
+
+func TestSetEndpointVersions(t *testing.T) {
+	r := &ExperimentResult{}
+	r.setEndpointVersions(CollectHTTPTaskName, map[string]VersionInfo{
+		"stable":    {Track: "stable", Version: "v1"},
+		"candidate": {Track: "candidate", Version: "v2"},
+		"health":    {Track: "stable", Version: "v1"},
+	})
+	// the stable version is the first version, whatever the names of the endpoints
+	assert.Equal(t, 2, r.Insights.NumVersions)
+	assert.Equal(t, []VersionInfo{{Track: "stable", Version: "v1"}, {Track: "candidate", Version: "v2"}}, r.Insights.VersionNames)
+	assert.Equal(t, map[string]int{"candidate": 1, "health": 0, "stable": 0}, r.Insights.EndpointVersions[CollectHTTPTaskName])
+	assert.Equal(t, "stable (v1)", r.Insights.EndpointVersionStr(CollectHTTPTaskName, "stable"))
+
+	// versions are shared across tasks
+	r.setEndpointVersions(CollectGRPCTaskName, map[string]VersionInfo{
+		"a": {Track: "stable", Version: "v1"},
+		"b": {},
+	})
+	assert.Equal(t, 3, r.Insights.NumVersions)
+	assert.Equal(t, map[string]int{"a": 0, "b": 2}, r.Insights.EndpointVersions[CollectGRPCTaskName])
+
+	assert.Equal(t, "stable (v1)", r.Insights.EndpointVersionStr(CollectGRPCTaskName, "a"))
+	assert.Equal(t, "version 2", r.Insights.EndpointVersionStr(CollectGRPCTaskName, "b"))
+	assert.Equal(t, "version 0", r.Insights.EndpointVersionStr(CollectGRPCTaskName, "c"))
+	var in *Insights
+	assert.Equal(t, "version 0", in.EndpointVersionStr(CollectHTTPTaskName, "a"))
+}
+
+func TestSetEndpointVersionsUnlabelled(t *testing.T) {
+	r := &ExperimentResult{}
+	r.setEndpointVersions(CollectHTTPTaskName, map[string]VersionInfo{"http://httpbin.default/get": {}})
+	assert.Equal(t, 1, r.Insights.NumVersions)
+	assert.Equal(t, "version 0", r.Insights.EndpointVersionStr(CollectHTTPTaskName, "http://httpbin.default/get"))
+}
@@ -0,0 +1,317 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	log "github.com/iter8-tools/iter8/base/log"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// K8sTaskName is the task name
+	K8sTaskName = "k8s"
+
+	// K8sActionApply server-side applies a manifest
+	K8sActionApply = "apply"
+	// K8sActionPatch patches an object
+	K8sActionPatch = "patch"
+	// K8sActionScale sets the number of replicas of a workload through its scale subresource
+	K8sActionScale = "scale"
+	// K8sActionDelete deletes an object
+	K8sActionDelete = "delete"
+
+	// PatchTypeMerge is a JSON merge patch
+	PatchTypeMerge = "merge"
+	// PatchTypeJSON is a JSON patch
+	PatchTypeJSON = "json"
+	// PatchTypeStrategic is a strategic merge patch, which is supported by built-in resources only
+	PatchTypeStrategic = "strategic"
+
+	// defaultFieldManager is the field manager of objects applied by the k8s task
+	defaultFieldManager = "iter8"
+)
+
+// patchTypes are the patch types of the k8s task
+var patchTypes = map[string]types.PatchType{
+	PatchTypeMerge:     types.MergePatchType,
+	PatchTypeJSON:      types.JSONPatchType,
+	PatchTypeStrategic: types.StrategicMergePatchType,
+}
+
+// k8sInputs are the inputs of the k8s task
+// The object is identified by the manifest for apply, and by group, version, resource and name otherwise
+type k8sInputs struct {
+	// Action is one of apply, patch, scale and delete
+	Action string `json:"action" yaml:"action"`
+	// Manifest is the object to apply, as a YAML or JSON string or as an object; templates in the string are executed when the task runs
+	Manifest interface{} `json:"manifest,omitempty" yaml:"manifest,omitempty"`
+	// Group of the object. Optional. Default value is the group of the manifest, or "".
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	// Version of the object. Required, except for apply, where it is the version of the manifest.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Resource type of the object. Required, except for apply, where it is found from the kind of the manifest when unspecified.
+	Resource string `json:"resource,omitempty" yaml:"resource,omitempty"`
+	// Namespace of the object. Optional. Default value is the namespace of the manifest, or the namespace of the experiment.
+	Namespace *string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// Name of the object. Required, except for apply, where it is the name in the manifest.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Patch is the patch, as a YAML or JSON string or as an object (example, {metadata: {annotations: {iter8.tools/weight: "80"}}})
+	Patch interface{} `json:"patch,omitempty" yaml:"patch,omitempty"`
+	// PatchType is one of merge, json and strategic. Default value is merge.
+	PatchType *string `json:"patchType,omitempty" yaml:"patchType,omitempty"`
+	// Replicas is the number of replicas to scale to
+	Replicas *int64 `json:"replicas,omitempty" yaml:"replicas,omitempty"`
+	// FieldManager is the field manager of applied objects. Default value is iter8.
+	FieldManager string `json:"fieldManager,omitempty" yaml:"fieldManager,omitempty"`
+	// Force applies the manifest even if it conflicts with fields owned by other field managers
+	Force bool `json:"force,omitempty" yaml:"force,omitempty"`
+	// IgnoreNotFound makes delete succeed if the object does not exist
+	IgnoreNotFound bool `json:"ignoreNotFound,omitempty" yaml:"ignoreNotFound,omitempty"`
+}
+
+// k8sTask applies, patches, scales or deletes a Kubernetes object
+// Combined with if conditions, it lets an experiment promote or roll back a version based on its own results
+type k8sTask struct {
+	TaskMeta
+	With k8sInputs `json:"with" yaml:"with"`
+}
+
+// InitializeDefaults sets default values for the k8s task
+func (t *k8sTask) InitializeDefaults() {
+	if t.With.PatchType == nil {
+		t.With.PatchType = StringPointer(PatchTypeMerge)
+	}
+	if t.With.FieldManager == "" {
+		t.With.FieldManager = defaultFieldManager
+	}
+}
+
+// ValidateInputs validates task inputs
+func (t *k8sTask) ValidateInputs() error {
+	errs := []error{}
+	switch t.With.Action {
+	case K8sActionApply:
+		if t.With.Manifest == nil {
+			errs = append(errs, newFieldError("with.manifest", "manifest is required"))
+		} else if s, ok := t.With.Manifest.(string); !ok || !isTemplate(s) {
+			// templates are executed when the task runs, so they are not checked
+			if _, err := decodeManifest(t.With.Manifest); err != nil {
+				errs = append(errs, newFieldError("with.manifest", "%v", err))
+			}
+		}
+	case K8sActionPatch, K8sActionScale, K8sActionDelete:
+		// the version is part of the path of the object in the API
+		if t.With.Version == "" {
+			errs = append(errs, newFieldError("with.version", "version is required"))
+		}
+		if t.With.Resource == "" {
+			errs = append(errs, newFieldError("with.resource", "resource is required"))
+		}
+		if t.With.Name == "" {
+			errs = append(errs, newFieldError("with.name", "name is required"))
+		}
+	case "":
+		errs = append(errs, newFieldError("with.action", "action is required"))
+	default:
+		errs = append(errs, newFieldError("with.action", "invalid action %q; must be one of %v, %v, %v or %v",
+			t.With.Action, K8sActionApply, K8sActionPatch, K8sActionScale, K8sActionDelete))
+	}
+
+	if t.With.Action == K8sActionPatch && t.With.Patch == nil {
+		errs = append(errs, newFieldError("with.patch", "patch is required"))
+	}
+	if t.With.PatchType != nil {
+		if _, ok := patchTypes[*t.With.PatchType]; !ok {
+			errs = append(errs, newFieldError("with.patchType", "invalid patch type %q; must be one of %v, %v or %v",
+				*t.With.PatchType, PatchTypeMerge, PatchTypeJSON, PatchTypeStrategic))
+		}
+	}
+	if t.With.Action == K8sActionScale {
+		if t.With.Replicas == nil {
+			errs = append(errs, newFieldError("with.replicas", "replicas is required"))
+		} else if *t.With.Replicas < 0 {
+			errs = append(errs, newFieldError("with.replicas", "must not be negative"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// decodeManifest returns the object of a manifest, given as a YAML or JSON string or as an object
+func decodeManifest(m interface{}) (*unstructured.Unstructured, error) {
+	b, err := toJSON(m)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(b); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if obj.GetName() == "" {
+		return nil, errors.New("invalid manifest: metadata.name is required")
+	}
+	return obj, nil
+}
+
+// toJSON returns the JSON form of a value, given as a YAML or JSON string or as a decoded value
+func toJSON(v interface{}) ([]byte, error) {
+	if s, ok := v.(string); ok {
+		return yaml.YAMLToJSON([]byte(s))
+	}
+	return json.Marshal(v)
+}
+
+// Run executes the task
+// The resource version of the object is published as the resourceVersion output of the task, except for delete
+func (t *k8sTask) Run(ctx context.Context, exp *Experiment) error {
+	err := t.ValidateInputs()
+	if err != nil {
+		return err
+	}
+	if err = kd.initKube(); err != nil {
+		return err
+	}
+	t.InitializeDefaults()
+
+	var obj *unstructured.Unstructured
+	switch t.With.Action {
+	case K8sActionApply:
+		obj, err = t.apply(ctx)
+	case K8sActionPatch:
+		obj, err = t.patch(ctx)
+	case K8sActionScale:
+		obj, err = t.scale(ctx)
+	case K8sActionDelete:
+		err = t.delete(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if obj != nil {
+		exp.setTaskOutput(t.TaskMeta, resourceVersionOutput, obj.GetResourceVersion())
+	}
+	return nil
+}
+
+// namespace returns the namespace of the object of the task; manifestNamespace is the namespace in the manifest, if any
+func (t *k8sTask) namespace(manifestNamespace string) string {
+	if t.With.Namespace != nil {
+		return *t.With.Namespace
+	}
+	if manifestNamespace != "" {
+		return manifestNamespace
+	}
+	return kd.Namespace()
+}
+
+// gvr returns the resource of the object of the task
+func (t *k8sTask) gvr() schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    t.With.Group,
+		Version:  t.With.Version,
+		Resource: t.With.Resource,
+	}
+}
+
+// apply server-side applies the manifest of the task
+func (t *k8sTask) apply(ctx context.Context) (*unstructured.Unstructured, error) {
+	obj, err := decodeManifest(t.With.Manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	gvk := obj.GroupVersionKind()
+	gvr := schema.GroupVersionResource{Group: gvk.Group, Version: gvk.Version, Resource: t.With.Resource}
+	if gvr.Resource == "" {
+		// the resource of the kind is found with the discovery API
+		mapper, err := kd.EnvSettings.RESTClientGetter().ToRESTMapper()
+		if err != nil {
+			e := errors.New("unable to get Kubernetes REST mapper")
+			log.Logger.WithStackTrace(err.Error()).Error(e)
+			return nil, e
+		}
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			e := fmt.Errorf("unable to find the resource of kind %v", gvk.Kind)
+			log.Logger.WithStackTrace(err.Error()).Error(e)
+			return nil, e
+		}
+		gvr = mapping.Resource
+	}
+
+	ns := t.namespace(obj.GetNamespace())
+	obj.SetNamespace(ns)
+	log.Logger.Info("applying ", gvr.Resource, ": ", obj.GetName(), " in namespace ", ns)
+	applied, err := kd.dynamicClient.Resource(gvr).Namespace(ns).Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+		FieldManager: t.With.FieldManager,
+		Force:        t.With.Force,
+	})
+	if err != nil {
+		e := fmt.Errorf("unable to apply %v %v/%v", gvr.Resource, ns, obj.GetName())
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	return applied, nil
+}
+
+// patch patches the object of the task
+func (t *k8sTask) patch(ctx context.Context) (*unstructured.Unstructured, error) {
+	b, err := toJSON(t.With.Patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+	ns := t.namespace("")
+	log.Logger.Info("patching ", t.With.Resource, ": ", t.With.Name, " in namespace ", ns)
+	obj, err := kd.dynamicClient.Resource(t.gvr()).Namespace(ns).Patch(ctx, t.With.Name, patchTypes[*t.With.PatchType], b, metav1.PatchOptions{
+		FieldManager: t.With.FieldManager,
+	})
+	if err != nil {
+		e := fmt.Errorf("unable to patch %v %v/%v", t.With.Resource, ns, t.With.Name)
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	return obj, nil
+}
+
+// scale sets the number of replicas of the object of the task
+func (t *k8sTask) scale(ctx context.Context) (*unstructured.Unstructured, error) {
+	b, _ := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{"replicas": *t.With.Replicas},
+	})
+	ns := t.namespace("")
+	log.Logger.Info("scaling ", t.With.Resource, ": ", t.With.Name, " in namespace ", ns, " to ", *t.With.Replicas, " replicas")
+	obj, err := kd.dynamicClient.Resource(t.gvr()).Namespace(ns).Patch(ctx, t.With.Name, types.MergePatchType, b, metav1.PatchOptions{
+		FieldManager: t.With.FieldManager,
+	}, "scale")
+	if err != nil {
+		e := fmt.Errorf("unable to scale %v %v/%v", t.With.Resource, ns, t.With.Name)
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	return obj, nil
+}
+
+// delete deletes the object of the task
+func (t *k8sTask) delete(ctx context.Context) error {
+	ns := t.namespace("")
+	log.Logger.Info("deleting ", t.With.Resource, ": ", t.With.Name, " in namespace ", ns)
+	err := kd.dynamicClient.Resource(t.gvr()).Namespace(ns).Delete(ctx, t.With.Name, metav1.DeleteOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) && t.With.IgnoreNotFound {
+			log.Logger.Info(t.With.Resource, ": ", t.With.Name, " not found in namespace ", ns)
+			return nil
+		}
+		e := fmt.Errorf("unable to delete %v %v/%v", t.With.Resource, ns, t.With.Name)
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package base
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/cli"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+var deploymentsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+// setupFakeDeployment creates a fake cluster with a deployment
+func setupFakeDeployment(t *testing.T, ns string, name string) {
+	*kd = *NewFakeKubeDriver(cli.New())
+	_, err := kd.dynamicClient.Resource(deploymentsGVR).Namespace(ns).Create(context.Background(), &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": name, "namespace": ns},
+			"spec":       map[string]interface{}{"replicas": int64(1)},
+		},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+}
+
+// getFakeDeployment returns a deployment of the fake cluster
+func getFakeDeployment(t *testing.T, ns string, name string) *unstructured.Unstructured {
+	obj, err := kd.dynamicClient.Resource(deploymentsGVR).Namespace(ns).Get(context.Background(), name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	return obj
+}
+
+func TestValidateK8sInputs(t *testing.T) {
+	for _, tc := range []struct {
+		with k8sInputs
+		errs []string
+	}{
+		{with: k8sInputs{}, errs: []string{"with.action: action is required"}},
+		{with: k8sInputs{Action: "create"}, errs: []string{`with.action: invalid action "create"`}},
+		{with: k8sInputs{Action: K8sActionApply}, errs: []string{"with.manifest: manifest is required"}},
+		{with: k8sInputs{Action: K8sActionApply, Manifest: "kind: Deployment"}, errs: []string{"metadata.name is required"}},
+		{with: k8sInputs{Action: K8sActionApply, Manifest: "{{ .Outputs.render.stdout }}"}},
+		{with: k8sInputs{Action: K8sActionPatch, PatchType: StringPointer("apply")}, errs: []string{
+			"with.version: version is required", "with.resource: resource is required", "with.name: name is required", "with.patch: patch is required", `with.patchType: invalid patch type "apply"`,
+		}},
+		{with: k8sInputs{Action: K8sActionScale, Version: "v1", Resource: "deployments", Name: "app", Replicas: int64Pointer(-1)}, errs: []string{"with.replicas: must not be negative"}},
+		{with: k8sInputs{Action: K8sActionDelete, Group: "apps", Resource: "deployments", Name: "app"}, errs: []string{"with.version: version is required"}},
+		{with: k8sInputs{Action: K8sActionDelete, Group: "apps", Version: "v1", Resource: "deployments", Name: "app"}},
+	} {
+		err := (&k8sTask{With: tc.with}).ValidateInputs()
+		if len(tc.errs) == 0 {
+			assert.NoError(t, err)
+			continue
+		}
+		assert.Error(t, err)
+		for _, e := range tc.errs {
+			assert.Contains(t, err.Error(), e)
+		}
+	}
+}
+
+func TestRunK8s(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	ns, name := "default", "candidate"
+	setupFakeDeployment(t, ns, name)
+
+	exp := &Experiment{Result: &ExperimentResult{}}
+	exp.initResults(1)
+
+	// patch the weight of the candidate
+	var pt k8sTask
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+id: promote
+task: k8s
+with:
+  action: patch
+  group: apps
+  version: v1
+  resource: deployments
+  namespace: default
+  name: candidate
+  patch:
+    metadata:
+      annotations:
+        iter8.tools/weight: "80"
+`), &pt))
+	assert.NoError(t, pt.Run(context.Background(), exp))
+	assert.Equal(t, "80", getFakeDeployment(t, ns, name).GetAnnotations()["iter8.tools/weight"])
+	assert.Contains(t, exp.Result.Outputs["promote"], resourceVersionOutput)
+
+	// JSON patches are strings
+	pt.With.PatchType = StringPointer(PatchTypeJSON)
+	pt.With.Patch = `[{"op": "replace", "path": "/metadata/annotations/iter8.tools~1weight", "value": "100"}]`
+	assert.NoError(t, pt.Run(context.Background(), exp))
+	assert.Equal(t, "100", getFakeDeployment(t, ns, name).GetAnnotations()["iter8.tools/weight"])
+
+	// scale the candidate
+	st := &k8sTask{With: k8sInputs{
+		Action: K8sActionScale, Group: "apps", Version: "v1", Resource: "deployments", Namespace: StringPointer(ns), Name: name, Replicas: int64Pointer(3),
+	}}
+	assert.NoError(t, st.Run(context.Background(), exp))
+	replicas, _, _ := unstructured.NestedInt64(getFakeDeployment(t, ns, name).Object, "spec", "replicas")
+	assert.Equal(t, int64(3), replicas)
+
+	// apply a manifest; the namespace is that of the manifest
+	at := &k8sTask{With: k8sInputs{
+		Action:   K8sActionApply,
+		Resource: "deployments",
+		Manifest: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: candidate
+  namespace: default
+  labels:
+    track: stable
+`,
+	}}
+	// the fake client cannot apply unstructured objects, so the applied object is captured instead
+	var applied *unstructured.Unstructured
+	kd.dynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pa := action.(k8stesting.PatchAction)
+		if pa.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		applied = &unstructured.Unstructured{}
+		return true, applied, applied.UnmarshalJSON(pa.GetPatch())
+	})
+	assert.NoError(t, at.Run(context.Background(), exp))
+	assert.Equal(t, map[string]string{"track": "stable"}, applied.GetLabels())
+	assert.Equal(t, ns, applied.GetNamespace())
+
+	// delete the candidate
+	dt := &k8sTask{With: k8sInputs{
+		Action: K8sActionDelete, Group: "apps", Version: "v1", Resource: "deployments", Namespace: StringPointer(ns), Name: name,
+	}}
+	assert.NoError(t, dt.Run(context.Background(), exp))
+	_, err := kd.dynamicClient.Resource(deploymentsGVR).Namespace(ns).Get(context.Background(), name, metav1.GetOptions{})
+	assert.Error(t, err)
+
+	// objects that do not exist cannot be deleted, unless this is ignored
+	assert.ErrorContains(t, dt.Run(context.Background(), exp), "unable to delete deployments default/candidate")
+	dt.With.IgnoreNotFound = true
+	assert.NoError(t, dt.Run(context.Background(), exp))
+	assert.ErrorContains(t, pt.Run(context.Background(), exp), "unable to patch deployments default/candidate")
+}
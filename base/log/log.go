@@ -31,12 +31,12 @@ var Logger *Iter8Logger
 // init initializes the logger.
 func init() {
 	Logger = &Iter8Logger{logrus.New()}
-	Logger.SetFormatter(&logrus.TextFormatter{
+	Logger.SetFormatter(redactingFormatter{&logrus.TextFormatter{
 		TimestampFormat: "2006-01-02 15:04:05",
 		FullTimestamp:   true,
 		DisableQuote:    true,
 		DisableSorting:  true,
-	})
+	}})
 
 	Logger.SetLevel(Level)
 }
@@ -0,0 +1,77 @@
+package log
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Redacted replaces secret values in logs and in results
+	Redacted = "[redacted]"
+	// minSecretLength is the length in bytes of the shortest secret that is redacted
+	// Shorter values, such as 1 or true, are common in logs and results, which would be corrupted by their redaction
+	minSecretLength = 4
+)
+
+var (
+	secretsMu sync.RWMutex
+	// secrets are the values that are redacted
+	secrets = map[string]bool{}
+)
+
+// AddSecret registers a value that is redacted from now on
+// Values shorter than minSecretLength are not redacted
+func AddSecret(s string) {
+	if s == "" {
+		return
+	}
+	if len(s) < minSecretLength {
+		Logger.Warnf("secret value shorter than %d bytes is not redacted", minSecretLength)
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	secrets[s] = true
+}
+
+// Redact replaces the secret values in s, including their JSON and URL escaped forms
+// Longer secrets are replaced first, so that secrets that contain others are fully redacted
+func Redact(s string) string {
+	secretsMu.RLock()
+	sorted := make([]string, 0, len(secrets))
+	for secret := range secrets {
+		sorted = append(sorted, secret)
+	}
+	secretsMu.RUnlock()
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	for _, secret := range sorted {
+		forms := []string{secret, url.QueryEscape(secret), url.PathEscape(secret)}
+		if b, err := json.Marshal(secret); err == nil {
+			forms = append(forms, string(b[1:len(b)-1]))
+		}
+		for _, form := range forms {
+			s = strings.ReplaceAll(s, form, Redacted)
+		}
+	}
+	return s
+}
+
+// redactingFormatter redacts secret values in log entries formatted by another formatter
+type redactingFormatter struct {
+	logrus.Formatter
+}
+
+// Format formats a log entry, and redacts secret values in it
+func (f redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	b, err := f.Formatter.Format(entry)
+	if err != nil {
+		return b, err
+	}
+	return []byte(Redact(string(b))), nil
+}
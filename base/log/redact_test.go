@@ -0,0 +1,41 @@
+package log
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	AddSecret("")
+	AddSecret("s3cret")
+	AddSecret("s3cret&more")
+
+	assert.Equal(t, "token "+Redacted, Redact("token s3cret"))
+	assert.Equal(t, "?a="+Redacted, Redact("?a=s3cret%26more"))
+	assert.Equal(t, "nothing to hide", Redact("nothing to hide"))
+
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(redactingFormatter{&logrus.TextFormatter{DisableTimestamp: true}})
+	l.Info("Authorization: Bearer s3cret")
+	assert.NotContains(t, buf.String(), "s3cret")
+	assert.Contains(t, buf.String(), Redacted)
+}
+
+func TestRedactShortSecret(t *testing.T) {
+	var buf bytes.Buffer
+	out := Logger.Out
+	Logger.SetOutput(&buf)
+	defer Logger.SetOutput(out)
+
+	// short values would corrupt every log line that contains them
+	AddSecret("true")
+	AddSecret("1")
+	assert.Contains(t, buf.String(), "secret value shorter than 4 bytes is not redacted")
+
+	assert.Equal(t, "ready: 1 "+Redacted, Redact("ready: 1 true"))
+}
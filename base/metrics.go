@@ -3,7 +3,9 @@ package base
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 
@@ -80,9 +82,71 @@ func callMetricsService(method, metricsServerURL, path string, queryParams map[s
 }
 
 // PutExperimentResultToMetricsService sends the test result to the metrics service
+// Secret values resolved by tasks are redacted from the result
 func PutExperimentResultToMetricsService(metricsServerURL, namespace, experiment string, experimentResult *ExperimentResult) error {
+	redacted, err := redactResult(experimentResult)
+	if err != nil {
+		e := errors.New("unable to redact test result")
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return e
+	}
 	return callMetricsService(http.MethodPut, metricsServerURL, TestResultPath, map[string]string{
 		"namespace": namespace,
 		"test":      experiment,
-	}, experimentResult)
+	}, redacted)
+}
+
+// GetExperimentResultFromMetricsService gets the test result from the metrics service
+// If the metrics service has no result for the test, a nil result is returned with no error
+func GetExperimentResultFromMetricsService(metricsServerURL, namespace, experiment string) (*ExperimentResult, error) {
+	// handle URL and URL parameters
+	u, err := url.ParseRequestURI(metricsServerURL + TestResultPath)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Add("namespace", namespace)
+	params.Add("test", experiment)
+	u.RawQuery = params.Encode()
+	urlStr := fmt.Sprintf("%v", u)
+
+	log.Logger.Trace(fmt.Sprintf("call metrics service URL: %s", urlStr))
+
+	// send request
+	client := &http.Client{}
+	resp, err := client.Get(urlStr)
+	if err != nil {
+		log.Logger.Error("could not send request to metrics server: ", err)
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// no result has been stored for this test
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Logger.Error("could not read response body from metrics server: ", err)
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("metrics server returned status code %d: %s", resp.StatusCode, string(body))
+		log.Logger.Error(err)
+		return nil, err
+	}
+
+	result := &ExperimentResult{}
+	err = json.Unmarshal(body, result)
+	if err != nil {
+		log.Logger.Error("cannot JSON unmarshal experiment result from metrics server: ", err)
+		return nil, err
+	}
+
+	return result, nil
 }
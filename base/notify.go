@@ -2,17 +2,29 @@ package base
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
-
+	"text/template"
 	"time"
 
 	"github.com/iter8-tools/iter8/base/log"
 )
 
 // notifyInputs is the input to the notify task
+// At most one of payloadTemplate, payloadTemplateFile, payloadTemplateName and payloadTemplateURL may be specified
 type notifyInputs struct {
 	// URL is the URL of the notification hook
 	URL string `json:"url" yaml:"url"`
@@ -26,19 +38,68 @@ type notifyInputs struct {
 	// Headers is the set of HTTP headers that need to be sent
 	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
 
+	// PayloadTemplate is the request payload template
+	// It is executed with the summary of the experiment when the notification is sent
+	PayloadTemplate string `json:"payloadTemplate,omitempty" yaml:"payloadTemplate,omitempty"`
+
+	// PayloadTemplateFile is the path of a file with the request payload template
+	PayloadTemplateFile string `json:"payloadTemplateFile,omitempty" yaml:"payloadTemplateFile,omitempty"`
+
+	// PayloadTemplateName is the name of a request payload template that is built into Iter8 (slack, msteams, github or json)
+	PayloadTemplateName string `json:"payloadTemplateName,omitempty" yaml:"payloadTemplateName,omitempty"`
+
 	// URL is the URL of the request payload template that should be used
 	PayloadTemplateURL string `json:"payloadTemplateURL,omitempty" yaml:"payloadTemplateURL,omitempty"`
 
+	// Timeout is the timeout of each request (example, 10s); optional. Default is 30s.
+	Timeout *string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// Retries is the number of times a request that fails with a network error, or a 429 or 5xx status code, is retried; optional. Default is 0.
+	Retries *int `json:"retries,omitempty" yaml:"retries,omitempty"`
+
+	// Backoff is the duration before the first retry; it doubles after each retry (example, 2s); optional. Default is 1s.
+	Backoff *string `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+
+	// Signature signs the payload of requests so that receivers can verify that they are sent by Iter8; optional
+	Signature *notifySignature `json:"signature,omitempty" yaml:"signature,omitempty"`
+
 	// SoftFailure indicates the task and experiment should not fail if the task
 	// cannot successfully send a request to the notification hook
 	SoftFailure bool `json:"softFailure" yaml:"softFailure"`
 }
 
+// notifySignature is an HMAC-SHA256 signature of the payload, sent in a header as sha256=<hex digest>
+type notifySignature struct {
+	// Secret is the key shared with the receiver; use valueFrom to read it from a Kubernetes secret
+	Secret string `json:"secret" yaml:"secret"`
+
+	// Header is the name of the header with the signature; optional. Default is X-Iter8-Signature-256.
+	Header string `json:"header,omitempty" yaml:"header,omitempty"`
+}
+
 const (
 	// NotifyTaskName is the task name
 	NotifyTaskName = "notify"
+
+	// payloadTemplatePath is the path of the inline payload template, which is executed by the task rather than before it runs
+	payloadTemplatePath = "with.payloadTemplate"
+
+	// defaultNotifyTimeout is the default timeout of notification requests
+	defaultNotifyTimeout = "30s"
+	// defaultNotifyBackoff is the default duration before the first retry of a notification request
+	defaultNotifyBackoff = "1s"
+	// defaultSignatureHeader is the default header with the signature of the payload
+	defaultSignatureHeader = "X-Iter8-Signature-256"
 )
 
+// notifyTemplates are the payload templates built into Iter8
+//
+//go:embed templates/notify/*.tpl
+var notifyTemplates embed.FS
+
+// notifyTemplateNames are the names of the payload templates built into Iter8
+var notifyTemplateNames = []string{"slack", "msteams", "github", "json"}
+
 // notifyTask sends notifications
 type notifyTask struct {
 	TaskMeta
@@ -66,109 +127,335 @@ type Summary struct {
 
 	// Experiment is the experiment struct
 	Experiment *Experiment `json:"experiment" yaml:"experiment"`
+
+	// SLOsPassed is true if every SLO and objective of the assess task is satisfied; it is nil if the assess task has not run
+	SLOsPassed *bool `json:"slosPassed,omitempty" yaml:"slosPassed,omitempty"`
+
+	// SLOs are the verdicts of the assess task
+	SLOs []SLOResult `json:"slos,omitempty" yaml:"slos,omitempty"`
+
+	// Tasks are the execution records of the tasks that have run
+	Tasks []TaskResult `json:"tasks,omitempty" yaml:"tasks,omitempty"`
+
+	// Endpoints are the key metrics of the endpoints tested by the http and grpc tasks
+	Endpoints []EndpointSummary `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
+
+	// FailureReasons explain why the experiment failed; there is one for each failed task and each SLO that is not satisfied
+	FailureReasons []string `json:"failureReasons,omitempty" yaml:"failureReasons,omitempty"`
+
+	// Result is the result of the experiment
+	Result *ExperimentResult `json:"result,omitempty" yaml:"result,omitempty"`
+}
+
+// EndpointSummary is the key metrics of an endpoint tested by the http or grpc task
+// Latencies are in milliseconds
+type EndpointSummary struct {
+	// Task is the name of the task that tested the endpoint
+	Task string `json:"task" yaml:"task"`
+
+	// Endpoint is the name of the endpoint
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+
+	// Version is the version and track of the endpoint, if they are known (example, candidate (v2))
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+
+	// RequestCount is the number of requests sent to the endpoint
+	RequestCount int64 `json:"requestCount" yaml:"requestCount"`
+
+	// ErrorCount is the number of requests that failed
+	ErrorCount int64 `json:"errorCount" yaml:"errorCount"`
+
+	// ErrorRate is the fraction of requests that failed
+	ErrorRate float64 `json:"errorRate" yaml:"errorRate"`
+
+	// LatencyMean is the mean latency
+	LatencyMean float64 `json:"latencyMean" yaml:"latencyMean"`
+
+	// LatencyPercentiles maps percentiles (example, 99.9) to latencies
+	LatencyPercentiles map[string]float64 `json:"latencyPercentiles,omitempty" yaml:"latencyPercentiles,omitempty"`
 }
 
 // getSummary gets the values for the payload template
 func getSummary(exp *Experiment) map[string]Summary {
-	return map[string]Summary{
-		"Summary": {
-			TimeStamp:         time.Now().String(),
-			Completed:         exp.Completed(),
-			NoTaskFailures:    exp.NoFailure(),
-			NumTasks:          len(exp.Spec),
-			NumCompletedTasks: exp.Result.NumCompletedTasks,
-			Experiment: &Experiment{
-				Metadata: ExperimentMetadata{
-					Name:      exp.Metadata.Name,
-					Namespace: exp.Metadata.Namespace,
-				},
+	summary := Summary{
+		TimeStamp:         time.Now().String(),
+		Completed:         exp.Completed(),
+		NoTaskFailures:    exp.NoFailure(),
+		NumTasks:          len(exp.Spec),
+		NumCompletedTasks: exp.Result.NumCompletedTasks,
+		Experiment: &Experiment{
+			Metadata: ExperimentMetadata{
+				Name:      exp.Metadata.Name,
+				Namespace: exp.Metadata.Namespace,
 			},
 		},
+		Tasks:  exp.Result.TaskResults,
+		Result: exp.Result,
+	}
+
+	// the summary is best effort; results that cannot be read are left out
+	assessResult := AssessResult{}
+	if ok, err := getTaskData(exp, AssessTaskName, &assessResult); err != nil {
+		log.Logger.WithStackTrace(err.Error()).Error("cannot read assess task data")
+	} else if ok {
+		summary.SLOsPassed = BoolPointer(assessResult.Passed)
+		summary.SLOs = assessResult.SLOs
+	}
+	if em, err := getEndpointMetrics(exp); err == nil {
+		for _, e := range em {
+			summary.Endpoints = append(summary.Endpoints, newEndpointSummary(e))
+		}
+	}
+	summary.FailureReasons = failureReasons(summary.Tasks, summary.SLOs)
+
+	return map[string]Summary{
+		"Summary": summary,
 	}
 }
 
-// getPayload fetches the payload template from the PayloadTemplateURL and
-// executes it with values from getSummary()
-func (t *notifyTask) getPayload(exp *Experiment) (string, error) {
-	if t.With.PayloadTemplateURL != "" {
-		template, err := getTextTemplateFromURL(t.With.PayloadTemplateURL)
-		if err != nil {
-			return "", err
+// newEndpointSummary returns the key metrics of an endpoint
+func newEndpointSummary(e endpointMetrics) EndpointSummary {
+	prefix := e.task + "/"
+	s := EndpointSummary{
+		Task:         e.task,
+		Endpoint:     e.endpoint,
+		Version:      e.versionStr,
+		RequestCount: int64(e.metrics[prefix+requestCountMetric]),
+		ErrorCount:   int64(e.metrics[prefix+errorCountMetric]),
+		ErrorRate:    e.metrics[prefix+errorRateMetric],
+		LatencyMean:  e.metrics[prefix+latencyMeanMetric],
+	}
+	for name, value := range e.metrics {
+		if p, ok := strings.CutPrefix(name, prefix+latencyPrefix); ok {
+			if s.LatencyPercentiles == nil {
+				s.LatencyPercentiles = map[string]float64{}
+			}
+			s.LatencyPercentiles[p] = value
 		}
+	}
+	return s
+}
 
-		values := getSummary(exp)
+// failureReasons explains the failed tasks and the SLOs that are not satisfied
+func failureReasons(tasks []TaskResult, slos []SLOResult) []string {
+	reasons := []string{}
+	for _, tr := range tasks {
+		if tr.Status != TaskFailed && tr.Status != TaskAborted {
+			continue
+		}
+		label := fmt.Sprintf("task %v (%v)", tr.Index, tr.Name)
+		if tr.Finally {
+			label = "finally " + label
+		}
+		reason := fmt.Sprintf("%v %v", label, tr.Status)
+		if tr.Error != "" {
+			reason += ": " + tr.Error
+		}
+		reasons = append(reasons, reason)
+	}
+	for _, r := range slos {
+		if r.Satisfied {
+			continue
+		}
+		endpoint := r.Endpoint
+		if r.Version != "" {
+			endpoint += " " + r.Version
+		}
+		reason := fmt.Sprintf("SLO %v not satisfied for %v endpoint %v", r.SLO, r.Task, endpoint)
+		switch {
+		case r.Message != "":
+			reason += ": " + r.Message
+		case r.Value != nil:
+			reason += fmt.Sprintf(": observed value is %v", formatMetricValue(*r.Value))
+		}
+		reasons = append(reasons, reason)
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	return reasons
+}
 
-		// get the metrics spec
-		var buf bytes.Buffer
-		err = template.Execute(&buf, values)
+// formatMetricValue formats the value of a metric for display, with at most three decimal places
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+// getPayloadTemplate returns the payload template of the task, or nil if it has none
+func (t *notifyTask) getPayloadTemplate(exp *Experiment) (*template.Template, error) {
+	var tpl string
+	switch {
+	case t.With.PayloadTemplate != "":
+		tpl = t.With.PayloadTemplate
+	case t.With.PayloadTemplateFile != "":
+		b, err := os.ReadFile(filepath.Clean(t.With.PayloadTemplateFile))
+		if err != nil {
+			e := fmt.Errorf("unable to read payload template from %v", t.With.PayloadTemplateFile)
+			log.Logger.WithStackTrace(err.Error()).Error(e)
+			return nil, e
+		}
+		tpl = string(b)
+	case t.With.PayloadTemplateName != "":
+		b, err := notifyTemplates.ReadFile("templates/notify/" + t.With.PayloadTemplateName + ".tpl")
 		if err != nil {
-			log.Logger.Error("could not execute payload template")
-			return "", err
+			return nil, fmt.Errorf("unknown payload template %v", t.With.PayloadTemplateName)
 		}
+		tpl = string(b)
+	case t.With.PayloadTemplateURL != "":
+		return getTextTemplateFromURL(t.With.PayloadTemplateURL)
+	default:
+		return nil, nil
+	}
+	return template.New("payload template").Funcs(taskFuncMap(exp)).Parse(tpl)
+}
+
+// getPayload executes the payload template of the task with values from getSummary()
+func (t *notifyTask) getPayload(exp *Experiment) (string, error) {
+	tpl, err := t.getPayloadTemplate(exp)
+	if err != nil || tpl == nil {
+		return "", err
+	}
+
+	values := getSummary(exp)
 
-		return buf.String(), nil
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, values)
+	if err != nil {
+		log.Logger.Error("could not execute payload template")
+		return "", err
 	}
 
-	return "", nil
+	return buf.String(), nil
+}
+
+// hasPayload returns true if the task sends a payload
+func (t *notifyTask) hasPayload() bool {
+	return t.With.PayloadTemplate != "" || t.With.PayloadTemplateFile != "" || t.With.PayloadTemplateName != "" || t.With.PayloadTemplateURL != ""
 }
 
-// initializeDefaults sets default values
-func (t *notifyTask) initializeDefaults() {
+// InitializeDefaults sets default values
+func (t *notifyTask) InitializeDefaults() {
 	// set default HTTP method
 	if t.With.Method == "" {
-		if t.With.PayloadTemplateURL != "" {
+		if t.hasPayload() {
 			t.With.Method = http.MethodPost
 		} else {
 			t.With.Method = http.MethodGet
 		}
 	}
+	if t.With.Timeout == nil {
+		t.With.Timeout = StringPointer(defaultNotifyTimeout)
+	}
+	if t.With.Retries == nil {
+		t.With.Retries = IntPointer(0)
+	}
+	if t.With.Backoff == nil {
+		t.With.Backoff = StringPointer(defaultNotifyBackoff)
+	}
+	if t.With.Signature != nil && t.With.Signature.Header == "" {
+		t.With.Signature.Header = defaultSignatureHeader
+	}
 }
 
 // validate task inputs
-func (t *notifyTask) validateInputs() error {
-	if t.With.URL == "" {
-		return errors.New("no URL was provided for notify task")
+func (t *notifyTask) ValidateInputs() error {
+	errs := []error{validateURL("with.url", t.With.URL)}
+	sources := 0
+	for _, s := range []string{t.With.PayloadTemplate, t.With.PayloadTemplateFile, t.With.PayloadTemplateName, t.With.PayloadTemplateURL} {
+		if s != "" {
+			sources++
+		}
 	}
-
-	return nil
+	if sources > 1 {
+		errs = append(errs, newFieldError("with", "specify at most one of payloadTemplate, payloadTemplateFile, payloadTemplateName and payloadTemplateURL"))
+	}
+	if t.With.PayloadTemplateName != "" && !isTemplate(t.With.PayloadTemplateName) && !slices.Contains(notifyTemplateNames, t.With.PayloadTemplateName) {
+		errs = append(errs, newFieldError("with.payloadTemplateName", "invalid payload template %q; must be one of %v", t.With.PayloadTemplateName, strings.Join(notifyTemplateNames, ", ")))
+	}
+	if t.With.PayloadTemplateURL != "" {
+		errs = append(errs, validateURL("with.payloadTemplateURL", t.With.PayloadTemplateURL))
+	}
+	errs = append(errs, validateDuration("with.timeout", t.With.Timeout), validateDuration("with.backoff", t.With.Backoff))
+	if t.With.Retries != nil && *t.With.Retries < 0 {
+		errs = append(errs, newFieldError("with.retries", "must not be negative"))
+	}
+	if t.With.Signature != nil && t.With.Signature.Secret == "" {
+		errs = append(errs, newFieldError("with.signature.secret", "secret is required"))
+	}
+	return errors.Join(errs...)
 }
 
-// run executes this task
-func (t *notifyTask) run(exp *Experiment) error {
+// Run executes this task
+func (t *notifyTask) Run(ctx context.Context, exp *Experiment) error {
 	// validate inputs
-	err := t.validateInputs()
+	err := t.ValidateInputs()
 	if err != nil {
 		return err
 	}
 
 	// initialize defaults
-	t.initializeDefaults()
-
-	var requestBody io.Reader
+	t.InitializeDefaults()
 
 	log.Logger.Debug("method: ", t.With.Method, " URL: ", t.With.URL)
 
-	if t.With.PayloadTemplateURL != "" {
-		payload, err := t.getPayload(exp)
-		if err != nil {
-			log.Logger.Error("could not get payload")
+	payload, err := t.getPayload(exp)
+	if err != nil {
+		log.Logger.Error("could not get payload")
+		return err
+	}
+	if payload != "" {
+		// payloads may include secrets; only the logged copy is redacted
+		log.Logger.Debug("add payload: ", log.Redact(payload))
+	}
+
+	err = t.send(ctx, payload)
+	if err != nil {
+		log.Logger.Error("could not send notification: ", err)
+		if t.With.SoftFailure {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// send sends the notification, retrying requests that may succeed later
+func (t *notifyTask) send(ctx context.Context, payload string) error {
+	// durations are validated before the task runs
+	timeout, _ := time.ParseDuration(*t.With.Timeout)
+	backoff, _ := time.ParseDuration(*t.With.Backoff)
+
+	for attempt := 0; ; attempt++ {
+		retry, err := t.sendRequest(ctx, payload, timeout)
+		if err == nil || !retry || attempt >= *t.With.Retries {
 			return err
 		}
 
-		log.Logger.Debug("add payload: ", string(payload))
+		log.Logger.WithStackTrace(err.Error()).Warnf("notification attempt %v failed; retrying in %v", attempt+1, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+		backoff *= 2
+	}
+}
+
+// sendRequest sends a single notification request
+// It returns true with an error if the request failed with a network error, or a 429 or 5xx status code
+func (t *notifyTask) sendRequest(ctx context.Context, payload string, timeout time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
+	var requestBody io.Reader
+	if t.hasPayload() {
 		requestBody = strings.NewReader(payload)
 	}
 
 	// create a new HTTP request
-	req, err := http.NewRequest(t.With.Method, t.With.URL, requestBody)
+	req, err := http.NewRequestWithContext(ctx, t.With.Method, t.With.URL, requestBody)
 	if err != nil {
-		log.Logger.Error("could not create HTTP request for notify task: ", err)
-
-		if t.With.SoftFailure {
-			return nil
-		}
-		return err
+		return false, fmt.Errorf("could not create HTTP request for notify task: %w", err)
 	}
 
 	// iterate through headers
@@ -177,6 +464,12 @@ func (t *notifyTask) run(exp *Experiment) error {
 		log.Logger.Debug("add header: ", headerName, ", value: ", headerValue)
 	}
 
+	// sign the payload
+	if t.With.Signature != nil {
+		log.AddSecret(t.With.Signature.Secret)
+		req.Header.Set(t.With.Signature.Header, signPayload(t.With.Signature.Secret, payload))
+	}
+
 	// add query params
 	q := req.URL.Query()
 	for key, value := range t.With.Params {
@@ -186,33 +479,31 @@ func (t *notifyTask) run(exp *Experiment) error {
 	req.URL.RawQuery = q.Encode()
 
 	// send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Logger.Error("could not send HTTP request for notify task: ", err)
-
-		if t.With.SoftFailure {
-			return nil
-		}
-		return err
+		return true, fmt.Errorf("could not send HTTP request for notify task: %w", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
-	if !t.With.SoftFailure && (resp.StatusCode < 200 || resp.StatusCode > 299) {
-		return errors.New("did not receive successful status code for notify task")
-	}
-
 	// read response responseBody
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Logger.Error("could not read response body from notification request", err)
-
-		return nil
 	}
-
 	log.Logger.Debug("response body: ", string(responseBody))
 
-	return nil
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("did not receive successful status code for notify task: %v", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// signPayload returns the HMAC-SHA256 signature of the payload, as sha256=<hex digest>
+func signPayload(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
 }
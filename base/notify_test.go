@@ -2,7 +2,12 @@ package base
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"net/http"
 	"os"
 	"testing"
@@ -46,9 +51,9 @@ func TestNotify(t *testing.T) {
 		Result: &ExperimentResult{},
 	}
 	exp.initResults(1)
-	_ = exp.Result.initInsightsWithNumVersions(1)
+	_ = exp.Result.InitInsightsWithNumVersions(1)
 
-	err := nt.run(exp)
+	err := nt.Run(context.Background(), exp)
 
 	// test should not fail
 	assert.NoError(t, err)
@@ -122,9 +127,9 @@ func TestNotifyWithPayload(t *testing.T) {
 		Result: &ExperimentResult{},
 	}
 	exp.initResults(1)
-	_ = exp.Result.initInsightsWithNumVersions(1)
+	_ = exp.Result.InitInsightsWithNumVersions(1)
 
-	err := nt.run(exp)
+	err := nt.Run(context.Background(), exp)
 
 	// test should not fail
 	assert.NoError(t, err)
@@ -166,9 +171,9 @@ func TestNotifyWithHeadersAndQueryParams(t *testing.T) {
 		Result: &ExperimentResult{},
 	}
 	exp.initResults(1)
-	_ = exp.Result.initInsightsWithNumVersions(1)
+	_ = exp.Result.InitInsightsWithNumVersions(1)
 
-	err := nt.run(exp)
+	err := nt.Run(context.Background(), exp)
 
 	// test should not fail
 	assert.NoError(t, err)
@@ -190,9 +195,9 @@ func TestNotifyBadMethod(t *testing.T) {
 		Result: &ExperimentResult{},
 	}
 	exp.initResults(1)
-	_ = exp.Result.initInsightsWithNumVersions(1)
+	_ = exp.Result.InitInsightsWithNumVersions(1)
 
-	err := nt.run(exp)
+	err := nt.Run(context.Background(), exp)
 
 	// test should fail
 	assert.Error(t, err)
@@ -210,9 +215,9 @@ func TestNotifyBadMethod(t *testing.T) {
 		Result: &ExperimentResult{},
 	}
 	exp.initResults(1)
-	_ = exp.Result.initInsightsWithNumVersions(1)
+	_ = exp.Result.InitInsightsWithNumVersions(1)
 
-	err = nt.run(exp)
+	err = nt.Run(context.Background(), exp)
 
 	// test should not fail
 	assert.NoError(t, err)
@@ -258,9 +263,9 @@ func TestNotifyPayloadTemplateURLDefaultMethod(t *testing.T) {
 		Result: &ExperimentResult{},
 	}
 	exp.initResults(1)
-	_ = exp.Result.initInsightsWithNumVersions(1)
+	_ = exp.Result.InitInsightsWithNumVersions(1)
 
-	err := nt.run(exp)
+	err := nt.Run(context.Background(), exp)
 
 	// test should not fail
 	assert.NoError(t, err)
@@ -280,10 +285,216 @@ func TestNotifyNoURL(t *testing.T) {
 		Result: &ExperimentResult{},
 	}
 	exp.initResults(1)
-	_ = exp.Result.initInsightsWithNumVersions(1)
+	_ = exp.Result.InitInsightsWithNumVersions(1)
 
-	err := nt.run(exp)
+	err := nt.Run(context.Background(), exp)
 
 	// test should fail
 	assert.Error(t, err)
 }
+
+func TestValidateNotifyInputs(t *testing.T) {
+	nt := getNotifyTask(t, notifyInputs{
+		URL:                 testNotifyURL,
+		PayloadTemplate:     "{{ .Summary | toJson }}",
+		PayloadTemplateName: "discord",
+		Timeout:             StringPointer("fast"),
+		Retries:             IntPointer(-1),
+		Signature:           &notifySignature{},
+	})
+	err := nt.ValidateInputs()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "with: specify at most one of payloadTemplate, payloadTemplateFile, payloadTemplateName and payloadTemplateURL")
+	assert.Contains(t, err.Error(), `with.payloadTemplateName: invalid payload template "discord"`)
+	assert.Contains(t, err.Error(), `with.timeout: invalid duration "fast"`)
+	assert.Contains(t, err.Error(), "with.retries: must not be negative")
+	assert.Contains(t, err.Error(), "with.signature.secret: secret is required")
+}
+
+// inline, file and built-in payload templates
+func TestNotifyPayloadTemplates(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	assert.NoError(t, os.WriteFile("payload.tpl", []byte(`{"tasks": {{ .Summary.NumTasks }}}`), 0600))
+
+	exp := &Experiment{
+		Metadata: ExperimentMetadata{Name: "default", Namespace: "test"},
+		Spec:     []Task{},
+		Result:   &ExperimentResult{},
+	}
+	exp.initResults(1)
+
+	for _, tc := range []struct {
+		with notifyInputs
+		key  string
+	}{
+		{with: notifyInputs{PayloadTemplate: `{"tasks": {{ .Summary.NumTasks }}}`}, key: "tasks"},
+		{with: notifyInputs{PayloadTemplateFile: "payload.tpl"}, key: "tasks"},
+		{with: notifyInputs{PayloadTemplateName: "json"}, key: "numTasks"},
+	} {
+		payload, err := getNotifyTask(t, tc.with).getPayload(exp)
+		assert.NoError(t, err)
+		var v map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(payload), &v))
+		assert.Contains(t, v, tc.key)
+	}
+
+	// every built-in template produces JSON
+	for _, name := range notifyTemplateNames {
+		payload, err := getNotifyTask(t, notifyInputs{PayloadTemplateName: name}).getPayload(exp)
+		assert.NoError(t, err)
+		assert.True(t, json.Valid([]byte(payload)), name)
+	}
+
+	// inline payload templates are not executed before the task runs
+	nt := getNotifyTask(t, notifyInputs{URL: "{{ .Outputs.hook.url }}", PayloadTemplate: "{{ .Summary.NumTasks }}"})
+	exp.Result.Outputs = map[string]map[string]interface{}{"hook": {"url": testNotifyURL}}
+	rendered, err := exp.renderTask(nt)
+	assert.NoError(t, err)
+	assert.Equal(t, testNotifyURL, rendered.(*notifyTask).With.URL)
+	assert.Equal(t, "{{ .Summary.NumTasks }}", rendered.(*notifyTask).With.PayloadTemplate)
+}
+
+// retries and signed payloads
+func TestNotifyRetriesAndSignature(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	StartHTTPMock(t)
+
+	nt := getNotifyTask(t, notifyInputs{
+		URL:                 testNotifyURL,
+		PayloadTemplateName: "json",
+		Retries:             IntPointer(2),
+		Backoff:             StringPointer("10ms"),
+		Signature:           &notifySignature{Secret: "shared"},
+	})
+
+	// notify endpoint is unavailable at first
+	requests := 0
+	httpmock.RegisterResponder(http.MethodPost, testNotifyURL,
+		func(req *http.Request) (*http.Response, error) {
+			requests++
+			body, _ := io.ReadAll(req.Body)
+			mac := hmac.New(sha256.New, []byte("shared"))
+			_, _ = mac.Write(body)
+			assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), req.Header.Get(defaultSignatureHeader))
+			if requests < 3 {
+				return httpmock.NewStringResponse(http.StatusServiceUnavailable, "unavailable"), nil
+			}
+			return httpmock.NewStringResponse(200, "success"), nil
+		},
+	)
+
+	exp := &Experiment{
+		Spec:   []Task{nt},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+	assert.NoError(t, nt.Run(context.Background(), exp))
+	assert.Equal(t, 3, requests)
+
+	// client errors are not retried
+	requests = 0
+	httpmock.RegisterResponder(http.MethodPost, testNotifyURL,
+		func(req *http.Request) (*http.Response, error) {
+			requests++
+			return httpmock.NewStringResponse(http.StatusBadRequest, "bad request"), nil
+		},
+	)
+	assert.ErrorContains(t, nt.Run(context.Background(), exp), "did not receive successful status code for notify task: 400")
+	assert.Equal(t, 1, requests)
+}
+
+// references in payloads are sent unchanged, and signed as sent
+func TestNotifyPayloadWithValueFrom(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	StartHTTPMock(t)
+	t.Setenv("NOTIFY_TEST_TOKEN", "notify-s3cret")
+
+	nt := getNotifyTask(t, notifyInputs{
+		URL:             testNotifyURL,
+		PayloadTemplate: `{"token":"{{ valueFrom "env" "NOTIFY_TEST_TOKEN" }}"}`,
+		Signature:       &notifySignature{Secret: "shared"},
+	})
+
+	called := false
+	httpmock.RegisterResponder(http.MethodPost, testNotifyURL,
+		func(req *http.Request) (*http.Response, error) {
+			called = true
+			body, _ := io.ReadAll(req.Body)
+			assert.Equal(t, `{"token":"notify-s3cret"}`, string(body))
+			assert.Equal(t, signPayload("shared", string(body)), req.Header.Get(defaultSignatureHeader))
+			return httpmock.NewStringResponse(200, "success"), nil
+		},
+	)
+
+	exp := &Experiment{
+		Spec:   []Task{nt},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+	assert.NoError(t, nt.Run(context.Background(), exp))
+	assert.True(t, called)
+}
+
+// summaries explain why experiments failed
+func TestNotifySummary(t *testing.T) {
+	exp := getAssessTestExperiment()
+	exp.Metadata = ExperimentMetadata{Name: "default", Namespace: "test"}
+	at := &assessTask{
+		TaskMeta: TaskMeta{Task: StringPointer(AssessTaskName)},
+		With:     assessInputs{SLOs: []string{"http/latency-p99 <= 200ms"}},
+	}
+	exp.Spec = []Task{at}
+	assert.NoError(t, at.Run(context.Background(), exp))
+	exp.Result.TaskResults = []TaskResult{
+		{Name: CollectHTTPTaskName, Index: 1, Status: TaskFailed, Error: "endpoint slow cannot be tested"},
+		{Name: AssessTaskName, Index: 2, Status: TaskSucceeded},
+	}
+
+	summary := getSummary(exp)["Summary"]
+	assert.Equal(t, exp.Result, summary.Result)
+	assert.Len(t, summary.Tasks, 2)
+	assert.False(t, *summary.SLOsPassed)
+	assert.Len(t, summary.SLOs, 2)
+	assert.Equal(t, []string{
+		"task 1 (http) failed: endpoint slow cannot be tested",
+		"SLO http/latency-p99 <= 200ms not satisfied for http endpoint slow: observed value is 500",
+	}, summary.FailureReasons)
+
+	// endpoints are sorted by task and endpoint
+	assert.Len(t, summary.Endpoints, 3)
+	assert.Equal(t, EndpointSummary{
+		Task:               CollectHTTPTaskName,
+		Endpoint:           "slow",
+		RequestCount:       100,
+		ErrorCount:         5,
+		ErrorRate:          0.05,
+		LatencyMean:        200,
+		LatencyPercentiles: map[string]float64{"99": 500},
+	}, summary.Endpoints[2])
+	assert.Equal(t, 40.0, summary.Endpoints[0].LatencyPercentiles["99"])
+
+	// the built-in Slack template includes the reasons and the key metrics
+	payload, err := getNotifyTask(t, notifyInputs{PayloadTemplateName: "slack"}).getPayload(exp)
+	assert.NoError(t, err)
+	var slack map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(payload), &slack))
+	assert.Contains(t, slack["text"], "Iter8 experiment *test/default* failed")
+	assert.Contains(t, slack["text"], "• SLO http/latency-p99 <= 200ms not satisfied for http endpoint slow")
+	assert.Contains(t, slack["text"], "• http endpoint slow: 100 requests, error rate 0.050, mean latency 200.0 ms, p99 latency 500.0 ms")
+
+	// the GitHub client payload has at most 10 top-level properties
+	payload, err = getNotifyTask(t, notifyInputs{PayloadTemplateName: "github"}).getPayload(exp)
+	assert.NoError(t, err)
+	var github struct {
+		ClientPayload map[string]interface{} `json:"client_payload"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(payload), &github))
+	assert.LessOrEqual(t, len(github.ClientPayload), 10)
+	assert.Contains(t, github.ClientPayload, "failureReasons")
+	// the experiment keeps the shape it has always had
+	experiment, ok := github.ClientPayload["experiment"].(map[string]interface{})
+	assert.True(t, ok)
+	for _, key := range []string{"metadata", "spec", "result"} {
+		assert.Contains(t, experiment, key)
+	}
+}
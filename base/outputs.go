@@ -0,0 +1,389 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	log "github.com/iter8-tools/iter8/base/log"
+)
+
+// endpointsOutput is the output of load test tasks with the metrics of each endpoint
+const endpointsOutput = "endpoints"
+
+var (
+	// taskIDRegex matches valid task IDs, which can be used as field names in templates
+	taskIDRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+)
+
+// templateData is the data available to templates in task inputs
+type templateData struct {
+	// Outputs are the outputs of tasks that have already run, keyed by task ID
+	Outputs map[string]map[string]interface{}
+}
+
+// setTaskOutput records a named output of a task so that later tasks can reference it
+// Outputs are only recorded for tasks with an ID
+func (exp *Experiment) setTaskOutput(tm TaskMeta, name string, value interface{}) {
+	if tm.ID == nil || exp == nil || exp.Result == nil {
+		return
+	}
+	if exp.Result.Outputs == nil {
+		exp.Result.Outputs = map[string]map[string]interface{}{}
+	}
+	if exp.Result.Outputs[*tm.ID] == nil {
+		exp.Result.Outputs[*tm.ID] = map[string]interface{}{}
+	}
+	exp.Result.Outputs[*tm.ID][name] = value
+}
+
+// setMetricsOutputs publishes the metrics of the endpoints of a load test task as its outputs
+// Metrics are named without the task prefix (example, latency-p99) and are published under endpoints, keyed by endpoint;
+// if there is a single endpoint, its metrics are also published directly (example, {{ index .Outputs.load "latency-p99" }})
+func (exp *Experiment) setMetricsOutputs(tm TaskMeta, prefix string, metrics map[string]map[string]float64) {
+	endpoints := map[string]interface{}{}
+	for endpoint, m := range metrics {
+		outputs := map[string]interface{}{}
+		for name, value := range m {
+			outputs[strings.TrimPrefix(name, prefix)] = value
+		}
+		endpoints[endpoint] = outputs
+		if len(metrics) == 1 {
+			for name, value := range outputs {
+				exp.setTaskOutput(tm, name, value)
+			}
+		}
+	}
+	exp.setTaskOutput(tm, endpointsOutput, endpoints)
+}
+
+// isTemplate returns true if the string contains references to the outputs of tasks, or is the placeholder of a reference to a value
+// Both are resolved when the task runs; a string that mentions outputs but cannot be parsed is reported when it is rendered
+func isTemplate(s string) bool {
+	if s == valueFromPlaceholder {
+		return true
+	}
+	refs, err := references(s)
+	return err != nil || len(refs) > 0
+}
+
+// reference is a template construct in a string that references the outputs of tasks
+type reference struct {
+	// start and end locate the construct in the string, including its delimiters
+	start, end int
+}
+
+// parseTemplate parses s as a whole; functions are not checked, so that templates of other tools can be parsed
+func parseTemplate(s string) (*parse.Tree, error) {
+	tree := parse.New("")
+	tree.Mode = parse.SkipFuncCheck | parse.ParseComments
+	if _, err := tree.Parse(s, "", "", map[string]*parse.Tree{}); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// references returns the top-level template constructs in s that reference the outputs of tasks, or variables declared by such constructs
+// Other constructs are left as is, so that inputs can contain templates of other tools (example, kubectl -o go-template)
+// A construct extends from its opening action to its closing action (example, {{ if .Outputs.login.stdout }}...{{ end }})
+func references(s string) ([]reference, error) {
+	if !strings.Contains(s, "{{") || !strings.Contains(s, ".Outputs") {
+		return nil, nil
+	}
+	tree, err := parseTemplate(s)
+	if err != nil {
+		return nil, err
+	}
+	nodes := tree.Root.Nodes
+	starts := make([]int, len(nodes)+1)
+	for i, n := range nodes {
+		starts[i] = int(n.Position())
+		if n.Type() != parse.NodeText {
+			starts[i] = strings.LastIndex(s[:starts[i]], "{{")
+		}
+	}
+	starts[len(nodes)] = len(s)
+
+	refs := []reference{}
+	vars := map[string]bool{}
+	for i, n := range nodes {
+		if n.Type() == parse.NodeText || !referencesOutputs(n, vars) {
+			continue
+		}
+		if a, ok := n.(*parse.ActionNode); ok {
+			for _, v := range a.Pipe.Decl {
+				vars[v.Ident[0]] = true
+			}
+		}
+		end := starts[i] + strings.LastIndex(s[starts[i]:starts[i+1]], "}}") + len("}}")
+		refs = append(refs, reference{start: starts[i], end: end})
+	}
+	return refs, nil
+}
+
+// referencesOutputs returns true if a parsed template references the outputs of tasks, or one of the given variables
+func referencesOutputs(node parse.Node, vars map[string]bool) bool {
+	found := len(outputsFields(node)) > 0
+	walkTemplate(node, func(n parse.Node) {
+		if v, ok := n.(*parse.VariableNode); ok && vars[v.Ident[0]] {
+			found = true
+		}
+	})
+	return found
+}
+
+// outputsFields returns the field chains starting with .Outputs, or $.Outputs, in a parsed template (example, [Outputs login stdout])
+func outputsFields(node parse.Node) [][]string {
+	fields := [][]string{}
+	walkTemplate(node, func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.FieldNode:
+			if n.Ident[0] == "Outputs" {
+				fields = append(fields, n.Ident)
+			}
+		case *parse.VariableNode:
+			if len(n.Ident) > 1 && n.Ident[0] == "$" && n.Ident[1] == "Outputs" {
+				fields = append(fields, n.Ident[1:])
+			}
+		}
+	})
+	return fields
+}
+
+// walkTemplate calls f for a node of a parsed template and for every node nested in it
+func walkTemplate(node parse.Node, f func(parse.Node)) {
+	f(node)
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, c := range n.Nodes {
+			walkTemplate(c, f)
+		}
+	case *parse.ActionNode:
+		walkTemplate(n.Pipe, f)
+	case *parse.PipeNode:
+		for _, c := range n.Cmds {
+			walkTemplate(c, f)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			walkTemplate(a, f)
+		}
+	case *parse.ChainNode:
+		walkTemplate(n.Node, f)
+	case *parse.TemplateNode:
+		if n.Pipe != nil {
+			walkTemplate(n.Pipe, f)
+		}
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, f)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, f)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, f)
+	}
+}
+
+// walkBranch walks the pipeline and the lists of an if, range or with construct
+func walkBranch(n *parse.BranchNode, f func(parse.Node)) {
+	walkTemplate(n.Pipe, f)
+	walkTemplate(n.List, f)
+	if n.ElseList != nil {
+		walkTemplate(n.ElseList, f)
+	}
+}
+
+// renderedFields returns the fields of a task, decoded from JSON, whose references are executed when the task runs
+// The script of a run task is only rendered if the task enables templates
+func renderedFields(v map[string]interface{}) []string {
+	fields := []string{"with"}
+	if with, ok := v["with"].(map[string]interface{}); ok && with[runTemplatesInput] == true {
+		fields = append(fields, "run")
+	}
+	return fields
+}
+
+// renderTask returns the task with the references in its inputs, and in its run command if it enables templates, executed
+// References are template actions that reference the outputs of earlier tasks (example, {{ .Outputs.login.stdout }});
+// references to values (example, {valueFrom: {env: TOKEN}}) are then replaced by their values, which are not executed as templates
+// A task without references is returned as is
+func (exp *Experiment) renderTask(t Task) (Task, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		e := errors.New("unable to marshal task")
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	var v map[string]interface{}
+	if err = json.Unmarshal(b, &v); err != nil {
+		e := errors.New("unable to unmarshal task")
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	var refs []valueFromRef
+	if vt, ok := t.(valueFromTask); ok {
+		refs = vt.valueFromRefs()
+	}
+	fields := renderedFields(v)
+	found := len(refs) > 0
+	for _, field := range fields {
+		found = found || hasTemplate(v[field])
+	}
+	if !found {
+		return t, nil
+	}
+
+	data := templateData{Outputs: map[string]map[string]interface{}{}}
+	if exp.Result != nil && exp.Result.Outputs != nil {
+		data.Outputs = exp.Result.Outputs
+	}
+	funcs := FuncMapWithToYAML()
+	for _, field := range fields {
+		if v[field] == nil {
+			continue
+		}
+		if v[field], err = renderValue(field, v[field], data, funcs); err != nil {
+			log.Logger.Error(err)
+			return nil, err
+		}
+	}
+	if err = exp.resolveValueFroms(v["with"], refs); err != nil {
+		log.Logger.Error(err)
+		return nil, err
+	}
+
+	// rebuild the task from its rendered form
+	b, err = json.Marshal([]interface{}{v})
+	if err != nil {
+		e := errors.New("unable to marshal rendered task")
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	var s ExperimentSpec
+	if err = json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("invalid inputs after executing templates: %w", err)
+	}
+	return s[0], nil
+}
+
+// hasTemplate returns true if any string in the decoded JSON value v contains a reference
+func hasTemplate(v interface{}) bool {
+	switch val := v.(type) {
+	case string:
+		return isTemplate(val)
+	case map[string]interface{}:
+		for _, e := range val {
+			if hasTemplate(e) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, e := range val {
+			if hasTemplate(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renderValue executes the references in the strings of the decoded JSON value v at path
+// Every string is rendered; the errors of all strings are returned
+func renderValue(path string, v interface{}, data templateData, funcs template.FuncMap) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		// payload templates of notifications are executed by the task
+		if path == payloadTemplatePath {
+			return val, nil
+		}
+		return renderString(path, val, data, funcs)
+	case map[string]interface{}:
+		// templates of per-request headers are executed for each request
+		if strings.HasSuffix(path, requestHeadersSuffix) {
+			return val, nil
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		errs := []error{}
+		for _, k := range keys {
+			r, err := renderValue(path+"."+k, val[k], data, funcs)
+			errs = append(errs, err)
+			val[k] = r
+		}
+		return val, errors.Join(errs...)
+	case []interface{}:
+		errs := []error{}
+		for i, e := range val {
+			r, err := renderValue(fmt.Sprintf("%v[%d]", path, i), e, data, funcs)
+			errs = append(errs, err)
+			val[i] = r
+		}
+		return val, errors.Join(errs...)
+	default:
+		return v, nil
+	}
+}
+
+// renderString executes the references in s, leaving the rest of s as is
+// The references are executed as one template, in which the rest of s is quoted, so that variables declared by a reference can be used by later ones;
+// whitespace around a reference is trimmed as specified by its trim markers (example, {{- .Outputs.login.stdout -}})
+func renderString(path string, s string, data templateData, funcs template.FuncMap) (string, error) {
+	refs, err := references(s)
+	if err != nil {
+		return "", newFieldError(path, "invalid template: %v", err)
+	}
+	if len(refs) == 0 {
+		return s, nil
+	}
+	var src strings.Builder
+	last, trimNext := 0, false
+	quote := func(text string) {
+		if trimNext {
+			text = strings.TrimLeft(text, " \t\r\n")
+		}
+		if text != "" {
+			src.WriteString("{{" + strconv.Quote(text) + "}}")
+		}
+	}
+	for _, ref := range refs {
+		construct := s[ref.start:ref.end]
+		text := s[last:ref.start]
+		if hasLeftTrimMarker(construct) {
+			text = strings.TrimRight(text, " \t\r\n")
+		}
+		quote(text)
+		src.WriteString(construct)
+		last, trimNext = ref.end, hasRightTrimMarker(construct)
+	}
+	quote(s[last:])
+
+	tpl, err := template.New(path).Funcs(funcs).Option("missingkey=error").Parse(src.String())
+	if err != nil {
+		return "", newFieldError(path, "invalid template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, data); err != nil {
+		return "", newFieldError(path, "unable to execute template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// hasLeftTrimMarker returns true if a template construct trims the whitespace before it (example, {{- .Outputs.login.stdout }})
+func hasLeftTrimMarker(construct string) bool {
+	return len(construct) > 3 && strings.HasPrefix(construct, "{{-") && strings.ContainsRune(" \t\r\n", rune(construct[3]))
+}
+
+// hasRightTrimMarker returns true if a template construct trims the whitespace after it (example, {{ .Outputs.login.stdout -}})
+func hasRightTrimMarker(construct string) bool {
+	n := len(construct)
+	return n > 3 && strings.HasSuffix(construct, "-}}") && strings.ContainsRune(" \t\r\n", rune(construct[n-4]))
+}
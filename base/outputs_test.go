@@ -0,0 +1,154 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"fortio.org/fortio/fhttp"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+func TestRunOutputs(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	rt := &runTask{
+		TaskMeta: TaskMeta{
+			ID:  StringPointer("login"),
+			Run: StringPointer(`echo '{"token": "abc"}'; echo ignored >&2`),
+		},
+	}
+
+	exp := &Experiment{Spec: []Task{rt}}
+	exp.initResults(1)
+	err := rt.Run(context.Background(), exp)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]interface{}{
+		"login": {
+			stdoutOutput: `{"token": "abc"}`,
+			jsonOutput:   map[string]interface{}{"token": "abc"},
+		},
+	}, exp.Result.Outputs)
+
+	// outputs are not recorded for tasks without an ID
+	rt.ID = nil
+	exp.initResults(1)
+	err = rt.Run(context.Background(), exp)
+	assert.NoError(t, err)
+	assert.Nil(t, exp.Result.Outputs)
+}
+
+func TestTaskOutputTemplates(t *testing.T) {
+	setupMockMetricsServer(t)
+	_ = os.Chdir(t.TempDir())
+
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	authorized := 0
+	mux.HandleFunc("/"+foo, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		authorized++
+		w.WriteHeader(http.StatusOK)
+	})
+
+	exp := &Experiment{}
+	err := yaml.Unmarshal([]byte(fmt.Sprintf(`
+spec:
+- id: login
+  run: echo '{"token":"abc"}'
+- id: load
+  task: http
+  with:
+    url: http://localhost:%d/%v
+    numRequests: 5
+    headers:
+      Authorization: Bearer {{ .Outputs.login.json.token }}
+- run: test {{ index .Outputs.load "request-count" }} = 5 && touch requests
+  with:
+    templates: true
+- run: echo {{ .Outputs.missing.stdout }}
+  with:
+    templates: true
+- run: echo '{{.metadata.name}} {{ .Outputs.login.stdout }}' > literal
+`, addr.Port, foo)), exp)
+	assert.NoError(t, err)
+
+	exp.initResults(1)
+	err = exp.run(context.Background(), &mockDriver{exp})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 5, authorized)
+	assert.FileExists(t, "requests")
+	assert.Equal(t, TaskSucceeded, exp.TaskStatus(2))
+	assert.Equal(t, TaskSucceeded, exp.TaskStatus(3))
+	assert.Equal(t, float64(5), exp.Result.Outputs["load"]["request-count"])
+	assert.Contains(t, exp.Result.Outputs["load"][endpointsOutput], fmt.Sprintf("http://localhost:%d/%v", addr.Port, foo))
+
+	// references to outputs that do not exist fail the task
+	assert.Equal(t, TaskFailed, exp.TaskStatus(4))
+	assert.Contains(t, exp.Result.TaskResults[3].Error, "run")
+
+	// scripts are not templated unless they enable templates
+	b, err := os.ReadFile("literal")
+	assert.NoError(t, err)
+	assert.Equal(t, "{{.metadata.name}} {{ .Outputs.login.stdout }}\n", string(b))
+}
+
+func TestRenderTaskWithoutTemplates(t *testing.T) {
+	rt := &runTask{TaskMeta: TaskMeta{Run: StringPointer("echo hello")}}
+	exp := &Experiment{}
+	exp.initResults(1)
+
+	rendered, err := exp.renderTask(rt)
+	assert.NoError(t, err)
+	assert.Same(t, rt, rendered)
+
+	// scripts are only templated if they enable templates
+	rt.TaskMeta.Run = StringPointer("echo {{ .Outputs")
+	rendered, err = exp.renderTask(rt)
+	assert.NoError(t, err)
+	assert.Same(t, rt, rendered)
+
+	// invalid templates fail when rendered
+	rt.With.Templates = true
+	_, err = exp.renderTask(rt)
+	assert.ErrorContains(t, err, "run: invalid template")
+}
+
+func TestRenderReferences(t *testing.T) {
+	exp := &Experiment{Result: &ExperimentResult{Outputs: map[string]map[string]interface{}{
+		"login": {"stdout": "abc", "json": map[string]interface{}{"token": "xyz"}},
+	}}}
+	data := templateData{Outputs: exp.Result.Outputs}
+	funcs := taskFuncMap(exp)
+
+	for in, out := range map[string]string{
+		// only references are executed
+		`kubectl get pods -o go-template='{{range .items}}{{.metadata.name}}{{end}}'`: `kubectl get pods -o go-template='{{range .items}}{{.metadata.name}}{{end}}'`,
+		`docker ps --format '{{.ID}}' --label {{ .Outputs.login.stdout }}`:            `docker ps --format '{{.ID}}' --label abc`,
+		`Bearer {{ .Outputs.login.json.token }}`:                                      `Bearer xyz`,
+		`{{ index .Outputs.login "stdout" | upper }}`:                                 `ABC`,
+		`{{ .Summary.Result.Outputs }}`:                                               `{{ .Summary.Result.Outputs }}`,
+		"a \n {{- .Outputs.login.stdout -}} \n b":                                     "aabcb",
+		// references are parsed, not matched
+		`{{ printf "%s}}" .Outputs.login.stdout }} {{ "}}" }}`:    `abc}} {{ "}}" }}`,
+		`{{ if .Outputs.login.stdout }}yes{{ else }}no{{ end }}`:  `yes`,
+		`{{ range $k, $v := .Outputs.login }}{{ $k }} {{ end }}`:  `json stdout `,
+		`{{ $t := .Outputs.login.json.token }}{{ .ID }} {{ $t }}`: `{{ .ID }} xyz`,
+		`{{ $.Outputs.login.stdout }}`:                            `abc`,
+	} {
+		r, err := renderString("with.x", in, data, funcs)
+		assert.NoError(t, err)
+		assert.Equal(t, out, r)
+	}
+
+	_, err := renderString("with.x", "{{ .Outputs.missing.stdout }}", data, funcs)
+	assert.ErrorContains(t, err, `with.x: unable to execute template`)
+
+	_, err = renderString("with.x", "{{ if .Outputs.login.stdout }}", data, funcs)
+	assert.ErrorContains(t, err, `with.x: invalid template`)
+}
@@ -0,0 +1,291 @@
+package base
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+
+	log "github.com/iter8-tools/iter8/base/log"
+)
+
+const (
+	// PayloadFormatJSONL indicates a file with one JSON payload per line
+	PayloadFormatJSONL = "jsonl"
+	// PayloadFormatCSV indicates a CSV file with a header row; each other row is sent as a JSON object keyed by the header
+	PayloadFormatCSV = "csv"
+	// PayloadFormatFiles indicates a directory with one payload per file
+	PayloadFormatFiles = "files"
+
+	// PayloadOrderRoundRobin indicates that payloads are sent in order, starting over at the end of the dataset
+	PayloadOrderRoundRobin = "round-robin"
+	// PayloadOrderRandom indicates that payloads are chosen at random
+	PayloadOrderRandom = "random"
+
+	// requestHeadersSuffix is the suffix of the paths of inputs with templates that are executed for each request
+	requestHeadersSuffix = ".payloadData.headers"
+)
+
+// payloadData is a dataset of payloads, each of which is sent in one request
+type payloadData struct {
+	// Path is the path of the dataset. The dataset is a JSONL file, a CSV file or a directory of payload files.
+	Path string `json:"path" yaml:"path"`
+	// Format of the dataset. Valid values are jsonl, csv and files. Default value is files if path is a directory, and csv if path has the .csv extension; otherwise, jsonl.
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	// Order in which payloads are sent. Valid values are round-robin and random. Default value is round-robin.
+	Order string `json:"order,omitempty" yaml:"order,omitempty"`
+	// Headers are HTTP headers whose values are templates executed for each request; optional.
+	// Templates may reference the request number (.Index), the payload (.Payload), the fields of a JSON object or CSV row payload (example, .Fields.id), and the name of a payload file (.File).
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+
+	// the dataset is loaded once, and shared by the tests that use it
+	once   sync.Once
+	source *payloadSource
+	err    error
+}
+
+// payload is a request payload of a dataset
+type payload struct {
+	body   []byte
+	fields map[string]interface{}
+	file   string
+}
+
+// requestTemplateData is the data available to the templates of per-request headers
+type requestTemplateData struct {
+	// Index is the number of the request, starting at 0
+	Index int64
+	// Payload is the payload of the request
+	Payload string
+	// Fields are the fields of the payload, if it is a JSON object or a CSV row
+	Fields map[string]interface{}
+	// File is the name of the payload file, if the dataset is a directory
+	File string
+}
+
+// payloadSource chooses the payload of each request from a dataset
+type payloadSource struct {
+	payloads []payload
+	random   bool
+	headers  map[string]*template.Template
+	count    atomic.Int64
+}
+
+// validatePayloadData validates a dataset of payloads; prefix is the path of the dataset
+func validatePayloadData(prefix string, pd *payloadData) error {
+	if pd == nil {
+		return nil
+	}
+	errs := []error{}
+	if pd.Path == "" {
+		errs = append(errs, newFieldError(prefix+".path", "path is required"))
+	}
+	switch pd.Format {
+	case "", PayloadFormatJSONL, PayloadFormatCSV, PayloadFormatFiles:
+	default:
+		errs = append(errs, newFieldError(prefix+".format", "invalid format %q; must be %v, %v or %v", pd.Format, PayloadFormatJSONL, PayloadFormatCSV, PayloadFormatFiles))
+	}
+	switch pd.Order {
+	case "", PayloadOrderRoundRobin, PayloadOrderRandom:
+	default:
+		errs = append(errs, newFieldError(prefix+".order", "invalid order %q; must be %v or %v", pd.Order, PayloadOrderRoundRobin, PayloadOrderRandom))
+	}
+	for key := range pd.Headers {
+		if strings.TrimSpace(key) == "" {
+			errs = append(errs, newFieldError(prefix+".headers", "header name cannot be empty"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// getSource returns the payload source of this dataset, loading the dataset the first time
+func (pd *payloadData) getSource() (*payloadSource, error) {
+	pd.once.Do(func() {
+		pd.source, pd.err = newPayloadSource(pd)
+	})
+	return pd.source, pd.err
+}
+
+// newPayloadSource loads a dataset of payloads
+func newPayloadSource(pd *payloadData) (*payloadSource, error) {
+	format := pd.Format
+	if format == "" {
+		format = PayloadFormatJSONL
+		if info, err := os.Stat(pd.Path); err == nil && info.IsDir() {
+			format = PayloadFormatFiles
+		} else if strings.EqualFold(filepath.Ext(pd.Path), ".csv") {
+			format = PayloadFormatCSV
+		}
+	}
+
+	var payloads []payload
+	var err error
+	switch format {
+	case PayloadFormatCSV:
+		payloads, err = loadCSVPayloads(pd.Path)
+	case PayloadFormatFiles:
+		payloads, err = loadFilePayloads(pd.Path)
+	default:
+		payloads, err = loadJSONLPayloads(pd.Path)
+	}
+	if err != nil {
+		e := fmt.Errorf("unable to load payloads from %v", pd.Path)
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	if len(payloads) == 0 {
+		return nil, fmt.Errorf("no payloads in %v", pd.Path)
+	}
+
+	ps := &payloadSource{
+		payloads: payloads,
+		random:   pd.Order == PayloadOrderRandom,
+		headers:  map[string]*template.Template{},
+	}
+	for name, value := range pd.Headers {
+		tpl, err := template.New(name).Funcs(FuncMapWithToYAML()).Option("missingkey=zero").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template in header %v: %w", name, err)
+		}
+		ps.headers[name] = tpl
+	}
+	return ps, nil
+}
+
+// loadJSONLPayloads loads a file with one payload per line; empty lines are ignored
+func loadJSONLPayloads(path string) ([]payload, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	payloads := []payload{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		body := append([]byte{}, line...)
+		payloads = append(payloads, payload{body: body, fields: payloadFields(body)})
+	}
+	return payloads, scanner.Err()
+}
+
+// loadCSVPayloads loads a CSV file with a header row; each other row is a JSON object keyed by the header
+func loadCSVPayloads(path string) ([]payload, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	payloads := []payload{}
+	if len(rows) == 0 {
+		return payloads, nil
+	}
+	header := rows[0]
+	for _, row := range rows[1:] {
+		fields := map[string]interface{}{}
+		for i, name := range header {
+			if i < len(row) {
+				fields[name] = row[i]
+			}
+		}
+		body, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, payload{body: body, fields: fields})
+	}
+	return payloads, nil
+}
+
+// loadFilePayloads loads a directory with one payload per file, in the order of file names
+func loadFilePayloads(dir string) ([]payload, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	payloads := []payload{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		body, err := os.ReadFile(filepath.Clean(filepath.Join(dir, entry.Name())))
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, payload{body: body, fields: payloadFields(body), file: entry.Name()})
+	}
+	return payloads, nil
+}
+
+// payloadFields returns the fields of a payload that is a JSON object, or nil otherwise
+func payloadFields(body []byte) map[string]interface{} {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// next returns the number of the next request and its payload
+func (ps *payloadSource) next() (int64, payload) {
+	index := ps.count.Add(1) - 1
+	if ps.random {
+		// #nosec -- payloads need not be chosen with a secure random number generator
+		return index, ps.payloads[rand.Intn(len(ps.payloads))]
+	}
+	return index, ps.payloads[index%int64(len(ps.payloads))]
+}
+
+// roundTripperFunc is an http.RoundTripper implemented by a function
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip sends a request
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// transport returns a transport that sends each request with the next payload of the dataset, and with per-request headers
+func (ps *payloadSource) transport(base http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		index, p := ps.next()
+		r := req.Clone(req.Context())
+		r.Body = io.NopCloser(bytes.NewReader(p.body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(p.body)), nil
+		}
+		r.ContentLength = int64(len(p.body))
+
+		data := requestTemplateData{Index: index, Payload: string(p.body), Fields: p.fields, File: p.file}
+		for name, tpl := range ps.headers {
+			var buf bytes.Buffer
+			if err := tpl.Execute(&buf, data); err != nil {
+				return nil, fmt.Errorf("unable to execute template in header %v: %w", name, err)
+			}
+			r.Header.Set(name, buf.String())
+		}
+		return base.RoundTrip(r)
+	})
+}
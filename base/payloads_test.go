@@ -0,0 +1,132 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"fortio.org/fortio/fhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadPayloads(t *testing.T) {
+	dir := t.TempDir()
+
+	jsonl := filepath.Join(dir, "data.jsonl")
+	assert.NoError(t, os.WriteFile(jsonl, []byte("{\"id\": 1}\n\n[1, 2]\n"), 0600))
+	ps, err := newPayloadSource(&payloadData{Path: jsonl})
+	assert.NoError(t, err)
+	assert.Equal(t, []payload{
+		{body: []byte(`{"id": 1}`), fields: map[string]interface{}{"id": float64(1)}},
+		{body: []byte(`[1, 2]`)},
+	}, ps.payloads)
+
+	csvFile := filepath.Join(dir, "data.csv")
+	assert.NoError(t, os.WriteFile(csvFile, []byte("id,query\n1,shoes\n2,\"red, hats\"\n"), 0600))
+	ps, err = newPayloadSource(&payloadData{Path: csvFile})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(ps.payloads))
+	assert.Equal(t, `{"id":"2","query":"red, hats"}`, string(ps.payloads[1].body))
+	assert.Equal(t, "shoes", ps.payloads[0].fields["query"])
+
+	files := filepath.Join(dir, "files")
+	assert.NoError(t, os.Mkdir(files, 0700))
+	assert.NoError(t, os.Mkdir(filepath.Join(files, "ignored"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(files, "b.txt"), []byte("second"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(files, "a.json"), []byte(`{"id": "first"}`), 0600))
+	ps, err = newPayloadSource(&payloadData{Path: files})
+	assert.NoError(t, err)
+	assert.Equal(t, []payload{
+		{body: []byte(`{"id": "first"}`), fields: map[string]interface{}{"id": "first"}, file: "a.json"},
+		{body: []byte("second"), file: "b.txt"},
+	}, ps.payloads)
+
+	// empty and missing datasets cannot be used
+	empty := filepath.Join(dir, "empty.jsonl")
+	assert.NoError(t, os.WriteFile(empty, []byte("\n"), 0600))
+	_, err = newPayloadSource(&payloadData{Path: empty})
+	assert.ErrorContains(t, err, "no payloads")
+	_, err = newPayloadSource(&payloadData{Path: filepath.Join(dir, "missing.jsonl")})
+	assert.ErrorContains(t, err, "unable to load payloads")
+}
+
+func TestValidatePayloadData(t *testing.T) {
+	err := validateEndpoint("with", endpoint{
+		URL:        "http://localhost:8080",
+		PayloadStr: StringPointer("hello"),
+		PayloadData: &payloadData{
+			Format: "parquet",
+			Order:  "shuffled",
+		},
+	}, true)
+	assert.ErrorContains(t, err, "with.payloadData: cannot be specified together with payloadStr or payloadFile")
+	assert.ErrorContains(t, err, "with.payloadData.path: path is required")
+	assert.ErrorContains(t, err, `with.payloadData.format: invalid format "parquet"`)
+	assert.ErrorContains(t, err, `with.payloadData.order: invalid order "shuffled"`)
+}
+
+func TestRunCollectHTTPPayloadData(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	assert.NoError(t, os.WriteFile("data.jsonl", []byte("{\"id\":\"a\"}\n{\"id\":\"b\"}\n{\"id\":\"c\"}\n"), 0600))
+
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	var mu sync.Mutex
+	bodies, ids, contentTypes := []string{}, []string{}, map[string]bool{}
+	mux.HandleFunc("/"+foo, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(b))
+		ids = append(ids, r.Header.Get("X-Request-ID"))
+		contentTypes[r.Header.Get("Content-Type")] = true
+		w.WriteHeader(200)
+	})
+
+	ct := &collectHTTPTask{
+		TaskMeta: TaskMeta{
+			Task: StringPointer(CollectHTTPTaskName),
+		},
+		With: collectHTTPInputs{
+			endpoint: endpoint{
+				URL:         fmt.Sprintf("http://localhost:%d/%v", addr.Port, foo),
+				NumRequests: int64Pointer(6),
+				Connections: IntPointer(1),
+				PayloadData: &payloadData{
+					Path: "data.jsonl",
+					Headers: map[string]string{
+						"X-Request-ID": "{{ .Fields.id }}-{{ .Index }}",
+					},
+				},
+			},
+		},
+	}
+
+	exp := &Experiment{
+		Spec:   []Task{ct},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+
+	// templates of per-request headers are not executed when the task runs
+	rendered, err := exp.renderTask(ct)
+	assert.NoError(t, err)
+	assert.Equal(t, "{{ .Fields.id }}-{{ .Index }}", rendered.(*collectHTTPTask).With.PayloadData.Headers["X-Request-ID"])
+
+	err = ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	// payloads are sent round-robin
+	assert.Equal(t, []string{`{"id":"a"}`, `{"id":"b"}`, `{"id":"c"}`, `{"id":"a"}`, `{"id":"b"}`, `{"id":"c"}`}, bodies)
+	assert.Equal(t, []string{"a-0", "b-1", "c-2", "a-3", "b-4", "c-5"}, ids)
+	assert.Equal(t, map[string]bool{"application/json": true}, contentTypes)
+
+	// latency is aggregated as usual
+	httpResult, ok := exp.Result.Insights.TaskData[CollectHTTPTaskName].(HTTPResult)
+	assert.True(t, ok)
+	assert.Equal(t, int64(6), httpResult[ct.With.URL].DurationHistogram.Count)
+}
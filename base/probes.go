@@ -0,0 +1,252 @@
+package base
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// probeTimeout is the maximum time spent on a single attempt of a probe
+	probeTimeout = 5 * time.Second
+)
+
+// readinessProbe checks that an endpoint is ready; exactly one of its fields must be specified
+// Probes do not need access to Kubernetes, so they can check endpoints such as external gateways or port-forwarded services
+type readinessProbe struct {
+	// HTTP sends a GET request to an endpoint
+	HTTP *httpProbe `json:"http,omitempty" yaml:"http,omitempty"`
+	// TCP connects to an endpoint
+	TCP *tcpProbe `json:"tcp,omitempty" yaml:"tcp,omitempty"`
+	// GRPC calls the standard gRPC health service (grpc.health.v1.Health/Check) of an endpoint
+	GRPC *grpcProbe `json:"grpc,omitempty" yaml:"grpc,omitempty"`
+}
+
+// httpProbe is ready when a GET request to its URL succeeds with an expected status code, and its response passes the checks
+type httpProbe struct {
+	// URL of the endpoint
+	URL string `json:"url" yaml:"url"`
+	// Headers are the headers of the request; optional
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// StatusCodes are the expected status codes; optional. Default is any status code from 200 to 399.
+	StatusCodes []int `json:"statusCodes,omitempty" yaml:"statusCodes,omitempty"`
+	// ResponseChecks are checks of the response body; optional
+	ResponseChecks *responseChecks `json:"responseChecks,omitempty" yaml:"responseChecks,omitempty"`
+	// TLS contains the TLS options used to connect to the endpoint; optional
+	TLS *tlsConfig `json:"tls,omitempty" yaml:"tls,omitempty"`
+}
+
+// tcpProbe is ready when a TCP connection to its address can be established
+type tcpProbe struct {
+	// Address of the endpoint (example, gateway.example.com:443)
+	Address string `json:"address" yaml:"address"`
+}
+
+// grpcProbe is ready when the health service of its address reports that the service is serving
+type grpcProbe struct {
+	// Address of the endpoint (example, localhost:50051)
+	Address string `json:"address" yaml:"address"`
+	// Service is the name of the service whose health is checked; optional. Default is the overall health of the server.
+	Service string `json:"service,omitempty" yaml:"service,omitempty"`
+	// TLS contains the TLS options used to connect to the endpoint; optional. Default is a plaintext connection.
+	TLS *tlsConfig `json:"tls,omitempty" yaml:"tls,omitempty"`
+}
+
+// validateReadinessProbe validates a probe; prefix is the path of the probe
+func validateReadinessProbe(prefix string, p readinessProbe) error {
+	n := 0
+	errs := []error{}
+	if p.HTTP != nil {
+		n++
+		errs = append(errs, validateURL(prefix+".http.url", p.HTTP.URL))
+		for i, code := range p.HTTP.StatusCodes {
+			if code < 100 || code > 599 {
+				errs = append(errs, newFieldError(fmt.Sprintf("%v.http.statusCodes[%d]", prefix, i), "invalid status code %d", code))
+			}
+		}
+		errs = append(errs, validateResponseChecks(prefix+".http.responseChecks", p.HTTP.ResponseChecks))
+		errs = append(errs, validateTLSConfig(prefix+".http.tls", p.HTTP.TLS))
+	}
+	if p.TCP != nil {
+		n++
+		errs = append(errs, validateAddress(prefix+".tcp.address", p.TCP.Address))
+	}
+	if p.GRPC != nil {
+		n++
+		errs = append(errs, validateAddress(prefix+".grpc.address", p.GRPC.Address))
+		errs = append(errs, validateTLSConfig(prefix+".grpc.tls", p.GRPC.TLS))
+	}
+	if n != 1 {
+		errs = append(errs, newFieldError(prefix, "specify exactly one of http, tcp and grpc"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateAddress checks that the field is a host:port address
+// Templates are executed when the task runs, so they are not checked
+func validateAddress(field string, address string) error {
+	if address == "" {
+		return newFieldError(field, "address is required")
+	}
+	if isTemplate(address) {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return newFieldError(field, "invalid address %q; expected host:port", address)
+	}
+	return nil
+}
+
+// check returns an error if the endpoint of the probe is not ready
+func (p readinessProbe) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	switch {
+	case p.HTTP != nil:
+		return p.HTTP.check(ctx)
+	case p.TCP != nil:
+		return p.TCP.check(ctx)
+	case p.GRPC != nil:
+		return p.GRPC.check(ctx)
+	}
+	return nil
+}
+
+// check returns an error if the endpoint of the HTTP probe is not ready
+func (p *httpProbe) check(ctx context.Context) error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.TLS != nil {
+		tc, err := p.TLS.clientTLSConfig()
+		if err != nil {
+			return err
+		}
+		transport.TLSClientConfig = tc
+	}
+	client := &http.Client{Transport: transport}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid request to %v: %w", p.URL, err)
+	}
+	for name, value := range p.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("GET %v failed: %w", p.URL, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read response from %v: %w", p.URL, err)
+	}
+
+	if !p.expectedStatus(resp.StatusCode) {
+		return fmt.Errorf("GET %v returned unexpected status code %d", p.URL, resp.StatusCode)
+	}
+	if p.ResponseChecks != nil {
+		v, err := newResponseValidator(*p.ResponseChecks)
+		if err != nil {
+			return err
+		}
+		if failed := v.failedChecks(body); len(failed) > 0 {
+			return fmt.Errorf("response from %v failed checks %v", p.URL, failed)
+		}
+	}
+	return nil
+}
+
+// expectedStatus returns true if the status code is expected
+func (p *httpProbe) expectedStatus(code int) bool {
+	if len(p.StatusCodes) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, c := range p.StatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error if the endpoint of the TCP probe is not ready
+func (p *tcpProbe) check(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return fmt.Errorf("unable to connect to %v: %w", p.Address, err)
+	}
+	return conn.Close()
+}
+
+// check returns an error if the endpoint of the gRPC probe is not ready
+func (p *grpcProbe) check(ctx context.Context) error {
+	creds := insecure.NewCredentials()
+	if p.TLS != nil {
+		tc, err := p.TLS.clientTLSConfig()
+		if err != nil {
+			return err
+		}
+		creds = credentials.NewTLS(tc)
+	}
+	conn, err := grpc.DialContext(ctx, p.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("unable to connect to %v: %w", p.Address, err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: p.Service})
+	if err != nil {
+		return fmt.Errorf("health check of %v failed: %w", p.Address, err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("health of %v is %v", p.Address, resp.GetStatus())
+	}
+	return nil
+}
+
+// clientTLSConfig returns the TLS configuration of a client that connects with these options
+func (c *tlsConfig) clientTLSConfig() (*tls.Config, error) {
+	tc := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify, // #nosec G402 -- verification is disabled only if asked for
+		MinVersion:         tls.VersionTLS12,
+	}
+	if c.CAFile != "" {
+		b, err := os.ReadFile(filepath.Clean(c.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA certificates from %v: %w", c.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no CA certificates in %v", c.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate from %v: %w", c.CertFile, err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
@@ -0,0 +1,97 @@
+package base
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"helm.sh/helm/v3/pkg/cli"
+)
+
+func TestValidateReadinessProbes(t *testing.T) {
+	rTask := &readinessTask{With: readinessInputs{
+		Probes: []readinessProbe{
+			{},
+			{HTTP: &httpProbe{URL: "localhost:8080", StatusCodes: []int{200, 700}}},
+			{TCP: &tcpProbe{Address: "localhost"}, GRPC: &grpcProbe{Address: "localhost:50051"}},
+			{GRPC: &grpcProbe{}},
+		},
+	}}
+	err := rTask.ValidateInputs()
+	assert.Error(t, err)
+	// probes do not need objects
+	assert.NotContains(t, err.Error(), "with.resource")
+	assert.Contains(t, err.Error(), "with.probes[0]: specify exactly one of http, tcp and grpc")
+	assert.Contains(t, err.Error(), "with.probes[1].http.url: invalid URL")
+	assert.Contains(t, err.Error(), "with.probes[1].http.statusCodes[1]: invalid status code 700")
+	assert.Contains(t, err.Error(), `with.probes[2].tcp.address: invalid address "localhost"`)
+	assert.Contains(t, err.Error(), "with.probes[2]: specify exactly one of http, tcp and grpc")
+	assert.Contains(t, err.Error(), "with.probes[3].grpc.address: address is required")
+}
+
+func TestRunReadinessProbes(t *testing.T) {
+	// probes work without access to Kubernetes
+	t.Setenv("KUBECONFIG", "/nonexistent/kubeconfig")
+	*kd = *NewKubeDriver(cli.New())
+
+	// the HTTP endpoint is ready after a few requests
+	var requests atomic.Int64
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 || r.Header.Get("X-Probe") != "iter8" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status": "ok"}`))
+	}))
+	t.Cleanup(app.Close)
+
+	// the gRPC health service reports that the server is serving
+	lis, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+	s := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("helloworld.Greeter", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(s, hs)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	rTask := &readinessTask{
+		TaskMeta: TaskMeta{Task: StringPointer(ReadinessTaskName)},
+		With: readinessInputs{
+			Timeout: StringPointer("10s"),
+			Probes: []readinessProbe{
+				{HTTP: &httpProbe{
+					URL:            app.URL,
+					Headers:        map[string]string{"X-Probe": "iter8"},
+					StatusCodes:    []int{200},
+					ResponseChecks: &responseChecks{JSONPath: []jsonPathCheck{{Path: "$.status", Equals: "ok"}}},
+				}},
+				{TCP: &tcpProbe{Address: lis.Addr().String()}},
+				{GRPC: &grpcProbe{Address: lis.Addr().String()}},
+			},
+		},
+	}
+	exp := &Experiment{Spec: []Task{rTask}, Result: &ExperimentResult{}}
+	assert.NoError(t, rTask.Run(context.Background(), exp))
+	assert.Equal(t, int64(3), requests.Load())
+
+	// services that are not serving are not ready
+	p := readinessProbe{GRPC: &grpcProbe{Address: lis.Addr().String(), Service: "helloworld.Greeter"}}
+	assert.ErrorContains(t, p.check(context.Background()), "is NOT_SERVING")
+
+	// closed ports are not ready
+	closed, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+	_ = closed.Close()
+	p = readinessProbe{TCP: &tcpProbe{Address: closed.Addr().String()}}
+	assert.ErrorContains(t, p.check(context.Background()), "unable to connect")
+}
@@ -13,9 +13,10 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/jsonpath"
 	"k8s.io/client-go/util/retry"
 )
 
@@ -25,65 +26,188 @@ const (
 
 	// defaultTimeout is default timeout for readiness command
 	defaultTimeout = "10s"
+
+	// resourceVersionOutput is the output with the resource version of the object
+	resourceVersionOutput = "resourceVersion"
 )
 
 // ReadinessInputs identifies the K8s object to test for existence and
 // the (optional) condition that should be tested (succeeds if true).
+// More objects may be listed in objects; the task succeeds when all of them are ready.
 type readinessInputs struct {
 	// Group of the object. Optional. If unspecified it will be defaulted to ""
 	Group string `json:"group,omitempty" yaml:"group,omitempty"`
 	// Version of the object. Optional. If unspecified it will be defaulted to ""
 	Version string `json:"version,omitempty" yaml:"version,omitempty"`
-	// Resource type of the object. Required.
+	// Resource type of the object. Required, unless objects are listed.
 	Resource string `json:"resource" yaml:"resource"`
-	// Namespace of the object. Optional. If left unspecified, this will be defaulted to the namespace of the experiment
+	// Namespace of the object. Optional. If left unspecified, this will be defaulted to the namespace of the experiment.
+	// It is also the default namespace of the listed objects.
 	Namespace *string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
 	// Name of the object
 	Name string `json:"name" yaml:"name"`
+	// Selector is a label selector of objects to check instead of a named object (example, app=model,version=v2)
+	Selector string `json:"selector,omitempty" yaml:"selector,omitempty"`
 	// Conditions is list of conditions to check for value of "True"
 	Conditions []string `json:"conditions" yaml:"conditions"`
+	// JSONPath is a list of checks of values of the object, all of which must hold
+	JSONPath []jsonPathCondition `json:"jsonPath,omitempty" yaml:"jsonPath,omitempty"`
+	// Objects is a list of other objects to check
+	Objects []readinessObject `json:"objects,omitempty" yaml:"objects,omitempty"`
+	// Probes is a list of endpoints to check. A task with only probes does not need access to Kubernetes.
+	Probes []readinessProbe `json:"probes,omitempty" yaml:"probes,omitempty"`
 	// Timeout is maximum time spent trying to find object and check condition
 	Timeout *string `json:"timeout" yaml:"timeout"`
 }
 
+// readinessObject identifies K8s objects to test for existence, and the checks of their readiness
+type readinessObject struct {
+	// Group of the objects. Optional. If unspecified it will be defaulted to ""
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	// Version of the objects. Optional. If unspecified it will be defaulted to ""
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Resource type of the objects. Required.
+	Resource string `json:"resource" yaml:"resource"`
+	// Namespace of the objects. Optional. If left unspecified, this will be defaulted to the namespace of the task.
+	Namespace *string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// Name of the object; specify either this field or selector
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Selector is a label selector of the objects; at least one object must match, and all matching objects must be ready
+	Selector string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	// Conditions is list of conditions to check for value of "True"
+	Conditions []string `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+	// JSONPath is a list of checks of values of the objects, all of which must hold
+	JSONPath []jsonPathCondition `json:"jsonPath,omitempty" yaml:"jsonPath,omitempty"`
+}
+
+// jsonPathCondition checks a value of an object (example, {path: .status.readyReplicas, equalsPath: .spec.replicas})
+type jsonPathCondition struct {
+	// Path is a JSONPath expression (example, .status.phase)
+	Path string `json:"path" yaml:"path"`
+	// Equals is the expected value at path. If neither this field nor equalsPath is specified, a value need only exist at path.
+	Equals interface{} `json:"equals,omitempty" yaml:"equals,omitempty"`
+	// EqualsPath is a JSONPath expression of another value of the object, which the value at path must equal
+	EqualsPath string `json:"equalsPath,omitempty" yaml:"equalsPath,omitempty"`
+}
+
 // ReadinessTask checks existence and readiness of specified resources
 type readinessTask struct {
 	TaskMeta
 	With readinessInputs `json:"with" yaml:"with"`
 }
 
-// initializeDefaults sets default values for the readiness task
-func (t *readinessTask) initializeDefaults() {
+// InitializeDefaults sets default values for the readiness task
+func (t *readinessTask) InitializeDefaults() {
 	if t.With.Timeout == nil {
 		t.With.Timeout = StringPointer(defaultTimeout)
 	}
 
 	// set Namespace (from context) if not already set
-	if t.With.Namespace == nil {
+	if t.With.Namespace == nil && len(t.objects()) > 0 {
 		t.With.Namespace = StringPointer(kd.Namespace())
 	}
 }
 
-// validateInputs validates task inputs
-// at present all validation at initialization
-func (t *readinessTask) validateInputs() error {
-	return nil
+// ValidateInputs validates task inputs
+func (t *readinessTask) ValidateInputs() error {
+	errs := []error{}
+	objects := t.objects()
+	// the first object may be specified by the fields of the task
+	offset := len(objects) - len(t.With.Objects)
+	for i, o := range objects {
+		prefix := "with"
+		if i >= offset {
+			prefix = fmt.Sprintf("with.objects[%d]", i-offset)
+		}
+		errs = append(errs, validateReadinessObject(prefix, o))
+	}
+	for i, p := range t.With.Probes {
+		errs = append(errs, validateReadinessProbe(fmt.Sprintf("with.probes[%d]", i), p))
+	}
+	errs = append(errs, validateDuration("with.timeout", t.With.Timeout))
+	return errors.Join(errs...)
+}
+
+// validateReadinessObject validates the identity and checks of objects; prefix is the path of the object
+func validateReadinessObject(prefix string, o readinessObject) error {
+	errs := []error{}
+	if o.Resource == "" {
+		errs = append(errs, newFieldError(prefix+".resource", "resource is required"))
+	}
+	switch {
+	case o.Name == "" && o.Selector == "":
+		errs = append(errs, newFieldError(prefix+".name", "name is required"))
+	case o.Name != "" && o.Selector != "":
+		errs = append(errs, newFieldError(prefix, "specify either name or selector but not both"))
+	case o.Selector != "":
+		if _, err := labels.Parse(o.Selector); err != nil {
+			errs = append(errs, newFieldError(prefix+".selector", "invalid label selector %q", o.Selector))
+		}
+	}
+	for i, c := range o.Conditions {
+		if c == "" {
+			errs = append(errs, newFieldError(fmt.Sprintf("%v.conditions[%d]", prefix, i), "condition cannot be empty"))
+		}
+	}
+	for i, c := range o.JSONPath {
+		path := fmt.Sprintf("%v.jsonPath[%d]", prefix, i)
+		if err := jsonpath.New(c.Path).Parse(jsonPathTemplate(c.Path)); c.Path == "" || err != nil {
+			errs = append(errs, newFieldError(path+".path", "invalid JSONPath %q", c.Path))
+		}
+		if c.EqualsPath != "" {
+			if err := jsonpath.New(c.EqualsPath).Parse(jsonPathTemplate(c.EqualsPath)); err != nil {
+				errs = append(errs, newFieldError(path+".equalsPath", "invalid JSONPath %q", c.EqualsPath))
+			}
+			if c.Equals != nil {
+				errs = append(errs, newFieldError(path, "specify either equals or equalsPath but not both"))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// objects returns the objects checked by the task, starting with the object specified by the fields of the task, if any
+func (t *readinessTask) objects() []readinessObject {
+	objects := []readinessObject{}
+	if t.With.Resource != "" || t.With.Name != "" || t.With.Selector != "" || (len(t.With.Objects) == 0 && len(t.With.Probes) == 0) {
+		objects = append(objects, readinessObject{
+			Group:      t.With.Group,
+			Version:    t.With.Version,
+			Resource:   t.With.Resource,
+			Namespace:  t.With.Namespace,
+			Name:       t.With.Name,
+			Selector:   t.With.Selector,
+			Conditions: t.With.Conditions,
+			JSONPath:   t.With.JSONPath,
+		})
+	}
+	for _, o := range t.With.Objects {
+		if o.Namespace == nil {
+			o.Namespace = t.With.Namespace
+		}
+		objects = append(objects, o)
+	}
+	return objects
 }
 
-// run executes the task
-func (t *readinessTask) run(_ *Experiment) error {
+// Run executes the task
+// When a single object is checked, its resource version is published as the resourceVersion output of the task
+func (t *readinessTask) Run(ctx context.Context, exp *Experiment) error {
 	// validation
-	err := t.validateInputs()
+	err := t.ValidateInputs()
 	if err != nil {
 		return err
 	}
 
-	// kd is required by initializeDefaults
-	if err = kd.initKube(); err != nil {
-		return err
+	// kd is required by InitializeDefaults, and to check objects
+	objects := t.objects()
+	if len(objects) > 0 {
+		if err = kd.initKube(); err != nil {
+			return err
+		}
 	}
 	// initialize default values
-	t.initializeDefaults()
+	t.InitializeDefaults()
 
 	// parse timeout
 	timeout, err := time.ParseDuration(*t.With.Timeout)
@@ -93,15 +217,7 @@ func (t *readinessTask) run(_ *Experiment) error {
 		return e
 	}
 
-	// get rest config
-	restConfig, err := kd.EnvSettings.RESTClientGetter().ToRESTConfig()
-	if err != nil {
-		e := errors.New("unable to get Kubernetes REST config")
-		log.Logger.WithStackTrace(err.Error()).Error(e)
-		return e
-	}
-
-	// do the work: check for object and condition
+	// do the work: check for objects and conditions, and probe endpoints
 	// repeat until time out
 	interval := 1 * time.Second
 	err = retry.OnError(
@@ -114,34 +230,81 @@ func (t *readinessTask) run(_ *Experiment) error {
 		},
 		func(err error) bool {
 			log.Logger.Error(err)
-			return true
-		}, // retry on all failures
+			return ctx.Err() == nil
+		}, // retry on all failures, until ctx is done
 		func() error {
-			return checkObjectExistsAndConditionTrue(t, restConfig)
+			ready := []*unstructured.Unstructured{}
+			for _, o := range t.objects() {
+				objs, err := checkObjectsExistAndReady(ctx, o)
+				if err != nil {
+					return err
+				}
+				ready = append(ready, objs...)
+			}
+			for _, p := range t.With.Probes {
+				if err := p.check(ctx); err != nil {
+					return err
+				}
+			}
+			// the resource version is only published when a single object is checked
+			if len(ready) == 1 {
+				exp.setTaskOutput(t.TaskMeta, resourceVersionOutput, ready[0].GetResourceVersion())
+			}
+			return nil
 		},
 	)
 	return err
 }
 
-// checkObjectExistsAndConditionTrue determines if the object exists
-// if so, it further checks if the requested condition is "True"
-func checkObjectExistsAndConditionTrue(t *readinessTask, _ *rest.Config) error {
-	log.Logger.Trace("looking for resource (", t.With.Group, "/", t.With.Version, ") ", t.With.Resource, ": ", t.With.Name, " in namespace ", *t.With.Namespace)
+// checkObjectsExistAndReady finds the named object, or the objects that match the selector
+// It further checks if one of the requested conditions is "True", and that the JSONPath checks hold, for each of them
+// The objects are returned if the checks succeed
+func checkObjectsExistAndReady(ctx context.Context, o readinessObject) ([]*unstructured.Unstructured, error) {
+	ri := kd.dynamicClient.Resource(gvr(o)).Namespace(*o.Namespace)
+	objs := []*unstructured.Unstructured{}
+	if o.Selector == "" {
+		log.Logger.Trace("looking for resource (", o.Group, "/", o.Version, ") ", o.Resource, ": ", o.Name, " in namespace ", *o.Namespace)
+		obj, err := ri.Get(ctx, o.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	} else {
+		log.Logger.Trace("looking for resources (", o.Group, "/", o.Version, ") ", o.Resource, " with selector ", o.Selector, " in namespace ", *o.Namespace)
+		list, err := ri.List(ctx, metav1.ListOptions{LabelSelector: o.Selector})
+		if err != nil {
+			return nil, err
+		}
+		if len(list.Items) == 0 {
+			return nil, fmt.Errorf("no %v match selector %v in namespace %v", o.Resource, o.Selector, *o.Namespace)
+		}
+		for i := range list.Items {
+			objs = append(objs, &list.Items[i])
+		}
+	}
 
-	obj, err := kd.dynamicClient.Resource(gvr(&t.With)).Namespace(*t.With.Namespace).Get(context.Background(), t.With.Name, metav1.GetOptions{})
-	if err != nil {
-		return err
+	for _, obj := range objs {
+		if err := checkConditionTrue(obj, o.Conditions); err != nil {
+			return nil, fmt.Errorf("%v %v/%v: %w", o.Resource, obj.GetNamespace(), obj.GetName(), err)
+		}
+		if err := checkJSONPathConditions(obj, o.JSONPath); err != nil {
+			return nil, fmt.Errorf("%v %v/%v: %w", o.Resource, obj.GetNamespace(), obj.GetName(), err)
+		}
 	}
+	return objs, nil
+}
 
+// checkConditionTrue checks if one of the conditions of the object is "True"; the check succeeds if there are no conditions
+func checkConditionTrue(obj *unstructured.Unstructured, conditions []string) error {
 	// if no conditios to check were specified, we can return now
-	if len(t.With.Conditions) == 0 {
+	if len(conditions) == 0 {
 		return nil
 	}
 
 	// set err to nil; will set if there is a problem finding conditions
-	err = nil
+	var err error
 	var cs *string
-	for _, condition := range t.With.Conditions {
+	for _, condition := range conditions {
 		// otherwise, find the condition and check that it is "True"
 		log.Logger.Trace("looking for condition: ", condition)
 
@@ -157,11 +320,31 @@ func checkObjectExistsAndConditionTrue(t *readinessTask, _ *rest.Config) error {
 	return err
 }
 
-func gvr(objRef *readinessInputs) schema.GroupVersionResource {
+// checkJSONPathConditions checks that all the JSONPath checks hold for the object
+func checkJSONPathConditions(obj *unstructured.Unstructured, conditions []jsonPathCondition) error {
+	for _, c := range conditions {
+		actual, ok := findJSONPath(c.Path, obj.Object)
+		if !ok {
+			return fmt.Errorf("no value at %v", c.Path)
+		}
+		expected := c.Equals
+		if c.EqualsPath != "" {
+			if expected, ok = findJSONPath(c.EqualsPath, obj.Object); !ok {
+				return fmt.Errorf("no value at %v", c.EqualsPath)
+			}
+		}
+		if expected != nil && !jsonEqual(expected, actual) {
+			return fmt.Errorf("value at %v is %v; expected %v", c.Path, actual, expected)
+		}
+	}
+	return nil
+}
+
+func gvr(o readinessObject) schema.GroupVersionResource {
 	return schema.GroupVersionResource{
-		Group:    objRef.Group,
-		Version:  objRef.Version,
-		Resource: objRef.Resource,
+		Group:    o.Group,
+		Version:  o.Version,
+		Resource: o.Resource,
 	}
 }
 
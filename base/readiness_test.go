@@ -15,6 +15,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 )
 
 // TestNoObject tests that task fails if the object is not present
@@ -74,6 +75,85 @@ func TestInvalidTimeout(t *testing.T) {
 	runTaskTest(t, rTask, false, ns, pod)
 }
 
+// TestSelectorAndJSONPath tests that all objects that match a selector, and all listed objects, must be ready
+func TestSelectorAndJSONPath(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	ns := "default"
+	*kd = *NewFakeKubeDriver(cli.New())
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	// objects that match selectors are listed
+	kd.dynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{pods: "PodList"})
+	for _, p := range []*unstructured.Unstructured{
+		newPod(ns, "model-0").withLabels(map[string]string{"app": "model"}).withCondition("Ready", "True").build(),
+		newPod(ns, "model-1").withLabels(map[string]string{"app": "model"}).withCondition("Ready", "True").build(),
+		newPod(ns, "other").withLabels(map[string]string{"app": "other"}).withCondition("Ready", "False").build(),
+	} {
+		_, err := kd.dynamicClient.Resource(pods).Namespace(ns).Create(context.Background(), p, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+	_, err := kd.dynamicClient.Resource(deploymentsGVR).Namespace(ns).Create(context.Background(), &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "model", "namespace": ns},
+			"spec":       map[string]interface{}{"replicas": int64(2)},
+			"status":     map[string]interface{}{"readyReplicas": int64(2), "phase": "Serving"},
+		},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	run := func(with readinessInputs) error {
+		with.Timeout = StringPointer("1s")
+		rTask := &readinessTask{TaskMeta: TaskMeta{Task: StringPointer(ReadinessTaskName)}, With: with}
+		exp := &Experiment{Spec: []Task{rTask}, Result: &ExperimentResult{}}
+		return rTask.Run(context.Background(), exp)
+	}
+
+	deployment := readinessObject{
+		Group: "apps", Version: "v1", Resource: "deployments", Name: "model",
+		JSONPath: []jsonPathCondition{
+			{Path: ".status.readyReplicas", EqualsPath: ".spec.replicas"},
+			{Path: "{.status.phase}", Equals: "Serving"},
+		},
+	}
+	assert.NoError(t, run(readinessInputs{
+		Version: "v1", Resource: "pods", Selector: "app=model", Conditions: []string{"Ready"},
+		Objects: []readinessObject{deployment},
+	}))
+
+	// the task fails if any matching object is not ready, or if no object matches
+	assert.Error(t, run(readinessInputs{Version: "v1", Resource: "pods", Selector: "app", Conditions: []string{"Ready"}}))
+	assert.ErrorContains(t, run(readinessInputs{Version: "v1", Resource: "pods", Selector: "app=none"}), "no pods match selector app=none")
+
+	// the task fails if a JSONPath check does not hold
+	deployment.JSONPath = []jsonPathCondition{{Path: ".status.phase", Equals: "Pending"}}
+	assert.ErrorContains(t, run(readinessInputs{Objects: []readinessObject{deployment}}), "value at .status.phase is Serving; expected Pending")
+}
+
+// TestValidateReadinessInputs tests that the identity and checks of every object are validated
+func TestValidateReadinessInputs(t *testing.T) {
+	rTask := &readinessTask{With: readinessInputs{
+		Objects: []readinessObject{
+			{Resource: "pods", Name: "a", Selector: "app=a"},
+			{Resource: "pods", Selector: "app in (", JSONPath: []jsonPathCondition{{Path: ".status[", Equals: 1, EqualsPath: ".spec"}}},
+			{Name: "b"},
+		},
+	}}
+	err := rTask.ValidateInputs()
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "with.resource")
+	assert.Contains(t, err.Error(), "with.objects[0]: specify either name or selector but not both")
+	assert.Contains(t, err.Error(), `with.objects[1].selector: invalid label selector "app in ("`)
+	assert.Contains(t, err.Error(), `with.objects[1].jsonPath[0].path: invalid JSONPath ".status["`)
+	assert.Contains(t, err.Error(), "with.objects[1].jsonPath[0]: specify either equals or equalsPath but not both")
+	assert.Contains(t, err.Error(), "with.objects[2].resource: resource is required")
+
+	// the object specified by the fields of the task is also validated
+	rTask.With.Resource = "pods"
+	err = rTask.ValidateInputs()
+	assert.Contains(t, err.Error(), "with.name: name is required")
+}
+
 // UTILITY METHODS for all tests
 
 // runTaskTest creates fake cluster with pod and runs rTask
@@ -83,7 +163,7 @@ func runTaskTest(t *testing.T, rTask *readinessTask, success bool, ns string, po
 	_, err := kd.dynamicClient.Resource(rs).Namespace(ns).Create(context.Background(), pod, metav1.CreateOptions{})
 	assert.NoError(t, err, "get failed")
 
-	err = rTask.run(&Experiment{
+	err = rTask.Run(context.Background(), &Experiment{
 		Spec:   []Task{rTask},
 		Result: &ExperimentResult{},
 	})
@@ -118,6 +198,11 @@ func (p *podBuilder) build() *unstructured.Unstructured {
 	return &unstructured.Unstructured{Object: o}
 }
 
+func (p *podBuilder) withLabels(labels map[string]string) *podBuilder {
+	p.Labels = labels
+	return p
+}
+
 func (p *podBuilder) withCondition(typ string, value string) *podBuilder {
 	c := corev1.PodCondition{Type: (corev1.PodConditionType(typ))}
 	switch strings.ToLower(value) {
@@ -0,0 +1,112 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	log "github.com/iter8-tools/iter8/base/log"
+)
+
+// TaskFactory creates a new, empty instance of a task
+// The task inputs are unmarshaled into the returned value, which must be a pointer to a struct that embeds TaskMeta
+type TaskFactory func() Task
+
+var (
+	// taskRegistryMu guards taskRegistry
+	taskRegistryMu sync.RWMutex
+	// taskRegistry maps task names to their factories
+	taskRegistry = map[string]TaskFactory{
+		ReadinessTaskName:   func() Task { return &readinessTask{} },
+		CollectHTTPTaskName: func() Task { return &collectHTTPTask{} },
+		CollectGRPCTaskName: func() Task { return &collectGRPCTask{} },
+		NotifyTaskName:      func() Task { return &notifyTask{} },
+		AssessTaskName:      func() Task { return &assessTask{} },
+		K8sTaskName:         func() Task { return &k8sTask{} },
+	}
+)
+
+// RegisterTask makes a task available by name in experiment specs
+// It is intended to be called from the init function of packages that provide tasks,
+// so that they can be linked into a custom Iter8 binary
+//
+// For example, a task with name `warmcache` can be registered as follows
+//
+//	base.RegisterTask("warmcache", func() base.Task { return &warmCacheTask{} })
+//
+// and then used in an experiment spec as `task: warmcache`
+//
+// Like the built-in tasks, the task must be a pointer to a struct that embeds TaskMeta,
+// from which the name, condition and execution policy of the task are read
+func RegisterTask(name string, factory TaskFactory) error {
+	if name == "" {
+		return errors.New("task name cannot be empty")
+	}
+	if name == RunTaskName {
+		return fmt.Errorf("task name %v is reserved", RunTaskName)
+	}
+	if factory == nil {
+		return fmt.Errorf("nil factory for task %v", name)
+	}
+	if !embedsTaskMeta(factory()) {
+		return fmt.Errorf("task %v must be a pointer to a struct that embeds TaskMeta", name)
+	}
+
+	taskRegistryMu.Lock()
+	defer taskRegistryMu.Unlock()
+
+	if _, ok := taskRegistry[name]; ok {
+		e := fmt.Errorf("task %v is already registered", name)
+		log.Logger.Error(e)
+		return e
+	}
+	taskRegistry[name] = factory
+	log.Logger.Debug("registered task: ", name)
+	return nil
+}
+
+// embedsTaskMeta returns true if t is a pointer to a struct that embeds TaskMeta
+func embedsTaskMeta(t Task) bool {
+	v := reflect.ValueOf(t)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	f, ok := v.Elem().Type().FieldByName("TaskMeta")
+	if !ok || !f.Anonymous || f.Type != reflect.TypeOf(TaskMeta{}) {
+		return false
+	}
+	// TaskMeta may be promoted from embedded structs, but not from embedded pointers, which may be nil
+	st := v.Elem().Type()
+	for _, i := range f.Index[:len(f.Index)-1] {
+		ft := st.Field(i).Type
+		if ft.Kind() != reflect.Struct {
+			return false
+		}
+		st = ft
+	}
+	return true
+}
+
+// RegisteredTasks returns the sorted names of all registered tasks
+func RegisteredTasks() []string {
+	taskRegistryMu.RLock()
+	defer taskRegistryMu.RUnlock()
+
+	names := []string{}
+	for name := range taskRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getTaskFactory returns the factory for the named task
+func getTaskFactory(name string) (TaskFactory, bool) {
+	taskRegistryMu.RLock()
+	defer taskRegistryMu.RUnlock()
+
+	factory, ok := taskRegistry[name]
+	return factory, ok
+}
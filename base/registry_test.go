@@ -0,0 +1,99 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// customInputs are the inputs to customTask
+type customInputs struct {
+	Message string `json:"message" yaml:"message"`
+}
+
+// customTask is a task that is not built into Iter8
+type customTask struct {
+	TaskMeta
+	With customInputs `json:"with" yaml:"with"`
+}
+
+// InitializeDefaults sets default values
+func (t *customTask) InitializeDefaults() {
+	if t.With.Message == "" {
+		t.With.Message = "hello"
+	}
+}
+
+// ValidateInputs for this task
+func (t *customTask) ValidateInputs() error {
+	if t.With.Message == "fail" {
+		return errors.New("invalid message")
+	}
+	return nil
+}
+
+// Run executes this task
+func (t *customTask) Run(_ context.Context, exp *Experiment) error {
+	if err := t.ValidateInputs(); err != nil {
+		return err
+	}
+	t.InitializeDefaults()
+
+	exp.Result.initInsights()
+	exp.Result.Insights.TaskData[*t.Task] = t.With.Message
+	return nil
+}
+
+// noMetaTask is a task that does not embed TaskMeta, and so cannot be registered
+type noMetaTask struct {
+	With customInputs `json:"with" yaml:"with"`
+}
+
+// InitializeDefaults sets default values
+func (t *noMetaTask) InitializeDefaults() {}
+
+// ValidateInputs for this task
+func (t *noMetaTask) ValidateInputs() error { return nil }
+
+// Run executes this task
+func (t *noMetaTask) Run(_ context.Context, _ *Experiment) error { return nil }
+
+// unregisterTask removes a task from the registry, so that tests do not leak registrations
+func unregisterTask(name string) {
+	taskRegistryMu.Lock()
+	defer taskRegistryMu.Unlock()
+	delete(taskRegistry, name)
+}
+
+func TestRegisterTask(t *testing.T) {
+	err := RegisterTask("custom", func() Task { return &customTask{} })
+	assert.NoError(t, err)
+	t.Cleanup(func() { unregisterTask("custom") })
+	assert.Contains(t, RegisteredTasks(), "custom")
+	assert.Contains(t, RegisteredTasks(), CollectHTTPTaskName)
+
+	// invalid registrations
+	assert.Error(t, RegisterTask("custom", func() Task { return &customTask{} }))
+	assert.Error(t, RegisterTask(CollectHTTPTaskName, func() Task { return &customTask{} }))
+	assert.Error(t, RegisterTask("", func() Task { return &customTask{} }))
+	assert.Error(t, RegisterTask(RunTaskName, func() Task { return &customTask{} }))
+	assert.Error(t, RegisterTask("nilfactory", nil))
+	assert.ErrorContains(t, RegisterTask("nometa", func() Task { return &noMetaTask{} }), "must be a pointer to a struct that embeds TaskMeta")
+	assert.ErrorContains(t, RegisterTask("niltask", func() Task { return nil }), "must be a pointer to a struct that embeds TaskMeta")
+	assert.NotContains(t, RegisteredTasks(), "nometa")
+
+	// registered task can be used in an experiment spec
+	spec := ExperimentSpec{}
+	err = spec.UnmarshalJSON([]byte(`[{"task":"custom","with":{"message":"world"}}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(spec))
+	assert.Equal(t, "custom", *getName(spec[0]))
+
+	exp := &Experiment{Spec: spec}
+	exp.initResults(1)
+	err = spec[0].Run(context.Background(), exp)
+	assert.NoError(t, err)
+	assert.Equal(t, "world", exp.Result.Insights.TaskData["custom"])
+}
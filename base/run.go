@@ -1,9 +1,17 @@
 package base
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	log "github.com/iter8-tools/iter8/base/log"
 )
@@ -11,54 +19,239 @@ import (
 const (
 	// RunTaskName is the name of the run task which performs running of a shell script
 	RunTaskName = "run"
+
+	// stdoutOutput is the output with the standard output of the script, without trailing whitespace
+	stdoutOutput = "stdout"
+	// jsonOutput is the output with the standard output of the script parsed as JSON, if it is valid JSON
+	jsonOutput = "json"
+
+	// runTemplatesInput is the input of run tasks that enables references in their scripts
+	runTemplatesInput = "templates"
+
+	// truncatedPrefix marks output whose beginning was not recorded
+	truncatedPrefix = "...(truncated) "
 )
 
 var (
 	// tempDirEnv is a temporary directory
 	tempDirEnv = fmt.Sprintf("TEMP_DIR=%v", os.TempDir())
+	// commandWaitDelay bounds the wait for output from processes started by the script after it is killed
+	commandWaitDelay = time.Second
+)
+
+const (
+	// defaultShell is the shell that runs scripts
+	defaultShell = "/bin/bash"
+	// defaultMaxOutputSize is the maximum number of bytes of the standard output and error recorded in the result
+	defaultMaxOutputSize = 4096
+	// maxStdoutOutputSize is the maximum number of bytes of the standard output that is published as outputs and parsed as JSON
+	maxStdoutOutputSize = 1 << 20
 )
 
+// runInputs are the inputs of the run task
+type runInputs struct {
+	// Env are environment variables of the script, in addition to those of Iter8; optional
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	// Workdir is the working directory of the script; optional. Default is the working directory of Iter8.
+	Workdir string `json:"workdir,omitempty" yaml:"workdir,omitempty"`
+	// Shell runs the script as <shell> -c <script>; optional. Default is /bin/bash.
+	Shell string `json:"shell,omitempty" yaml:"shell,omitempty"`
+	// Templates enables references to the outputs of earlier tasks and to values in the script (example, {{ .Outputs.login.stdout }}); optional.
+	// Default is false, so that scripts can use the templates of other tools, such as kubectl -o go-template.
+	Templates bool `json:"templates,omitempty" yaml:"templates,omitempty"`
+	// MaxOutputSize is the maximum number of bytes of the standard output and error recorded in the result; optional. Default is 4096.
+	// Only the end of longer output is recorded.
+	MaxOutputSize *int `json:"maxOutputSize,omitempty" yaml:"maxOutputSize,omitempty"`
+}
+
 // runTask enables running a shell script
+// The script is killed if the task times out
 type runTask struct {
 	// TaskMeta has fields common to all tasks
 	TaskMeta
+	// With are the inputs of the task
+	With runInputs `json:"with,omitempty" yaml:"with,omitempty"`
+
+	// result is the result of the last run of the script
+	result *CommandResult
 }
 
-// initializeDefaults sets default values for task inputs
-func (t *runTask) initializeDefaults() {}
+// InitializeDefaults sets default values for task inputs
+func (t *runTask) InitializeDefaults() {
+	if t.With.Shell == "" {
+		t.With.Shell = defaultShell
+	}
+	if t.With.MaxOutputSize == nil {
+		t.With.MaxOutputSize = IntPointer(defaultMaxOutputSize)
+	}
+}
 
-// validateInputs for this task
-func (t *runTask) validateInputs() error {
-	return nil
+// ValidateInputs for this task
+func (t *runTask) ValidateInputs() error {
+	errs := []error{}
+	if t.TaskMeta.Run == nil || strings.TrimSpace(*t.TaskMeta.Run) == "" {
+		errs = append(errs, newFieldError("run", "command cannot be empty"))
+	}
+	if t.With.MaxOutputSize != nil && *t.With.MaxOutputSize < 0 {
+		errs = append(errs, newFieldError("with.maxOutputSize", "must not be negative"))
+	}
+	return errors.Join(errs...)
 }
 
 // getCommand gets the executable command
-func (t *runTask) getCommand() *exec.Cmd {
+// The command is killed when ctx is done
+func (t *runTask) getCommand(ctx context.Context) *exec.Cmd {
 	cmdStr := *t.TaskMeta.Run
 	// create command to be executed
 	// #nosec
-	cmd := exec.Command("/bin/bash", "-c", cmdStr)
-	// append the environment variable for temp dir
+	cmd := exec.CommandContext(ctx, t.With.Shell, "-c", cmdStr)
+	cmd.WaitDelay = commandWaitDelay
+	cmd.Dir = t.With.Workdir
+	// append the environment variable for temp dir, and those of the task
 	cmd.Env = append(os.Environ(), tempDirEnv)
+	for name, value := range t.With.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
 	return cmd
 }
 
-// run the command
-func (t *runTask) run(_ *Experiment) error {
-	err := t.validateInputs()
+// Run the command
+// The exit code, standard output and standard error of the command are recorded in the result of the task, up to MaxOutputSize bytes each.
+// The standard output of the command is published as the stdout output of the task,
+// and also as the json output if it is valid JSON; JSON output is also recorded in the task data (see setRunTaskData).
+// Standard output longer than maxStdoutOutputSize is not published.
+func (t *runTask) Run(ctx context.Context, exp *Experiment) error {
+	err := t.ValidateInputs()
 	if err != nil {
 		return err
 	}
 
-	t.initializeDefaults()
+	t.InitializeDefaults()
 
-	cmd := t.getCommand()
-	out, err := cmd.CombinedOutput()
+	cmd := t.getCommand(ctx)
+	// the output of the command is bounded, so that chatty scripts do not use unbounded memory
+	stdout := &tailBuffer{max: *t.With.MaxOutputSize}
+	stderr := &tailBuffer{max: *t.With.MaxOutputSize}
+	published := &headBuffer{max: maxStdoutOutputSize}
+	cmd.Stdout = io.MultiWriter(stdout, published)
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	t.result = &CommandResult{
+		ExitCode: exitCode(cmd, err),
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	}
 	if err != nil {
 		log.Logger.WithStackTrace(err.Error()).Error("combined execution failed")
-		log.Logger.WithStackTrace(string(out)).Error("combined output from command")
+		log.Logger.WithStackTrace(stdout.String()).Error("output from command")
+		log.Logger.WithStackTrace(stderr.String()).Error("error output from command")
 		return err
 	}
-	log.Logger.WithStackTrace(string(out)).Trace("combined output from command")
+	log.Logger.WithStackTrace(stdout.String()).Trace("output from command")
+	log.Logger.WithStackTrace(stderr.String()).Trace("error output from command")
+
+	if published.exceeded {
+		log.Logger.Warnf("output from command is longer than %d bytes; it is not published as outputs", maxStdoutOutputSize)
+		return nil
+	}
+	out := strings.TrimRight(published.buf.String(), " \t\r\n")
+	exp.setTaskOutput(t.TaskMeta, stdoutOutput, out)
+	var v interface{}
+	if json.Unmarshal([]byte(out), &v) == nil {
+		exp.setTaskOutput(t.TaskMeta, jsonOutput, v)
+		exp.setRunTaskData(t.TaskMeta, v)
+	}
 	return nil
 }
+
+// commandResult returns the result of the last run of the script
+func (t *runTask) commandResult() *CommandResult {
+	return t.result
+}
+
+// exitCode returns the exit code of a command that has run; it is -1 if the command did not start or was killed
+func exitCode(cmd *exec.Cmd, err error) int {
+	if cmd.ProcessState != nil {
+		return cmd.ProcessState.ExitCode()
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitCode()
+	}
+	return -1
+}
+
+// tailBuffer is a writer that keeps the last max bytes of the output of a command, and counts all of its bytes
+type tailBuffer struct {
+	max   int
+	buf   []byte
+	total int64
+}
+
+// Write keeps the last max bytes of the output written so far
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.total += int64(len(p))
+	if len(p) >= b.max {
+		b.buf = append(b.buf[:0], p[len(p)-b.max:]...)
+		return len(p), nil
+	}
+	if over := len(b.buf) + len(p) - b.max; over > 0 {
+		b.buf = b.buf[:copy(b.buf, b.buf[over:])]
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// String returns the kept output, starting at a character boundary and marked if its beginning was not kept
+func (b *tailBuffer) String() string {
+	s := string(b.buf)
+	if int64(len(s)) == b.total {
+		return s
+	}
+	i := 0
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return truncatedPrefix + s[i:]
+}
+
+// headBuffer is a writer that keeps the first max bytes of the output of a command
+type headBuffer struct {
+	max      int
+	buf      bytes.Buffer
+	exceeded bool
+}
+
+// Write keeps the output written so far, up to max bytes
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if remaining := b.max - b.buf.Len(); len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.exceeded = true
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+// setRunTaskData records the JSON output of a run task in the task data, keyed by task ID (example, `if: Result.Insights.TaskData.run.check.healthy`)
+// Tasks without an ID are keyed by their position, like their task results: 2 for the second task in the spec, finally-1 for the first finally task
+// (example, `if: Result.Insights.TaskData.run["2"].healthy`)
+func (exp *Experiment) setRunTaskData(tm TaskMeta, v interface{}) {
+	if exp == nil || exp.Result == nil {
+		return
+	}
+	key := exp.taskKey
+	if tm.ID != nil {
+		key = *tm.ID
+	}
+	if key == "" {
+		return
+	}
+	exp.Result.initInsights()
+	data, ok := exp.Result.Insights.TaskData[RunTaskName].(map[string]interface{})
+	if !ok {
+		data = map[string]interface{}{}
+	}
+	data[key] = v
+	exp.Result.Insights.TaskData[RunTaskName] = data
+}
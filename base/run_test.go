@@ -1,10 +1,14 @@
 package base
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
 )
 
 func TestRunRun(t *testing.T) {
@@ -21,6 +25,124 @@ func TestRunRun(t *testing.T) {
 		Result: &ExperimentResult{},
 	}
 	exp.initResults(1)
-	err := rt.run(exp)
+	err := rt.Run(context.Background(), exp)
 	assert.NoError(t, err)
 }
+
+func TestRunEnvWorkdirAndShell(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.Chdir(t.TempDir())
+	rt := &runTask{
+		TaskMeta: TaskMeta{
+			ID:  StringPointer("check"),
+			Run: StringPointer(`printf '{"greeting": "%s", "dir": "%s"}' "$GREETING" "$(pwd)"; echo warning >&2`),
+		},
+		With: runInputs{
+			Env:     map[string]string{"GREETING": "hello"},
+			Workdir: dir,
+			Shell:   "/bin/sh",
+		},
+	}
+	exp := &Experiment{Spec: []Task{rt}, Result: &ExperimentResult{}}
+	exp.initResults(1)
+	assert.NoError(t, rt.Run(context.Background(), exp))
+
+	// the result records the exit code and output of the command
+	assert.Equal(t, 0, rt.commandResult().ExitCode)
+	assert.Contains(t, rt.commandResult().Stdout, `"greeting": "hello"`)
+	assert.Equal(t, "warning\n", rt.commandResult().Stderr)
+
+	// JSON output is recorded in the task data
+	data := exp.Result.Insights.TaskData[RunTaskName].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"greeting": "hello", "dir": dir}, data["check"])
+	// the insights of an experiment always describe at least one version
+	assert.Equal(t, 1, exp.Result.Insights.NumVersions)
+}
+
+func TestRunTaskDataKeys(t *testing.T) {
+	setupMockMetricsServer(t)
+	_ = os.Chdir(t.TempDir())
+	exp := &Experiment{}
+	err := yaml.Unmarshal([]byte(`
+spec:
+- run: echo '{"healthy":true}'
+- if: Result.Insights.TaskData.run["1"].healthy
+  id: check
+  run: echo '{"ready":true}'
+finally:
+- run: echo '{"done":true}'
+`), exp)
+	assert.NoError(t, err)
+	exp.initResults(1)
+	assert.NoError(t, exp.run(context.Background(), &mockDriver{exp}))
+
+	// tasks without an ID are keyed by their position
+	assert.Equal(t, map[string]interface{}{
+		"1":         map[string]interface{}{"healthy": true},
+		"check":     map[string]interface{}{"ready": true},
+		"finally-1": map[string]interface{}{"done": true},
+	}, exp.Result.Insights.TaskData[RunTaskName])
+}
+
+func TestRunFailureAndTimeout(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	rt := &runTask{
+		TaskMeta: TaskMeta{Run: StringPointer("seq 1 1000; echo failed >&2; exit 3")},
+		With:     runInputs{MaxOutputSize: IntPointer(10)},
+	}
+	exp := &Experiment{Spec: []Task{rt}, Result: &ExperimentResult{}}
+	exp.initResults(1)
+
+	setupMockMetricsServer(t)
+
+	// the failed command is recorded in the result of the task, with its output truncated
+	assert.NoError(t, exp.runSpec(context.Background(), &mockDriver{}))
+	tr := exp.Result.TaskResults[0]
+	assert.Equal(t, TaskFailed, tr.Status)
+	assert.Equal(t, 3, tr.Command.ExitCode)
+	assert.Equal(t, truncatedPrefix+"\n999\n1000\n", tr.Command.Stdout)
+	assert.Equal(t, "failed\n", tr.Command.Stderr)
+
+	// the command is killed when the task times out
+	rt.TaskMeta.Run = StringPointer("sleep 10")
+	rt.TaskMeta.Timeout = StringPointer("100ms")
+	start := time.Now()
+	err := executeTask(context.Background(), rt, exp)
+	assert.ErrorContains(t, err, "task timed out after 100ms")
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, -1, rt.commandResult().ExitCode)
+
+	// invalid inputs
+	rt.With.MaxOutputSize = IntPointer(-1)
+	assert.ErrorContains(t, rt.ValidateInputs(), "with.maxOutputSize: must not be negative")
+}
+
+func TestRunBoundedOutput(t *testing.T) {
+	// output is kept up to the limit, across writes and at character boundaries
+	b := &tailBuffer{max: 5}
+	for _, w := range []string{"ab", "cd", "éfg"} {
+		_, _ = b.Write([]byte(w))
+	}
+	assert.Equal(t, int64(8), b.total)
+	assert.Equal(t, truncatedPrefix+"défg", b.String())
+	_, _ = b.Write([]byte("hi"))
+	assert.Equal(t, truncatedPrefix+"fghi", b.String())
+	b = &tailBuffer{max: 5}
+	_, _ = b.Write([]byte("abc"))
+	assert.Equal(t, "abc", b.String())
+
+	// output too long to be published is still recorded in the result
+	_ = os.Chdir(t.TempDir())
+	rt := &runTask{
+		TaskMeta: TaskMeta{
+			ID:  StringPointer("chatty"),
+			Run: StringPointer(fmt.Sprintf("head -c %d /dev/zero | tr '\\0' a; echo done", maxStdoutOutputSize)),
+		},
+		With: runInputs{MaxOutputSize: IntPointer(10)},
+	}
+	exp := &Experiment{Spec: []Task{rt}, Result: &ExperimentResult{}}
+	exp.initResults(1)
+	assert.NoError(t, rt.Run(context.Background(), exp))
+	assert.Equal(t, truncatedPrefix+"aaaaadone\n", rt.commandResult().Stdout)
+	assert.NotContains(t, exp.Result.Outputs, "chatty")
+}
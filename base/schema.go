@@ -0,0 +1,193 @@
+package base
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/bojand/ghz/runner"
+	"helm.sh/helm/v3/pkg/time"
+)
+
+const (
+	// SchemaDraft is the JSON Schema draft used by ExperimentSchema
+	SchemaDraft = "http://json-schema.org/draft-07/schema#"
+)
+
+// schemaOverrides are the schemas of types whose JSON form differs from their Go form
+var schemaOverrides = map[reflect.Type]map[string]interface{}{
+	// ghz durations are strings in the Go duration string format, or integers in nanoseconds
+	reflect.TypeOf(runner.Duration(0)): {"type": []string{"string", "integer"}},
+	reflect.TypeOf(time.Time{}):        {"type": "string"},
+}
+
+// ExperimentSchema returns a JSON Schema for experiments
+// The schema is generated from the Go types of the experiment and of the inputs of every registered task,
+// so that it stays in sync with them
+func ExperimentSchema() map[string]interface{} {
+	definitions := map[string]interface{}{}
+	taskNames := RegisteredTasks()
+	conditions := []interface{}{}
+	for _, name := range taskNames {
+		factory, _ := getTaskFactory(name)
+		with, ok := withType(reflect.TypeOf(factory()))
+		if !ok {
+			continue
+		}
+		definitions[name] = withValueFrom(typeSchema(with))
+		conditions = append(conditions, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"task": map[string]interface{}{"const": name}},
+				"required":   []string{"task"},
+			},
+			"then": map[string]interface{}{
+				"properties": map[string]interface{}{"with": map[string]interface{}{"$ref": "#/definitions/" + name}},
+			},
+		})
+	}
+
+	// run tasks are identified by their script rather than by their name
+	definitions[RunTaskName] = withValueFrom(typeSchema(reflect.TypeOf(runInputs{})))
+	conditions = append(conditions, map[string]interface{}{
+		"if": map[string]interface{}{"required": []string{"run"}},
+		"then": map[string]interface{}{
+			"properties": map[string]interface{}{"with": map[string]interface{}{"$ref": "#/definitions/" + RunTaskName}},
+		},
+	})
+
+	// common fields of tasks are those of TaskMeta, with the names of tasks and failure policies enumerated
+	task := typeSchema(reflect.TypeOf(TaskMeta{}))
+	properties := task["properties"].(map[string]interface{})
+	properties["task"] = map[string]interface{}{"type": "string", "enum": taskNames}
+	properties["onFailure"] = map[string]interface{}{"type": "string", "enum": []string{OnFailureAbort, OnFailureContinue}}
+	properties["with"] = map[string]interface{}{"type": "object"}
+	task["oneOf"] = []interface{}{
+		map[string]interface{}{"required": []string{"task"}},
+		map[string]interface{}{"required": []string{"run"}},
+	}
+	task["allOf"] = conditions
+	definitions["task"] = task
+
+	// string inputs of tasks may be references to values that are resolved when the task runs
+	ref := typeSchema(reflect.TypeOf(valueFrom{}))
+	ref["minProperties"], ref["maxProperties"] = 1, 1
+	definitions[valueFromKey] = map[string]interface{}{
+		"type":                 "object",
+		"properties":           map[string]interface{}{valueFromKey: ref},
+		"required":             []string{valueFromKey},
+		"additionalProperties": false,
+	}
+
+	tasks := map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"$ref": "#/definitions/task"},
+	}
+
+	return map[string]interface{}{
+		"$schema":     SchemaDraft,
+		"title":       "Iter8 experiment",
+		"type":        "object",
+		"definitions": definitions,
+		"properties": map[string]interface{}{
+			"metadata": typeSchema(reflect.TypeOf(ExperimentMetadata{})),
+			"spec":     tasks,
+			"finally":  tasks,
+			"deadline": map[string]interface{}{"type": "string"},
+			"result":   map[string]interface{}{"type": "object"},
+		},
+		"additionalProperties": false,
+	}
+}
+
+// withType returns the type of the inputs of a task, which are in its with field
+func withType(t reflect.Type) (reflect.Type, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name == "with" {
+			return f.Type, true
+		}
+	}
+	return nil, false
+}
+
+// withValueFrom returns a copy of the schema s of task inputs in which strings may also be references (see extractValueFrom)
+func withValueFrom(s map[string]interface{}) map[string]interface{} {
+	if s["type"] == "string" {
+		return map[string]interface{}{
+			"oneOf": []interface{}{s, map[string]interface{}{"$ref": "#/definitions/" + valueFromKey}},
+		}
+	}
+	r := map[string]interface{}{}
+	for k, v := range s {
+		r[k] = v
+	}
+	if properties, ok := s["properties"].(map[string]interface{}); ok {
+		rp := map[string]interface{}{}
+		for name, p := range properties {
+			rp[name] = withValueFrom(p.(map[string]interface{}))
+		}
+		r["properties"] = rp
+	}
+	for _, k := range []string{"items", "additionalProperties"} {
+		if v, ok := s[k].(map[string]interface{}); ok {
+			r[k] = withValueFrom(v)
+		}
+	}
+	return r
+}
+
+// typeSchema returns the JSON Schema of values of a Go type, as encoded by encoding/json
+func typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if s, ok := schemaOverrides[t]; ok {
+		return s
+	}
+	// types with custom unmarshaling may accept anything
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return map[string]interface{}{}
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		// byte slices are encoded as base64 strings
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"}
+		}
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for name, ft := range jsonFields(t) {
+			properties[name] = typeSchema(ft)
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	default:
+		// interfaces may hold any value
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,110 @@
+package base
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+	"sigs.k8s.io/yaml"
+)
+
+// validateAgainstSchema validates an experiment, specified in YAML, against the experiment schema
+func validateAgainstSchema(t *testing.T, b []byte) *gojsonschema.Result {
+	j, err := yaml.YAMLToJSON(b)
+	assert.NoError(t, err)
+	result, err := gojsonschema.Validate(gojsonschema.NewGoLoader(ExperimentSchema()), gojsonschema.NewBytesLoader(j))
+	assert.NoError(t, err)
+	return result
+}
+
+func TestExperimentSchema(t *testing.T) {
+	schema := ExperimentSchema()
+	assert.Equal(t, SchemaDraft, schema["$schema"])
+
+	// every registered task with inputs has a definition
+	definitions := schema["definitions"].(map[string]interface{})
+	for _, name := range RegisteredTasks() {
+		assert.Contains(t, definitions, name)
+	}
+
+	// fields of the Go structs appear in the schema
+	http := definitions[CollectHTTPTaskName].(map[string]interface{})["properties"].(map[string]interface{})
+	for _, field := range []string{"url", "duration", "errorRanges", "endpoints", "warmup"} {
+		assert.Contains(t, http, field)
+	}
+
+	b, err := os.ReadFile(CompletePath("../testdata", "experiment.yaml"))
+	assert.NoError(t, err)
+	assert.True(t, validateAgainstSchema(t, b).Valid())
+
+	result := validateAgainstSchema(t, []byte(`
+spec:
+- task: ready
+  with:
+    name: httpbin
+    resource: deployments
+    timeout: 60s
+- task: grpc
+  with:
+    call: helloworld.Greeter.SayHello
+    host: 127.0.0.1:50051
+    timeout: 10s
+    connect-timeout: 5000000000
+finally:
+- run: echo done
+  onFailure: continue
+  with:
+    shell: /bin/sh
+    env:
+      GREETING: done
+`))
+	assert.True(t, result.Valid(), result.Errors())
+
+	// string inputs may be references to values that are resolved when the task runs
+	result = validateAgainstSchema(t, []byte(`
+spec:
+- task: http
+  with:
+    url:
+      valueFrom:
+        env: URL
+    headers:
+      Authorization:
+        valueFrom:
+          secretKeyRef:
+            name: creds
+            key: token
+    endpoints:
+      a:
+        payloadStr:
+          valueFrom:
+            file: /etc/payload
+- run: echo $TOKEN
+  with:
+    env:
+      TOKEN:
+        valueFrom:
+          env: TOKEN
+`))
+	assert.True(t, result.Valid(), result.Errors())
+
+	// the grpc sample has misspelled and unsupported inputs
+	b, err = os.ReadFile(CompletePath("../testdata", "experiment_grpc.yaml"))
+	assert.NoError(t, err)
+	assert.False(t, validateAgainstSchema(t, b).Valid())
+
+	for _, invalid := range []string{
+		"spec:\n- task: hello\n",
+		"spec:\n- task: http\n  run: echo hello\n",
+		"spec:\n- run: echo hello\n  onFailure: stop\n",
+		"spec:\n- task: http\n  with:\n    qps: fast\n",
+		"spec:\n- run: echo hello\n  with:\n    maxOutputSize: large\n",
+		"spec:\n- task: http\n  with:\n    url:\n      valueFrom: {env: URL, file: /etc/url}\n",
+		"spec:\n- task: http\n  with:\n    url:\n      valueFrom: {secret: creds}\n",
+		"spec:\n- task: http\n  with:\n    qps:\n      valueFrom: {env: QPS}\n",
+		"deadlin: 10m\n",
+	} {
+		assert.False(t, validateAgainstSchema(t, []byte(invalid)).Valid(), invalid)
+	}
+}
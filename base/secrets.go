@@ -0,0 +1,321 @@
+package base
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	log "github.com/iter8-tools/iter8/base/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// valueFromKey is the key of a reference to a value that is resolved when a task runs
+	// (example, {valueFrom: {secretKeyRef: {name: creds, key: token}}})
+	valueFromKey = "valueFrom"
+	// valueFromFunc is the function that resolves references in payload templates of notifications
+	valueFromFunc = "valueFrom"
+
+	// valueFromEnv refers to an environment variable
+	valueFromEnv = "env"
+	// valueFromFile refers to the content of a file, such as a key of a Kubernetes secret mounted as a volume
+	valueFromFile = "file"
+	// valueFromSecretKeyRef refers to a key of a Kubernetes secret in the namespace of the experiment
+	valueFromSecretKeyRef = "secretKeyRef"
+)
+
+// secretGVR is the resource of Kubernetes secrets
+var secretGVR = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// valueFrom is a reference to a value that is resolved when a task runs
+// Exactly one of its fields must be specified. Resolved values of at least 4 bytes are redacted in logs and in results sent to the metrics service.
+type valueFrom struct {
+	// Env is the name of an environment variable
+	Env string `json:"env,omitempty"`
+	// File is the path of a file; leading and trailing white space is removed from its content
+	File string `json:"file,omitempty"`
+	// SecretKeyRef is a key of a Kubernetes secret in the namespace of the experiment
+	SecretKeyRef *secretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// secretKeySelector selects a key of a Kubernetes secret
+type secretKeySelector struct {
+	// Name of the secret
+	Name string `json:"name"`
+	// Key of the secret
+	Key string `json:"key"`
+}
+
+// valueFromPlaceholder replaces references in the inputs of a task until they are resolved, just before the task runs
+// Like templates, placeholders are not checked when inputs are validated
+const valueFromPlaceholder = "[valueFrom]"
+
+// valueFromRef is a reference in the inputs of a task, and its location
+type valueFromRef struct {
+	// path is the location of the reference in the inputs, as map keys and slice indices
+	path []interface{}
+	// ref is the reference
+	ref valueFrom
+}
+
+// valueFromTask is a task whose inputs may have references; tasks that embed TaskMeta are such tasks
+type valueFromTask interface {
+	valueFromRefs() []valueFromRef
+	setValueFromRefs(refs []valueFromRef)
+}
+
+// valueFromRefs returns the references in the inputs of the task
+func (tm *TaskMeta) valueFromRefs() []valueFromRef {
+	return tm.refs
+}
+
+// setValueFromRefs records the references in the inputs of the task
+func (tm *TaskMeta) setValueFromRefs(refs []valueFromRef) {
+	tm.refs = refs
+}
+
+// decodeValueFrom returns the reference r; path is the path of the reference
+func decodeValueFrom(path string, r interface{}) (valueFrom, error) {
+	var ref valueFrom
+	b, err := json.Marshal(r)
+	if err != nil {
+		return ref, newFieldError(path, "invalid reference")
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&ref); err != nil {
+		return ref, newFieldError(path, "invalid reference; expected one of env, file and secretKeyRef")
+	}
+
+	switch {
+	case ref.Env != "" && ref.File == "" && ref.SecretKeyRef == nil:
+	case ref.File != "" && ref.Env == "" && ref.SecretKeyRef == nil:
+	case ref.SecretKeyRef != nil && ref.Env == "" && ref.File == "":
+		if ref.SecretKeyRef.Name == "" || ref.SecretKeyRef.Key == "" {
+			return ref, newFieldError(path+"."+valueFromSecretKeyRef, "name and key are required")
+		}
+	default:
+		return ref, newFieldError(path, "specify exactly one of env, file and secretKeyRef")
+	}
+	return ref, nil
+}
+
+// extractValueFrom replaces the references in the decoded JSON value v at path by placeholders, and returns them
+// loc is the location of v in the inputs of the task
+// References are resolved just before a task runs, so that their values are not part of the experiment
+func extractValueFrom(path string, loc []interface{}, v interface{}) (interface{}, []valueFromRef, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if r, ok := val[valueFromKey]; ok && len(val) == 1 {
+			ref, err := decodeValueFrom(path+"."+valueFromKey, r)
+			if err != nil {
+				return "", nil, err
+			}
+			return valueFromPlaceholder, []valueFromRef{{path: loc, ref: ref}}, nil
+		}
+		refs := []valueFromRef{}
+		errs := []error{}
+		for k, e := range val {
+			// invalid references are replaced by empty values, so that the rest of the inputs can be checked
+			r, kr, err := extractValueFrom(path+"."+k, append(slices.Clip(loc), k), e)
+			errs = append(errs, err)
+			refs = append(refs, kr...)
+			val[k] = r
+		}
+		return val, refs, errors.Join(errs...)
+	case []interface{}:
+		refs := []valueFromRef{}
+		errs := []error{}
+		for i, e := range val {
+			r, ir, err := extractValueFrom(fmt.Sprintf("%v[%d]", path, i), append(slices.Clip(loc), i), e)
+			errs = append(errs, err)
+			refs = append(refs, ir...)
+			val[i] = r
+		}
+		return val, refs, errors.Join(errs...)
+	default:
+		return v, nil, nil
+	}
+}
+
+// setValueFrom sets the value at the location loc in the decoded JSON value v
+func setValueFrom(v interface{}, loc []interface{}, value string) {
+	for i, key := range loc {
+		last := i == len(loc)-1
+		switch k := key.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return
+			}
+			if last {
+				m[k] = value
+				return
+			}
+			v = m[k]
+		case int:
+			a, ok := v.([]interface{})
+			if !ok || k >= len(a) {
+				return
+			}
+			if last {
+				a[k] = value
+				return
+			}
+			v = a[k]
+		}
+	}
+}
+
+// taskFuncMap returns the functions available to payload templates of notifications, which may resolve references
+// (example, {{ valueFrom "env" "TOKEN" }})
+func taskFuncMap(exp *Experiment) template.FuncMap {
+	f := FuncMapWithToYAML()
+	f[valueFromFunc] = func(kind string, args ...string) (string, error) {
+		ref := valueFrom{}
+		switch {
+		case kind == valueFromEnv && len(args) == 1:
+			ref.Env = args[0]
+		case kind == valueFromFile && len(args) == 1:
+			ref.File = args[0]
+		case kind == valueFromSecretKeyRef && len(args) == 2:
+			ref.SecretKeyRef = &secretKeySelector{Name: args[0], Key: args[1]}
+		default:
+			return "", fmt.Errorf("invalid reference of kind %v", kind)
+		}
+		return exp.resolveValueFrom(ref)
+	}
+	return f
+}
+
+// resolveValueFrom returns the value of a reference; the value is redacted from now on
+func (exp *Experiment) resolveValueFrom(ref valueFrom) (string, error) {
+	var value string
+	switch {
+	case ref.Env != "":
+		v, ok := os.LookupEnv(ref.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %v is not set", ref.Env)
+		}
+		value = v
+	case ref.File != "":
+		b, err := os.ReadFile(filepath.Clean(ref.File))
+		if err != nil {
+			e := fmt.Errorf("unable to read file %v", ref.File)
+			log.Logger.WithStackTrace(err.Error()).Error(e)
+			return "", e
+		}
+		value = strings.TrimSpace(string(b))
+	case ref.SecretKeyRef != nil:
+		v, err := exp.getSecretValue(ref.SecretKeyRef.Name, ref.SecretKeyRef.Key)
+		if err != nil {
+			return "", err
+		}
+		value = v
+	default:
+		return "", errors.New("invalid reference")
+	}
+	log.AddSecret(value)
+	return value, nil
+}
+
+// resolveValueFroms sets the values of the references of a task in its inputs, decoded from JSON
+func (exp *Experiment) resolveValueFroms(with interface{}, refs []valueFromRef) error {
+	errs := []error{}
+	for _, r := range refs {
+		value, err := exp.resolveValueFrom(r.ref)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		setValueFrom(with, r.path, value)
+	}
+	return errors.Join(errs...)
+}
+
+// getSecretValue returns the value of a key of a Kubernetes secret in the namespace of the experiment
+func (exp *Experiment) getSecretValue(name string, key string) (string, error) {
+	if err := kd.initKube(); err != nil {
+		return "", err
+	}
+	namespace := kd.Namespace()
+	if exp != nil && exp.Metadata.Namespace != "" {
+		namespace = exp.Metadata.Namespace
+	}
+
+	obj, err := kd.dynamicClient.Resource(secretGVR).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		e := fmt.Errorf("unable to get secret %v/%v", namespace, name)
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return "", e
+	}
+	data, found, err := unstructured.NestedString(obj.Object, "data", key)
+	if err != nil || !found {
+		return "", fmt.Errorf("secret %v/%v has no key %v", namespace, name, key)
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("invalid value of key %v of secret %v/%v", key, namespace, name)
+	}
+	return string(b), nil
+}
+
+// redactValue redacts secret values in the strings and map keys of the decoded JSON value v
+func redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return log.Redact(val)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(val))
+		for k, e := range val {
+			redacted[log.Redact(k)] = redactValue(e)
+		}
+		return redacted
+	case []interface{}:
+		for i, e := range val {
+			val[i] = redactValue(e)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// redactResult returns the decoded JSON form of an experiment result, with secret values redacted
+func redactResult(r *ExperimentResult) (interface{}, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return redactValue(v), nil
+}
+
+// valueFromErrors reports the invalid references in the inputs of the task b at path
+// The task is returned with its references replaced by placeholders
+func valueFromErrors(path string, b []byte) ([]ValidationError, []byte) {
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil || v["with"] == nil {
+		return nil, b
+	}
+	_, _, err := extractValueFrom(joinPath(path, "with"), nil, v["with"])
+	problems := toValidationErrors("", err)
+	r, err := json.Marshal(v)
+	if err != nil {
+		return problems, b
+	}
+	return problems, r
+}
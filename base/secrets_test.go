@@ -0,0 +1,178 @@
+package base
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"fortio.org/fortio/fhttp"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/cli"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestValueFromReferences(t *testing.T) {
+	var s ExperimentSpec
+	err := yaml.Unmarshal([]byte(`
+- task: http
+  with:
+    url:
+      valueFrom:
+        env: APP_URL
+    headers:
+      Authorization:
+        valueFrom:
+          secretKeyRef:
+            name: creds
+            key: token
+    payloadStr:
+      valueFrom:
+        file: /etc/payload/body
+`), &s)
+	assert.NoError(t, err)
+	ct := s[0].(*collectHTTPTask)
+	assert.Equal(t, valueFromPlaceholder, ct.With.URL)
+	assert.Equal(t, valueFromPlaceholder, ct.With.Headers["Authorization"])
+	assert.Equal(t, valueFromPlaceholder, *ct.With.PayloadStr)
+	assert.ElementsMatch(t, []valueFromRef{
+		{path: []interface{}{"url"}, ref: valueFrom{Env: "APP_URL"}},
+		{path: []interface{}{"headers", "Authorization"}, ref: valueFrom{SecretKeyRef: &secretKeySelector{Name: "creds", Key: "token"}}},
+		{path: []interface{}{"payloadStr"}, ref: valueFrom{File: "/etc/payload/body"}},
+	}, ct.valueFromRefs())
+
+	problems := ValidateExperiment([]byte(`
+spec:
+- task: http
+  with:
+    url:
+      valueFrom:
+        env: APP_URL
+    headers:
+      Authorization:
+        valueFrom:
+          env: TOKEN
+          file: /etc/token
+      X-Key:
+        valueFrom:
+          secretKeyRef:
+            name: creds
+      X-Other:
+        valueFrom:
+          configMapKeyRef: {}
+`))
+	assert.ElementsMatch(t, []ValidationError{
+		{Path: "spec[0].with.headers.Authorization.valueFrom", Message: "specify exactly one of env, file and secretKeyRef"},
+		{Path: "spec[0].with.headers.X-Key.valueFrom.secretKeyRef", Message: "name and key are required"},
+		{Path: "spec[0].with.headers.X-Other.valueFrom", Message: "invalid reference; expected one of env, file and secretKeyRef"},
+	}, problems)
+}
+
+func TestRunValueFrom(t *testing.T) {
+	setupMockMetricsServer(t)
+	_ = os.Chdir(t.TempDir())
+	*kd = *NewFakeKubeDriver(cli.New())
+	_, err := kd.dynamicClient.Resource(secretGVR).Namespace("default").Create(context.Background(), &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "creds", "namespace": "default"},
+			"data":       map[string]interface{}{"key": base64.StdEncoding.EncodeToString([]byte("k3y"))},
+		},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	t.Setenv("APP_TOKEN", "t0ken")
+	assert.NoError(t, os.WriteFile("user", []byte("alice\n"), 0600))
+
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	var mu sync.Mutex
+	received := map[string]int{}
+	mux.HandleFunc("/"+foo, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		received[r.Header.Get("Authorization")+" "+r.Header.Get("X-Key")+" "+string(body)]++
+		w.WriteHeader(200)
+	})
+
+	exp := &Experiment{}
+	err = yaml.Unmarshal([]byte(fmt.Sprintf(`
+metadata:
+  name: test
+  namespace: default
+spec:
+- task: http
+  with:
+    url: http://localhost:%d/%v
+    numRequests: 5
+    headers:
+      Authorization:
+        valueFrom:
+          env: APP_TOKEN
+      X-Key:
+        valueFrom:
+          secretKeyRef:
+            name: creds
+            key: key
+    payloadStr:
+      valueFrom:
+        file: user
+`, addr.Port, foo)), exp)
+	assert.NoError(t, err)
+
+	exp.initResults(1)
+	err = exp.run(context.Background(), &mockDriver{exp})
+	assert.NoError(t, err)
+	assert.Equal(t, TaskSucceeded, exp.TaskStatus(1))
+	assert.Equal(t, map[string]int{"t0ken k3y alice": 5}, received)
+
+	// the experiment keeps the references, not their values
+	b, err := json.Marshal(exp.Spec)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "t0ken")
+
+	// values are not executed as templates, and inputs that look like references are not resolved
+	t.Setenv("APP_TOKEN", `{{ .Outputs.login.token }}`)
+	exp.Spec[0].(*collectHTTPTask).With.Headers["X-Literal"] = `{{ valueFrom "env" "APP_TOKEN" }}`
+	rendered, err := exp.renderTask(exp.Spec[0])
+	assert.NoError(t, err)
+	assert.Equal(t, `{{ .Outputs.login.token }}`, rendered.(*collectHTTPTask).With.Headers["Authorization"])
+	assert.Equal(t, `{{ valueFrom "env" "APP_TOKEN" }}`, rendered.(*collectHTTPTask).With.Headers["X-Literal"])
+
+	// missing values fail the task
+	t.Setenv("APP_TOKEN", "")
+	_ = os.Unsetenv("APP_TOKEN")
+	_, err = exp.renderTask(exp.Spec[0])
+	assert.ErrorContains(t, err, "environment variable APP_TOKEN is not set")
+}
+
+func TestPutExperimentResultRedacted(t *testing.T) {
+	t.Setenv("LOGIN_PASSWORD", "pa55word")
+	exp := &Experiment{}
+	password, err := exp.resolveValueFrom(valueFrom{Env: "LOGIN_PASSWORD"})
+	assert.NoError(t, err)
+
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(200)
+	}))
+	t.Cleanup(ts.Close)
+
+	err = PutExperimentResultToMetricsService(ts.URL, "default", "test", &ExperimentResult{
+		Outputs:           map[string]map[string]interface{}{"login": {"stdout": "logged in with " + password}},
+		NumCompletedTasks: 1,
+	})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), password)
+	assert.Contains(t, string(body), "logged in with [redacted]")
+	assert.Contains(t, string(body), `"numCompletedTasks":1`)
+}
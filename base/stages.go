@@ -0,0 +1,323 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"fortio.org/fortio/fhttp"
+	"fortio.org/fortio/periodic"
+	fstats "fortio.org/fortio/stats"
+	log "github.com/iter8-tools/iter8/base/log"
+)
+
+const (
+	// rampStep is the longest step of constant QPS used to approximate a linear ramp
+	rampStep = time.Second
+)
+
+// stage is a stage of the load profile of an endpoint
+type stage struct {
+	// Name of this stage; optional. Default value is stage-<index>, where index starts at 0.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// QPS is the number of requests per second sent to the app at the end of this stage
+	QPS float32 `json:"qps" yaml:"qps"`
+	// Connections is the number of parallel connections used to send load in this stage. Default value is the connections of the endpoint.
+	Connections *int `json:"connections,omitempty" yaml:"connections,omitempty"`
+	// Duration of this stage. Specified in the Go duration string format (example, 30s).
+	Duration string `json:"duration" yaml:"duration"`
+	// Ramp is the initial part of this stage in which QPS changes from the QPS of the previous stage to the QPS of this stage.
+	// QPS changes every second, so that it follows a linear change, and connections are kept between changes (see stageSteps).
+	// The first stage ramps up from zero. Specified in the Go duration string format (example, 10s). Default value is no ramp.
+	Ramp *string `json:"ramp,omitempty" yaml:"ramp,omitempty"`
+}
+
+// HTTPStageResult is the raw data of the stages of the load profiles of endpoints
+// Key is the endpoint; the results of its stages are in order
+type HTTPStageResult map[string][]*fhttp.HTTPRunnerResults
+
+// stageName returns the name of the i-th stage
+func (s stage) stageName(i int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("stage-%d", i)
+}
+
+// validateStages validates the stages of an endpoint; prefix is the path of the endpoint
+func validateStages(prefix string, stages []stage) error {
+	errs := []error{}
+	for i, s := range stages {
+		field := fmt.Sprintf("%v.stages[%d]", prefix, i)
+		if s.QPS <= 0 {
+			errs = append(errs, newFieldError(field+".qps", "must be positive"))
+		}
+		if s.Connections != nil && *s.Connections <= 0 {
+			errs = append(errs, newFieldError(field+".connections", "must be positive"))
+		}
+		if s.Duration == "" {
+			errs = append(errs, newFieldError(field+".duration", "duration is required"))
+			continue
+		}
+		if err := validateDuration(field+".duration", &s.Duration); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := validateDuration(field+".ramp", s.Ramp); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if s.Ramp != nil && !isTemplate(*s.Ramp) && !isTemplate(s.Duration) {
+			ramp, _ := time.ParseDuration(*s.Ramp)
+			duration, _ := time.ParseDuration(s.Duration)
+			if ramp > duration {
+				errs = append(errs, newFieldError(field+".ramp", "ramp %v is longer than duration %v", *s.Ramp, s.Duration))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadStep is a part of a stage in which load is sent at a constant QPS
+type loadStep struct {
+	qps      float32
+	duration time.Duration
+}
+
+// stageSteps approximates a stage by steps of constant QPS; prevQPS is the QPS of the previous stage
+// A ramp is divided into steps of at most rampStep; the QPS of each step is that of the ramp at the middle of the step
+func stageSteps(s stage, prevQPS float32) ([]loadStep, error) {
+	duration, err := time.ParseDuration(s.Duration)
+	if err != nil {
+		return nil, err
+	}
+	ramp := time.Duration(0)
+	if s.Ramp != nil {
+		if ramp, err = time.ParseDuration(*s.Ramp); err != nil {
+			return nil, err
+		}
+	}
+
+	steps := []loadStep{}
+	if ramp > 0 {
+		n := int((ramp + rampStep - 1) / rampStep)
+		for k := 0; k < n; k++ {
+			fraction := (float32(k) + 0.5) / float32(n)
+			steps = append(steps, loadStep{
+				qps:      prevQPS + (s.QPS-prevQPS)*fraction,
+				duration: ramp / time.Duration(n),
+			})
+		}
+	}
+	if duration > ramp {
+		steps = append(steps, loadStep{qps: s.QPS, duration: duration - ramp})
+	}
+	return steps, nil
+}
+
+// connectionPool keeps the transports, and so the connections, of the fortio tests of a load profile
+// fortio creates the clients of a test in order, so the i-th client of each test uses the i-th transport of the pool
+type connectionPool struct {
+	mu         sync.Mutex
+	transports []http.RoundTripper
+	next       int
+}
+
+// attach makes the clients of a fortio test reuse the transports of the pool; it is called before each test
+// Transports are only used by the standard HTTP client
+func (p *connectionPool) attach(fo *fhttp.HTTPRunnerOptions) {
+	p.mu.Lock()
+	p.next = 0
+	p.mu.Unlock()
+
+	// the transports of the pool replace the transport of each client, and are wrapped by the other transports of the test
+	previous := fo.Transport
+	fo.DisableFastClient = true
+	fo.Transport = func(base http.RoundTripper) http.RoundTripper {
+		rt := p.transport(base)
+		if previous == nil {
+			return rt
+		}
+		return previous(rt)
+	}
+}
+
+// transport returns the transport of the next client, which is a copy of base if the pool has fewer transports than clients
+// fortio closes the idle connections of base when the test ends, so the pool keeps a copy
+func (p *connectionPool) transport(base http.RoundTripper) http.RoundTripper {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next == len(p.transports) {
+		rt := base
+		if t, ok := base.(*http.Transport); ok {
+			rt = t.Clone()
+		}
+		p.transports = append(p.transports, rt)
+	}
+	rt := p.transports[p.next]
+	p.next++
+	return rt
+}
+
+// close closes the idle connections of the pool
+func (p *connectionPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, rt := range p.transports {
+		if t, ok := rt.(interface{ CloseIdleConnections() }); ok {
+			t.CloseIdleConnections()
+		}
+	}
+}
+
+// runStages runs the load profile of an endpoint, which is aborted when ctx is done
+// Each step is a fortio test; the steps reuse connections, and so use the standard HTTP client of fortio
+// The results of each stage are returned, together with the results aggregated over all stages
+// If a step fails, the results of the steps run before it are returned with the error
+func runStages(ctx context.Context, e endpoint) (*HTTPEndpointResult, []*fhttp.HTTPRunnerResults, error) {
+	pool := &connectionPool{}
+	defer pool.close()
+
+	all := []*fhttp.HTTPRunnerResults{}
+	stages := []*fhttp.HTTPRunnerResults{}
+	failures := map[string]int64{}
+	prevQPS := float32(0)
+	var runErr error
+	for i, s := range e.Stages {
+		steps, err := stageSteps(s, prevQPS)
+		if err != nil {
+			log.Logger.WithStackTrace(err.Error()).Error("unable to parse stage")
+			runErr = err
+			break
+		}
+
+		stepResults := []*fhttp.HTTPRunnerResults{}
+		for _, step := range steps {
+			if ctx.Err() != nil {
+				break
+			}
+
+			// each step is a fortio test based on duration
+			se := e
+			se.NumRequests = nil
+			se.Duration = StringPointer(step.duration.String())
+			se.QPS = float32Pointer(step.qps)
+			if s.Connections != nil {
+				se.Connections = s.Connections
+			}
+			fo, err := getFortioOptions(ctx, se)
+			if err != nil {
+				runErr = err
+				break
+			}
+			fo.Labels = s.stageName(i)
+			pool.attach(fo)
+			// fortio starts each test with a warmup request per connection; the connections of later steps are already open,
+			// and errors of their warmup requests are expected when the load profile finds the limits of the app
+			if len(all) > 0 || len(stepResults) > 0 {
+				fo.AllowInitialErrors = true
+			}
+
+			log.Logger.Trace(fmt.Sprintf("run fortio HTTP test for %v at %v qps", s.stageName(i), step.qps))
+			r, stepFailures, err := runCheckedFortio(ctx, fo, e.ResponseChecks)
+			if err != nil {
+				log.Logger.WithStackTrace(err.Error()).Error(fmt.Sprintf("fortio failed for %v at %v qps", s.stageName(i), step.qps))
+				runErr = err
+				break
+			}
+			stepResults = append(stepResults, r)
+			for name, n := range stepFailures {
+				failures[name] += n
+			}
+		}
+		prevQPS = s.QPS
+
+		if len(stepResults) == 0 {
+			break
+		}
+		sr := mergeHTTPRunnerResults(stepResults, e.Percentiles)
+		sr.Labels = s.stageName(i)
+		sr.RequestedQPS = strconv.FormatFloat(float64(s.QPS), 'f', -1, 32)
+		stages = append(stages, sr)
+		all = append(all, stepResults...)
+		if runErr != nil {
+			break
+		}
+	}
+
+	if len(all) == 0 {
+		if runErr != nil {
+			return nil, nil, runErr
+		}
+		return nil, nil, errors.New("no stage was run")
+	}
+	aggregate := mergeHTTPRunnerResults(all, e.Percentiles)
+	aggregate.RequestedQPS = "staged"
+	return newHTTPEndpointResult(aggregate, failures), stages, runErr
+}
+
+// mergeHTTPRunnerResults combines the results of consecutive fortio tests of an endpoint
+func mergeHTTPRunnerResults(results []*fhttp.HTTPRunnerResults, percentiles []float64) *fhttp.HTTPRunnerResults {
+	merged := *results[0]
+	merged.RetCodes = map[int]int64{}
+	merged.ActualDuration = 0
+	merged.NumThreads = 0
+	durations := []*fstats.HistogramData{}
+	errorDurations := []*fstats.HistogramData{}
+	for _, r := range results {
+		for code, n := range r.RetCodes {
+			merged.RetCodes[code] += n
+		}
+		merged.ActualDuration += r.ActualDuration
+		if r.NumThreads > merged.NumThreads {
+			merged.NumThreads = r.NumThreads
+		}
+		durations = append(durations, r.DurationHistogram)
+		errorDurations = append(errorDurations, r.ErrorsDurationHistogram)
+	}
+	merged.DurationHistogram = mergeHistogramData(durations).CalcPercentiles(percentiles)
+	merged.ErrorsDurationHistogram = mergeHistogramData(errorDurations)
+	merged.RequestedDuration = merged.ActualDuration.String()
+	if merged.ActualDuration > 0 {
+		merged.ActualQPS = float64(merged.DurationHistogram.Count) / merged.ActualDuration.Seconds()
+	}
+	return &merged
+}
+
+// mergeHistogramData combines fortio histograms recorded with the default offset and resolution of fortio tests
+// The buckets are recorded again in a fortio histogram, since fortio adjusts the bounds of the first and last buckets of each histogram
+// to its min and max; the merged buckets, and so the percentiles calculated from them, are those of a single test with all the responses
+func mergeHistogramData(hs []*fstats.HistogramData) *fstats.HistogramData {
+	h := fstats.NewHistogram(0, periodic.DefaultRunnerOptions.Resolution)
+	count, minimum, maximum, sum, sumOfSquares := int64(0), 0.0, 0.0, 0.0, 0.0
+	for _, d := range hs {
+		if d == nil || d.Count == 0 {
+			continue
+		}
+		if count == 0 || d.Min < minimum {
+			minimum = d.Min
+		}
+		if count == 0 || d.Max > maximum {
+			maximum = d.Max
+		}
+		count += d.Count
+		sum += d.Sum
+		sumOfSquares += float64(d.Count) * (d.StdDev*d.StdDev + d.Avg*d.Avg)
+		for _, b := range d.Data {
+			// the middle of a bucket is within its bounds before they were adjusted
+			h.RecordN((b.Start+b.End)/2, int(b.Count))
+		}
+	}
+	if count == 0 {
+		return &fstats.HistogramData{}
+	}
+	h.Min, h.Max, h.Sum = minimum, maximum, sum
+	merged := h.Export()
+	merged.StdDev = math.Sqrt(math.Max(sumOfSquares/float64(count)-merged.Avg*merged.Avg, 0))
+	return merged
+}
@@ -0,0 +1,206 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fortio.org/fortio/fhttp"
+	fstats "fortio.org/fortio/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStageSteps(t *testing.T) {
+	// a ramp is divided into one step per second
+	steps, err := stageSteps(stage{QPS: 40, Duration: "5s", Ramp: StringPointer("2s")}, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, []loadStep{
+		{qps: 25, duration: time.Second},
+		{qps: 35, duration: time.Second},
+		{qps: 40, duration: 3 * time.Second},
+	}, steps)
+
+	// long ramps change QPS every second, and may last for the whole stage
+	steps, err = stageSteps(stage{QPS: 100, Duration: "1m", Ramp: StringPointer("1m")}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 60, len(steps))
+	assert.InDelta(t, 100.0/120, steps[0].qps, 1e-4)
+	assert.InDelta(t, 100-100.0/120, steps[59].qps, 1e-4)
+	assert.Equal(t, time.Second, steps[59].duration)
+
+	// ramps that are not a whole number of seconds are divided into equal steps
+	steps, err = stageSteps(stage{QPS: 30, Duration: "1500ms", Ramp: StringPointer("1500ms")}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []loadStep{
+		{qps: 7.5, duration: 750 * time.Millisecond},
+		{qps: 22.5, duration: 750 * time.Millisecond},
+	}, steps)
+
+	// without a ramp, the stage is a single step
+	steps, err = stageSteps(stage{QPS: 10, Duration: "1s"}, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []loadStep{{qps: 10, duration: time.Second}}, steps)
+}
+
+func TestValidateStages(t *testing.T) {
+	err := validateStages("with", []stage{
+		{QPS: 10, Duration: "10s", Ramp: StringPointer("5s")},
+		{QPS: 0, Duration: "1s", Connections: IntPointer(0)},
+		{QPS: 10},
+		{QPS: 10, Duration: "1s", Ramp: StringPointer("2s")},
+	})
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "stages[0]")
+	assert.Contains(t, err.Error(), "with.stages[1].qps: must be positive")
+	assert.Contains(t, err.Error(), "with.stages[1].connections: must be positive")
+	assert.Contains(t, err.Error(), "with.stages[2].duration: duration is required")
+	assert.Contains(t, err.Error(), "with.stages[3].ramp: ramp 2s is longer than duration 1s")
+}
+
+func TestMergeHistogramData(t *testing.T) {
+	h1 := fstats.NewHistogram(0, 0.001)
+	h2 := fstats.NewHistogram(0, 0.001)
+	all := fstats.NewHistogram(0, 0.001)
+	for i := 1; i <= 300; i++ {
+		// durations up to 90s, so that the edge buckets of h1 and h2 share buckets of the merged histogram
+		v := float64(i*i) / 1000
+		if i%3 == 0 {
+			h1.Record(v)
+		} else {
+			h2.Record(v)
+		}
+		all.Record(v)
+	}
+
+	merged := mergeHistogramData([]*fstats.HistogramData{h1.Export(), nil, h2.Export()})
+	expected := all.Export()
+	assert.Equal(t, expected.Count, merged.Count)
+	assert.Equal(t, expected.Min, merged.Min)
+	assert.Equal(t, expected.Max, merged.Max)
+	assert.InDelta(t, expected.Avg, merged.Avg, 1e-9)
+	assert.InDelta(t, expected.StdDev, merged.StdDev, 1e-9)
+	assert.Equal(t, expected.Data, merged.Data)
+	for _, p := range []float64{50, 90, 99} {
+		assert.InDelta(t, expected.CalcPercentile(p), merged.CalcPercentile(p), 1e-9)
+	}
+
+	assert.Equal(t, int64(0), mergeHistogramData([]*fstats.HistogramData{nil}).Count)
+}
+
+func TestRunCollectHTTPStages(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	var mu sync.Mutex
+	remoteAddrs := map[string]bool{}
+	mux.HandleFunc("/"+foo, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		remoteAddrs[r.RemoteAddr] = true
+		mu.Unlock()
+		w.WriteHeader(200)
+	})
+
+	url := fmt.Sprintf("http://localhost:%d/%v", addr.Port, foo)
+	ct := &collectHTTPTask{
+		TaskMeta: TaskMeta{
+			Task: StringPointer(CollectHTTPTaskName),
+		},
+		With: collectHTTPInputs{
+			endpoint: endpoint{
+				URL: url,
+				Stages: []stage{
+					{Name: "ramp-up", QPS: 20, Duration: "2s", Ramp: StringPointer("1s")},
+					{QPS: 40, Duration: "1s", Connections: IntPointer(2)},
+				},
+			},
+		},
+	}
+
+	exp := &Experiment{
+		Spec:   []Task{ct},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+	err := ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	stageResult, ok := exp.Result.Insights.StageData[CollectHTTPTaskName].(HTTPStageResult)
+	assert.True(t, ok)
+	stages := stageResult[url]
+	assert.Equal(t, 2, len(stages))
+	assert.Equal(t, "ramp-up", stages[0].Labels)
+	assert.Equal(t, "20", stages[0].RequestedQPS)
+	assert.Equal(t, "stage-1", stages[1].Labels)
+	assert.Equal(t, 2, stages[1].NumThreads)
+
+	// the results of the task are aggregated over all stages
+	httpResult, ok := exp.Result.Insights.TaskData[CollectHTTPTaskName].(HTTPResult)
+	assert.True(t, ok)
+	aggregate := httpResult[url]
+	assert.Equal(t, stages[0].DurationHistogram.Count+stages[1].DurationHistogram.Count, aggregate.DurationHistogram.Count)
+	assert.Equal(t, aggregate.DurationHistogram.Count, aggregate.RetCodes[200])
+	assert.Equal(t, len(defaultPercentiles), len(aggregate.DurationHistogram.Percentiles))
+	assert.Greater(t, aggregate.DurationHistogram.Count, int64(40))
+
+	// the steps of the load profile reuse the connections of the first step
+	assert.LessOrEqual(t, len(remoteAddrs), defaultHTTPConnections)
+}
+
+func TestRunCollectHTTPStagesDegraded(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	var count atomic.Int64
+	mux.HandleFunc("/"+foo, func(w http.ResponseWriter, r *http.Request) {
+		// the app fails once it has served a few requests
+		if count.Add(1) > 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(200)
+	})
+
+	url := fmt.Sprintf("http://localhost:%d/%v", addr.Port, foo)
+	ct := &collectHTTPTask{
+		TaskMeta: TaskMeta{
+			Task: StringPointer(CollectHTTPTaskName),
+		},
+		With: collectHTTPInputs{
+			endpoint: endpoint{
+				URL:         url,
+				Connections: IntPointer(1),
+				Stages: []stage{
+					{QPS: 4, Duration: "1s"},
+					{QPS: 8, Duration: "1s"},
+				},
+			},
+		},
+	}
+
+	exp := &Experiment{
+		Spec:   []Task{ct},
+		Result: &ExperimentResult{},
+	}
+	exp.initResults(1)
+	err := ct.Run(context.Background(), exp)
+	assert.NoError(t, err)
+
+	// the errors of later stages are measured rather than aborting the load profile
+	stages := exp.Result.Insights.StageData[CollectHTTPTaskName].(HTTPStageResult)[url]
+	assert.Equal(t, 2, len(stages))
+	assert.Equal(t, stages[1].DurationHistogram.Count, stages[1].RetCodes[http.StatusServiceUnavailable])
+	aggregate := exp.Result.Insights.TaskData[CollectHTTPTaskName].(HTTPResult)[url]
+	assert.Greater(t, aggregate.RetCodes[http.StatusServiceUnavailable], int64(0))
+
+	// stages run before a failure are kept
+	count.Store(0)
+	e := ct.With.endpoint
+	e.Stages = append(e.Stages, stage{QPS: 8, Duration: "forever"})
+	r, stages, err := runStages(context.Background(), e)
+	assert.ErrorContains(t, err, "forever")
+	assert.Equal(t, 2, len(stages))
+	assert.Equal(t, stages[0].DurationHistogram.Count+stages[1].DurationHistogram.Count, r.DurationHistogram.Count)
+}
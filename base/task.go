@@ -0,0 +1,337 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/expr-lang/expr"
+	log "github.com/iter8-tools/iter8/base/log"
+	helmtime "helm.sh/helm/v3/pkg/time"
+)
+
+const (
+	// OnFailureAbort indicates that remaining tasks are not run if a task fails
+	OnFailureAbort = "abort"
+	// OnFailureContinue indicates that remaining tasks are run even if a task fails
+	OnFailureContinue = "continue"
+
+	// TaskSucceeded is the status of a task that ran successfully
+	TaskSucceeded = "succeeded"
+	// TaskFailed is the status of a task that failed
+	TaskFailed = "failed"
+	// TaskSkipped is the status of a task whose condition was false
+	TaskSkipped = "skipped"
+	// TaskAborted is the status of a task that was interrupted because the experiment run was cancelled
+	TaskAborted = "aborted"
+
+	// defaultBackoff is the default duration between attempts of a task
+	defaultBackoff = "1s"
+)
+
+var (
+	// errDeadlineExceeded is returned when a task does not complete before the experiment deadline
+	errDeadlineExceeded = errors.New("experiment deadline exceeded")
+	// errAborted is returned when the experiment run is cancelled, for example, by a signal
+	errAborted = errors.New("experiment aborted")
+)
+
+// getDeadline returns the time at which the experiment deadline expires, if any, for a run that starts at start
+func (exp *Experiment) getDeadline(start time.Time) (*time.Time, error) {
+	if exp.Deadline == nil {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(*exp.Deadline)
+	if err != nil {
+		e := errors.New("invalid format for experiment deadline")
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	deadline := start.Add(d)
+	return &deadline, nil
+}
+
+// cancelled returns true if ctx is done for any reason other than the experiment deadline
+func cancelled(ctx context.Context) bool {
+	return ctx.Err() != nil && !errors.Is(context.Cause(ctx), errDeadlineExceeded)
+}
+
+// abortOnFailure returns true if the experiment should not run remaining tasks when this task fails
+func abortOnFailure(t Task) bool {
+	onFailure := getTaskMeta(t).OnFailure
+	return onFailure != nil && *onFailure == OnFailureAbort
+}
+
+// executionPolicy is the parsed form of the timeout, retries and backoff of a task
+type executionPolicy struct {
+	// timeout of a single attempt; zero means no timeout
+	timeout time.Duration
+	// retries is the number of attempts after the first one
+	retries int
+	// backoff is the duration between attempts
+	backoff time.Duration
+}
+
+// getExecutionPolicy parses the execution policy of a task
+func getExecutionPolicy(tm TaskMeta) (*executionPolicy, error) {
+	p := &executionPolicy{}
+
+	if tm.Timeout != nil {
+		d, err := time.ParseDuration(*tm.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid task timeout: %v", *tm.Timeout)
+		}
+		p.timeout = d
+	}
+
+	if tm.Retries != nil {
+		if *tm.Retries < 0 {
+			return nil, fmt.Errorf("invalid task retries: %v", *tm.Retries)
+		}
+		p.retries = *tm.Retries
+	}
+
+	backoff := defaultBackoff
+	if tm.Backoff != nil {
+		backoff = *tm.Backoff
+	}
+	d, err := time.ParseDuration(backoff)
+	if err != nil || d < 0 {
+		return nil, fmt.Errorf("invalid task backoff: %v", backoff)
+	}
+	p.backoff = d
+
+	if tm.OnFailure != nil && *tm.OnFailure != OnFailureAbort && *tm.OnFailure != OnFailureContinue {
+		return nil, fmt.Errorf("invalid task onFailure: %v; must be %v or %v", *tm.OnFailure, OnFailureAbort, OnFailureContinue)
+	}
+
+	return p, nil
+}
+
+// executeTask runs a task, honoring its timeout, retries and backoff
+// The task is stopped when ctx is done, for example, when the experiment deadline expires
+func executeTask(ctx context.Context, t Task, exp *Experiment) error {
+	p, err := getExecutionPolicy(getTaskMeta(t))
+	if err != nil {
+		log.Logger.Error(err)
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = runAttempt(ctx, t, exp, p.timeout)
+		if err == nil {
+			return nil
+		}
+		if attempt >= p.retries || ctx.Err() != nil {
+			return err
+		}
+
+		log.Logger.WithStackTrace(err.Error()).Warnf("task attempt %v failed; retrying in %v", attempt+1, p.backoff)
+		select {
+		case <-time.After(p.backoff):
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// runAttempt runs a single attempt of a task
+// The attempt fails if it does not complete within the timeout or before ctx is done
+// The task runs in the calling goroutine and stops when its context is done, so an attempt never
+// overlaps a retry or a later task
+func runAttempt(ctx context.Context, t Task, exp *Experiment, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("task timed out after %v", timeout))
+		defer cancel()
+	}
+
+	err := t.Run(ctx, exp)
+	if err != nil && ctx.Err() != nil {
+		// report why the task was stopped rather than how it stopped
+		err = context.Cause(ctx)
+		log.Logger.Error(err)
+	}
+	return err
+}
+
+// runSpec runs the tasks in the experiment spec, starting from the first task that did not complete
+func (exp *Experiment) runSpec(ctx context.Context, driver Driver) error {
+	log.Logger.Debugf("attempting to execute %v tasks", len(exp.Spec))
+	for i, t := range exp.Spec {
+		// task was completed in a previous run of this experiment
+		if i < exp.Result.NumCompletedTasks {
+			log.Logger.Debug("task " + fmt.Sprintf("%v: %v", i+1, *getName(t)) + ": previously completed")
+			continue
+		}
+
+		// experiment run was cancelled
+		if cancelled(ctx) {
+			log.Logger.Error("task " + fmt.Sprintf("%v: %v", i+1, *getName(t)) + ": " + "experiment aborted")
+			exp.abortExperiment()
+			return driver.Write(exp)
+		}
+
+		// experiment deadline has expired
+		if ctx.Err() != nil {
+			log.Logger.Error("task " + fmt.Sprintf("%v: %v", i+1, *getName(t)) + ": " + "experiment deadline exceeded")
+			exp.failExperiment()
+			exp.haltExperiment()
+			return driver.Write(exp)
+		}
+
+		abort, err := exp.runTask(ctx, driver, "task", i, t, false)
+		if err != nil || abort {
+			return err
+		}
+
+		exp.incrementNumCompletedTasks()
+
+		err = driver.Write(exp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runFinally runs the finally tasks of the experiment
+// They are run even if the experiment run was cancelled, and the experiment deadline does not apply to them
+func (exp *Experiment) runFinally(ctx context.Context, driver Driver) error {
+	if len(exp.Finally) == 0 {
+		return nil
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	log.Logger.Debugf("attempting to execute %v finally tasks", len(exp.Finally))
+	for i, t := range exp.Finally {
+		abort, err := exp.runTask(ctx, driver, "finally task", i, t, true)
+		if err != nil || abort {
+			return err
+		}
+
+		err = driver.Write(exp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runTask runs a single task, unless its condition is false, and records its status
+// abort is true if the task failed and remaining tasks should not be run
+func (exp *Experiment) runTask(ctx context.Context, driver Driver, prefix string, i int, t Task, finally bool) (abort bool, err error) {
+	label := prefix + " " + fmt.Sprintf("%v: %v", i+1, *getName(t))
+	log.Logger.Info(label + ": started")
+	start := time.Now()
+
+	shouldRun := true
+	// if task has a condition
+	if cond := getIf(t); cond != nil {
+		// condition evaluates to false ... then shouldRun is false
+		program, err := expr.Compile(*cond, expr.Env(exp), expr.AsBool())
+		if err != nil {
+			log.Logger.WithStackTrace(err.Error()).Error("unable to compile if clause")
+			return false, err
+		}
+
+		output, err := expr.Run(program, exp)
+		if err != nil {
+			log.Logger.WithStackTrace(err.Error()).Error("unable to run if clause")
+			return false, err
+		}
+
+		shouldRun = output.(bool)
+	}
+	if !shouldRun {
+		log.Logger.WithStackTrace(fmt.Sprint("false condition: ", *getIf(t))).Info(label + ": " + "skipped")
+		exp.setTaskResult(i, t, finally, TaskSkipped, start, nil)
+		return false, nil
+	}
+
+	exp.taskKey = fmt.Sprint(i + 1)
+	if finally {
+		exp.taskKey = fmt.Sprintf("finally-%d", i+1)
+	}
+
+	// inputs may reference the outputs of earlier tasks
+	rendered, err := exp.renderTask(t)
+	if err == nil {
+		err = executeTask(ctx, rendered, exp)
+		// the results of the task are recorded from the task that ran
+		t = rendered
+	}
+	if err != nil && cancelled(ctx) {
+		// the experiment run was cancelled while this task was running
+		log.Logger.Error(label + ": " + "aborted")
+		exp.abortExperiment()
+		exp.setTaskResult(i, t, finally, TaskAborted, start, err)
+		return true, driver.Write(exp)
+	}
+	if err != nil {
+		log.Logger.Error(label + ": " + "failure")
+		exp.failExperiment()
+		exp.setTaskResult(i, t, finally, TaskFailed, start, err)
+		abort := abortOnFailure(t)
+		if abort {
+			exp.haltExperiment()
+		}
+
+		err = driver.Write(exp)
+		if err != nil {
+			return false, err
+		}
+
+		if abort {
+			log.Logger.Error(label + ": " + "aborting experiment")
+			return true, nil
+		}
+	} else {
+		exp.setTaskResult(i, t, finally, TaskSucceeded, start, nil)
+	}
+	log.Logger.Info(label + ": " + "completed")
+	return false, nil
+}
+
+// setTaskResult records the execution of a task, replacing any record from a previous run
+func (exp *Experiment) setTaskResult(i int, t Task, finally bool, status string, start time.Time, err error) {
+	end := time.Now()
+	tr := TaskResult{
+		Name:      *getName(t),
+		Index:     i + 1,
+		Finally:   finally,
+		Status:    status,
+		StartTime: helmtime.Time{Time: start},
+		EndTime:   helmtime.Time{Time: end},
+		Duration:  end.Sub(start).String(),
+	}
+	if err != nil {
+		tr.Error = err.Error()
+	}
+	if c, ok := t.(interface{ commandResult() *CommandResult }); ok {
+		tr.Command = c.commandResult()
+	}
+	for j := range exp.Result.TaskResults {
+		if exp.Result.TaskResults[j].Index == tr.Index && exp.Result.TaskResults[j].Finally == tr.Finally {
+			exp.Result.TaskResults[j] = tr
+			return
+		}
+	}
+	exp.Result.TaskResults = append(exp.Result.TaskResults, tr)
+}
+
+// TaskStatus returns the status of the task with the given (1-based) index in the experiment spec
+// It returns an empty string if the task has not run
+// It is intended to be used in task conditions (example, `if: TaskStatus(2) == "failed"`)
+func (exp *Experiment) TaskStatus(index int) string {
+	if exp.Result == nil {
+		return ""
+	}
+	for _, tr := range exp.Result.TaskResults {
+		if tr.Index == index && !tr.Finally {
+			return tr.Status
+		}
+	}
+	return ""
+}
@@ -0,0 +1,337 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupMockMetricsServer configures a mock metrics server so that experiments can be written with mockDriver
+func setupMockMetricsServer(t *testing.T) {
+	metricsServerURL := "http://iter8.default:8080"
+	err := os.Setenv(MetricsServerURL, metricsServerURL)
+	assert.NoError(t, err)
+
+	StartHTTPMock(t)
+	MockMetricsServer(MockMetricsServerInput{
+		MetricsServerURL: metricsServerURL,
+	})
+}
+
+func TestGetExecutionPolicy(t *testing.T) {
+	p, err := getExecutionPolicy(TaskMeta{})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), p.timeout)
+	assert.Equal(t, 0, p.retries)
+	assert.Equal(t, time.Second, p.backoff)
+
+	p, err = getExecutionPolicy(TaskMeta{
+		Timeout:   StringPointer("5m"),
+		Retries:   IntPointer(3),
+		Backoff:   StringPointer("10s"),
+		OnFailure: StringPointer(OnFailureAbort),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, p.timeout)
+	assert.Equal(t, 3, p.retries)
+	assert.Equal(t, 10*time.Second, p.backoff)
+
+	for _, tm := range []TaskMeta{
+		{Timeout: StringPointer("hello")},
+		{Timeout: StringPointer("-1s")},
+		{Retries: IntPointer(-1)},
+		{Backoff: StringPointer("world")},
+		{OnFailure: StringPointer("retry")},
+	} {
+		_, err = getExecutionPolicy(tm)
+		assert.Error(t, err)
+	}
+}
+
+func TestTaskRetries(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	// fails on the first attempt and succeeds on the second
+	rt := &runTask{
+		TaskMeta: TaskMeta{
+			Run:     StringPointer("test -f attempted || (touch attempted; exit 1)"),
+			Retries: IntPointer(1),
+			Backoff: StringPointer("0s"),
+		},
+	}
+	exp := &Experiment{Spec: []Task{rt}}
+	exp.initResults(1)
+	assert.NoError(t, executeTask(context.Background(), rt, exp))
+
+	// no retries
+	_ = os.Remove("attempted")
+	rt.Retries = nil
+	assert.Error(t, executeTask(context.Background(), rt, exp))
+}
+
+func TestTaskTimeout(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	rt := &runTask{
+		TaskMeta: TaskMeta{
+			Run:     StringPointer("sleep 5"),
+			Timeout: StringPointer("100ms"),
+		},
+	}
+	exp := &Experiment{Spec: []Task{rt}}
+	exp.initResults(1)
+
+	start := time.Now()
+	err := executeTask(context.Background(), rt, exp)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestTimedOutAttemptsAreStopped(t *testing.T) {
+	_ = os.Chdir(t.TempDir())
+	// each attempt times out; a stopped attempt never writes "end"
+	rt := &runTask{
+		TaskMeta: TaskMeta{
+			Run:     StringPointer("echo start >> attempts; sleep 1; echo end >> attempts"),
+			Timeout: StringPointer("100ms"),
+			Retries: IntPointer(1),
+			Backoff: StringPointer("0s"),
+		},
+	}
+	exp := &Experiment{Spec: []Task{rt}}
+	exp.initResults(1)
+	assert.ErrorContains(t, executeTask(context.Background(), rt, exp), "task timed out after 100ms")
+
+	// attempts do not overlap, and nothing keeps running after the task returns
+	time.Sleep(1500 * time.Millisecond)
+	b, err := os.ReadFile("attempts")
+	assert.NoError(t, err)
+	assert.Equal(t, "start\nstart\n", string(b))
+}
+
+func TestOnFailure(t *testing.T) {
+	setupMockMetricsServer(t)
+
+	for _, onFailure := range []string{OnFailureAbort, OnFailureContinue} {
+		_ = os.Chdir(t.TempDir())
+		exp := &Experiment{
+			Spec: []Task{
+				&runTask{TaskMeta: TaskMeta{Run: StringPointer("exit 1"), OnFailure: StringPointer(onFailure)}},
+				&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch second")}},
+			},
+		}
+		exp.initResults(1)
+		err := exp.run(context.Background(), &mockDriver{exp})
+		assert.NoError(t, err)
+		assert.False(t, exp.NoFailure())
+
+		if onFailure == OnFailureAbort {
+			assert.Equal(t, 0, exp.Result.NumCompletedTasks)
+			assert.NoFileExists(t, "second")
+		} else {
+			assert.Equal(t, 2, exp.Result.NumCompletedTasks)
+			assert.FileExists(t, "second")
+		}
+	}
+}
+
+func TestExperimentDeadline(t *testing.T) {
+	setupMockMetricsServer(t)
+	_ = os.Chdir(t.TempDir())
+
+	exp := &Experiment{
+		Deadline: StringPointer("200ms"),
+		Spec: []Task{
+			&runTask{TaskMeta: TaskMeta{Run: StringPointer("sleep 5")}},
+			&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch second")}},
+		},
+	}
+	exp.initResults(1)
+
+	start := time.Now()
+	err := exp.run(context.Background(), &mockDriver{exp})
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.False(t, exp.NoFailure())
+	assert.False(t, exp.Completed())
+	assert.NoFileExists(t, "second")
+
+	// the deadline is measured from the start of each run, even if the experiment started earlier
+	exp = &Experiment{
+		Deadline: StringPointer("10s"),
+		Spec:     []Task{&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch resumed")}}},
+	}
+	exp.initResults(1)
+	exp.Result.StartTime.Time = time.Now().Add(-time.Hour)
+	assert.NoError(t, exp.run(context.Background(), &mockDriver{exp}))
+	assert.True(t, exp.NoFailure())
+	assert.FileExists(t, "resumed")
+
+	// invalid deadline
+	exp.Deadline = StringPointer("hello")
+	assert.Error(t, exp.run(context.Background(), &mockDriver{exp}))
+}
+
+func TestFinally(t *testing.T) {
+	setupMockMetricsServer(t)
+
+	tests := []struct {
+		name     string
+		deadline *string
+		spec     ExperimentSpec
+	}{
+		{
+			name: "aborted",
+			spec: ExperimentSpec{
+				&runTask{TaskMeta: TaskMeta{Run: StringPointer("exit 1"), OnFailure: StringPointer(OnFailureAbort)}},
+				&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch second")}},
+			},
+		},
+		{
+			name:     "deadline expired",
+			deadline: StringPointer("100ms"),
+			spec: ExperimentSpec{
+				&runTask{TaskMeta: TaskMeta{Run: StringPointer("sleep 5")}},
+				&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch second")}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		_ = os.Chdir(t.TempDir())
+		exp := &Experiment{
+			Deadline: test.deadline,
+			Spec:     test.spec,
+			Finally: ExperimentSpec{
+				&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch cleanup")}},
+				&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch failure"), If: StringPointer("Result.Failure")}},
+				&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch firstFailed"), If: StringPointer(`TaskStatus(1) == "failed"`)}},
+				&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch success"), If: StringPointer("not Result.Failure")}},
+			},
+		}
+		exp.initResults(1)
+		err := exp.run(context.Background(), &mockDriver{exp})
+		assert.NoError(t, err, test.name)
+
+		assert.NoFileExists(t, "second", test.name)
+		assert.FileExists(t, "cleanup", test.name)
+		assert.FileExists(t, "failure", test.name)
+		assert.FileExists(t, "firstFailed", test.name)
+		assert.NoFileExists(t, "success", test.name)
+
+		// compare status only; timing is checked in TestTaskResultRecord
+		statuses := []TaskResult{}
+		for _, tr := range exp.Result.TaskResults {
+			statuses = append(statuses, TaskResult{Name: tr.Name, Index: tr.Index, Finally: tr.Finally, Status: tr.Status})
+		}
+		assert.Equal(t, []TaskResult{
+			{Name: RunTaskName, Index: 1, Status: TaskFailed},
+			{Name: RunTaskName, Index: 1, Finally: true, Status: TaskSucceeded},
+			{Name: RunTaskName, Index: 2, Finally: true, Status: TaskSucceeded},
+			{Name: RunTaskName, Index: 3, Finally: true, Status: TaskSucceeded},
+			{Name: RunTaskName, Index: 4, Finally: true, Status: TaskSkipped},
+		}, statuses, test.name)
+		assert.Equal(t, TaskFailed, exp.TaskStatus(1))
+		assert.Equal(t, "", exp.TaskStatus(2))
+		// the run was stopped on purpose, so it is not resumed
+		assert.True(t, exp.Result.Halted, test.name)
+	}
+}
+
+func TestTaskResultRecord(t *testing.T) {
+	setupMockMetricsServer(t)
+	_ = os.Chdir(t.TempDir())
+
+	exp := &Experiment{
+		Spec: ExperimentSpec{
+			&runTask{TaskMeta: TaskMeta{Run: StringPointer("sleep 0.2")}},
+			&runTask{TaskMeta: TaskMeta{Run: StringPointer("exit 1")}},
+			&runTask{TaskMeta: TaskMeta{Run: StringPointer("echo hello"), If: StringPointer("false")}},
+		},
+	}
+	exp.initResults(1)
+	err := exp.run(context.Background(), &mockDriver{exp})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, len(exp.Result.TaskResults))
+
+	succeeded := exp.Result.TaskResults[0]
+	assert.Equal(t, TaskSucceeded, succeeded.Status)
+	assert.Empty(t, succeeded.Error)
+	assert.False(t, succeeded.EndTime.Before(succeeded.StartTime))
+	d, err := time.ParseDuration(succeeded.Duration)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, d, 200*time.Millisecond)
+
+	failed := exp.Result.TaskResults[1]
+	assert.Equal(t, TaskFailed, failed.Status)
+	assert.NotEmpty(t, failed.Error)
+	assert.False(t, failed.StartTime.Before(succeeded.EndTime))
+
+	skipped := exp.Result.TaskResults[2]
+	assert.Equal(t, TaskSkipped, skipped.Status)
+	assert.Empty(t, skipped.Error)
+	assert.NotEmpty(t, skipped.Duration)
+}
+
+func TestCancelExperiment(t *testing.T) {
+	metricsServerURL := "http://iter8.default:8080"
+	err := os.Setenv(MetricsServerURL, metricsServerURL)
+	assert.NoError(t, err)
+
+	// record the last result written
+	StartHTTPMock(t)
+	written := ExperimentResult{}
+	MockMetricsServer(MockMetricsServerInput{
+		MetricsServerURL: metricsServerURL,
+		ExperimentResultCallback: func(req *http.Request) {
+			body, err := io.ReadAll(req.Body)
+			assert.NoError(t, err)
+			assert.NoError(t, json.Unmarshal(body, &written))
+		},
+	})
+	_ = os.Chdir(t.TempDir())
+
+	exp := &Experiment{
+		Spec: ExperimentSpec{
+			&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch first")}},
+			&runTask{TaskMeta: TaskMeta{Run: StringPointer("sleep 5"), Retries: IntPointer(3)}},
+			&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch third")}},
+		},
+		Finally: ExperimentSpec{
+			&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch cleanup")}},
+			&runTask{TaskMeta: TaskMeta{Run: StringPointer("touch failure"), If: StringPointer("Result.Failure")}},
+		},
+	}
+	exp.initResults(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(300*time.Millisecond, cancel)
+
+	start := time.Now()
+	err = exp.run(ctx, &mockDriver{exp})
+	assert.ErrorIs(t, err, errAborted)
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	assert.True(t, exp.Result.Aborted)
+	assert.False(t, exp.Result.Halted)
+	assert.True(t, exp.NoFailure())
+	assert.Equal(t, 1, exp.Result.NumCompletedTasks)
+	assert.Equal(t, TaskSucceeded, exp.TaskStatus(1))
+	assert.Equal(t, TaskAborted, exp.TaskStatus(2))
+	assert.Equal(t, "", exp.TaskStatus(3))
+	assert.FileExists(t, "first")
+	assert.NoFileExists(t, "third")
+
+	// finally tasks run after the experiment is aborted
+	assert.FileExists(t, "cleanup")
+	assert.NoFileExists(t, "failure")
+
+	// the partial result is written
+	assert.True(t, written.Aborted)
+	assert.Equal(t, 4, len(written.TaskResults))
+}
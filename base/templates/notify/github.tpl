@@ -0,0 +1,5 @@
+{{- $s := .Summary -}}
+{
+  "event_type": "iter8",
+  "client_payload": {{ dict "experiment" $s.Experiment "timeStamp" $s.TimeStamp "completed" $s.Completed "noTaskFailures" $s.NoTaskFailures "numTasks" $s.NumTasks "numCompletedTasks" $s.NumCompletedTasks "slosPassed" $s.SLOsPassed "slos" $s.SLOs "endpoints" $s.Endpoints "failureReasons" $s.FailureReasons | toPrettyJson }}
+}
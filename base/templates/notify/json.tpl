@@ -0,0 +1 @@
+{{ .Summary | toPrettyJson }}
@@ -0,0 +1,17 @@
+{{- $s := .Summary -}}
+{{- $name := printf "%v/%v" $s.Experiment.Metadata.Namespace $s.Experiment.Metadata.Name -}}
+{{- $lines := list (printf "Completed %v of %v tasks" $s.NumCompletedTasks $s.NumTasks) -}}
+{{- range $s.FailureReasons -}}
+{{- $lines = append $lines (printf "- %v" .) -}}
+{{- end -}}
+{{- range $s.Endpoints -}}
+{{- $lines = append $lines (printf "- %v endpoint %v: %v requests, error rate %.3f, mean latency %.1f ms" .Task .Endpoint .RequestCount .ErrorRate .LatencyMean) -}}
+{{- end -}}
+{
+  "@type": "MessageCard",
+  "@context": "http://schema.org/extensions",
+  "themeColor": "{{ if $s.FailureReasons }}A30200{{ else }}2EB886{{ end }}",
+  "summary": {{ printf "Iter8 experiment %v" $name | toJson }},
+  "title": {{ printf "Iter8 experiment %v %v" $name (ternary "failed" "has no failures" (not (empty $s.FailureReasons))) | toJson }},
+  "text": {{ join "\n\n" $lines | toJson }}
+}
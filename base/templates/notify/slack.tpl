@@ -0,0 +1,22 @@
+{{- $s := .Summary -}}
+{{- $name := printf "%v/%v" $s.Experiment.Metadata.Namespace $s.Experiment.Metadata.Name -}}
+{{- $lines := list -}}
+{{- if $s.FailureReasons -}}
+{{- $lines = append $lines (printf ":x: Iter8 experiment *%v* failed" $name) -}}
+{{- range $s.FailureReasons -}}
+{{- $lines = append $lines (printf "• %v" .) -}}
+{{- end -}}
+{{- else -}}
+{{- $lines = append $lines (printf ":white_check_mark: Iter8 experiment *%v* has no failures" $name) -}}
+{{- end -}}
+{{- $lines = append $lines (printf "Completed %v of %v tasks" $s.NumCompletedTasks $s.NumTasks) -}}
+{{- range $s.Endpoints -}}
+{{- $line := printf "• %v endpoint %v" .Task .Endpoint -}}
+{{- if .Version }}{{ $line = printf "%v %v" $line .Version }}{{ end -}}
+{{- $line = printf "%v: %v requests, error rate %.3f, mean latency %.1f ms" $line .RequestCount .ErrorRate .LatencyMean -}}
+{{- with index .LatencyPercentiles "99" }}{{ $line = printf "%v, p99 latency %.1f ms" $line . }}{{ end -}}
+{{- $lines = append $lines $line -}}
+{{- end -}}
+{
+  "text": {{ join "\n" $lines | toJson }}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -51,6 +52,14 @@ func (m *mockDriver) Write(exp *Experiment) error {
 	return nil
 }
 
+// ReadResult reads the experiment result
+func (m *mockDriver) ReadResult(_ *Experiment) (*ExperimentResult, error) {
+	if m.Experiment == nil {
+		return nil, nil
+	}
+	return m.Experiment.Result, nil
+}
+
 // GetRevision gets experiment revision
 func (m *mockDriver) GetRevision() int {
 	return 0
@@ -79,10 +88,10 @@ func CreateExperimentYaml(t *testing.T, template string, url string, output stri
 }
 
 // GetTrackingHandler creates a handler for fhttp.DynamicHTTPServer that sets a variable to true
-// This can be used to verify that the handler was called.
-func GetTrackingHandler(breadcrumb *bool) func(w http.ResponseWriter, r *http.Request) {
+// This can be used to verify that the handler was called. The variable is atomic since the handler may be called concurrently.
+func GetTrackingHandler(breadcrumb *atomic.Bool) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		*breadcrumb = true
+		breadcrumb.Store(true)
 		time.Sleep(100 * time.Millisecond)
 		w.WriteHeader(200)
 	}
@@ -106,6 +115,8 @@ type MockMetricsServerInput struct {
 
 	// PUT /testResult
 	ExperimentResultCallback MetricsServerCallback
+	// GET /testResult returns this result; if nil, a not found response is returned
+	PreviousExperimentResult *ExperimentResult
 	// GET /grpcDashboard
 	GRPCDashboardCallback MetricsServerCallback
 	// GET /httpDashboard
@@ -127,6 +138,18 @@ func MockMetricsServer(input MockMetricsServerInput) {
 		},
 	)
 
+	// GET /testResult
+	httpmock.RegisterResponder(
+		http.MethodGet,
+		input.MetricsServerURL+TestResultPath,
+		func(req *http.Request) (*http.Response, error) {
+			if input.PreviousExperimentResult == nil {
+				return httpmock.NewStringResponse(http.StatusNotFound, "not found"), nil
+			}
+			return httpmock.NewJsonResponse(200, input.PreviousExperimentResult)
+		},
+	)
+
 	// GET /httpDashboard
 	httpmock.RegisterResponder(
 		http.MethodGet,
@@ -44,6 +44,11 @@ func float32Pointer(f float32) *float32 {
 	return &f
 }
 
+// float64Pointer takes an float64 as input, creates a new variable with the input value, and returns a pointer to the variable
+func float64Pointer(f float64) *float64 {
+	return &f
+}
+
 // StringPointer takes string as input, creates a new variable with the input value, and returns a pointer to the variable
 func StringPointer(s string) *string {
 	return &s
@@ -54,6 +59,14 @@ func BoolPointer(b bool) *bool {
 	return &b
 }
 
+// stringValue returns the string pointed to by s, or the empty string if s is nil
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
 // CompletePath is a helper function for converting file paths, specified relative to the caller of this function, into absolute ones.
 // CompletePath is useful in tests and enables deriving the absolute path of experiment YAML files.
 func CompletePath(prefix string, suffix string) string {
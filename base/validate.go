@@ -0,0 +1,464 @@
+package base
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template/parse"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"sigs.k8s.io/yaml"
+)
+
+// ValidationError is a problem found in an experiment by ValidateExperiment
+type ValidationError struct {
+	// Path of the field with the problem (example, spec[1].with.url)
+	Path string `json:"path" yaml:"path"`
+	// Message describes the problem
+	Message string `json:"message" yaml:"message"`
+}
+
+// Error returns the path and message of the problem
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// fieldError is a problem with a field of a task
+// Tasks return fieldErrors from ValidateInputs so that problems can be reported with their path
+type fieldError struct {
+	// field is the path of the field relative to the task (example, with.url)
+	field string
+	// msg describes the problem
+	msg string
+}
+
+// Error returns the field and message of the problem
+func (e *fieldError) Error() string {
+	return e.field + ": " + e.msg
+}
+
+// newFieldError creates a fieldError with a formatted message
+func newFieldError(field string, format string, a ...interface{}) error {
+	return &fieldError{field: field, msg: fmt.Sprintf(format, a...)}
+}
+
+// validateDuration checks that the field, if present, is a positive duration in the Go duration string format
+// Templates are executed when the task runs, so they are not checked
+func validateDuration(field string, d *string) error {
+	if d == nil || isTemplate(*d) {
+		return nil
+	}
+	v, err := time.ParseDuration(*d)
+	if err != nil {
+		return newFieldError(field, "invalid duration %q", *d)
+	}
+	if v <= 0 {
+		return newFieldError(field, "duration %q must be positive", *d)
+	}
+	return nil
+}
+
+// validateURL checks that the field is an absolute http or https URL
+// Templates are executed when the task runs, so they are not checked
+func validateURL(field string, u string) error {
+	if u == "" {
+		return newFieldError(field, "URL is required")
+	}
+	if isTemplate(u) {
+		return nil
+	}
+	p, err := url.Parse(u)
+	if err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+		return newFieldError(field, "invalid URL %q; expected an absolute http or https URL", u)
+	}
+	return nil
+}
+
+// validateTaskMeta checks the fields common to all tasks
+func validateTaskMeta(tm TaskMeta) error {
+	errs := []error{}
+	if tm.ID != nil && !taskIDRegex.MatchString(*tm.ID) {
+		errs = append(errs, newFieldError("id", "invalid ID %q; must start with a letter and contain only letters, digits and underscores", *tm.ID))
+	}
+	if tm.If != nil {
+		if _, err := expr.Compile(*tm.If, expr.Env(&Experiment{}), expr.AsBool()); err != nil {
+			errs = append(errs, newFieldError("if", "invalid condition: %v", err))
+		}
+	}
+	errs = append(errs, validateDuration("timeout", tm.Timeout))
+	if tm.Retries != nil && *tm.Retries < 0 {
+		errs = append(errs, newFieldError("retries", "must not be negative"))
+	}
+	if tm.Backoff != nil {
+		if d, err := time.ParseDuration(*tm.Backoff); err != nil || d < 0 {
+			errs = append(errs, newFieldError("backoff", "invalid duration %q", *tm.Backoff))
+		}
+	}
+	if tm.OnFailure != nil && *tm.OnFailure != OnFailureAbort && *tm.OnFailure != OnFailureContinue {
+		errs = append(errs, newFieldError("onFailure", "invalid value %q; must be %v or %v", *tm.OnFailure, OnFailureAbort, OnFailureContinue))
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateExperiment checks an experiment, specified in YAML or JSON, without running it
+// Every problem found is returned; the experiment is valid if none are found
+func ValidateExperiment(b []byte) []ValidationError {
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return []ValidationError{{Message: fmt.Sprintf("invalid YAML: %v", err)}}
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(j, &raw); err != nil || raw == nil {
+		return []ValidationError{{Message: "experiment must be a YAML object"}}
+	}
+
+	problems := unknownFieldErrors("", j, reflect.TypeOf(experimentFields{}))
+
+	if b, ok := raw["deadline"]; ok {
+		var deadline *string
+		if err := json.Unmarshal(b, &deadline); err != nil {
+			problems = append(problems, decodeError("deadline", err))
+		} else {
+			problems = append(problems, toValidationErrors("", validateDuration("deadline", deadline))...)
+		}
+	}
+	// task IDs are shared by spec and finally tasks
+	ids := map[string]string{}
+	for _, field := range []string{"spec", "finally"} {
+		b, ok := raw[field]
+		if !ok {
+			continue
+		}
+		var tasks []json.RawMessage
+		if err := json.Unmarshal(b, &tasks); err != nil {
+			problems = append(problems, ValidationError{Path: field, Message: "must be a list of tasks"})
+			continue
+		}
+		for i, t := range tasks {
+			path := fmt.Sprintf("%v[%d]", field, i)
+			problems = append(problems, validateTask(path, t, ids)...)
+
+			var tm TaskMeta
+			if err := json.Unmarshal(t, &tm); err != nil || tm.ID == nil {
+				continue
+			}
+			if first, ok := ids[*tm.ID]; ok {
+				problems = append(problems, ValidationError{Path: path + ".id", Message: fmt.Sprintf("duplicate ID %q; also used by %v", *tm.ID, first)})
+				continue
+			}
+			ids[*tm.ID] = path
+		}
+	}
+	return problems
+}
+
+// decodeError converts an error from unmarshaling the field at path into a validation error
+func decodeError(path string, err error) ValidationError {
+	var ute *json.UnmarshalTypeError
+	if errors.As(err, &ute) {
+		if ute.Field != "" && ute.Struct != "" {
+			path = joinPath(path, ute.Field)
+		}
+		return ValidationError{Path: path, Message: fmt.Sprintf("invalid value of type %v; expected %v", ute.Value, ute.Type)}
+	}
+	return ValidationError{Path: path, Message: err.Error()}
+}
+
+// experimentFields are the fields of an experiment, with tasks left unparsed
+type experimentFields struct {
+	Metadata ExperimentMetadata `json:"metadata"`
+	Spec     []json.RawMessage  `json:"spec"`
+	Finally  []json.RawMessage  `json:"finally"`
+	Deadline *string            `json:"deadline"`
+	Result   json.RawMessage    `json:"result"`
+}
+
+// validateTask checks a single task of an experiment; path is the path of the task (example, spec[1])
+// ids are the IDs of the earlier tasks of the experiment, whose outputs the task may reference
+func validateTask(path string, b json.RawMessage, ids map[string]string) []ValidationError {
+	var tm TaskMeta
+	if err := json.Unmarshal(b, &tm); err != nil {
+		return []ValidationError{{Path: path, Message: "task must be a YAML object"}}
+	}
+
+	var t Task
+	switch {
+	case tm.Run != nil && tm.Task != nil:
+		return []ValidationError{{Path: path, Message: "specify either task or run but not both"}}
+	case tm.Run != nil:
+		t = &runTask{}
+	case tm.Task == nil || *tm.Task == "":
+		return []ValidationError{{Path: path, Message: "task name or run command is required"}}
+	default:
+		factory, ok := getTaskFactory(*tm.Task)
+		if !ok {
+			return []ValidationError{{
+				Path:    path + ".task",
+				Message: fmt.Sprintf("unknown task %q; valid tasks are %v", *tm.Task, strings.Join(RegisteredTasks(), ", ")),
+			}}
+		}
+		t = factory()
+	}
+
+	// references to secret values are checked, and replaced by placeholders
+	problems, b := valueFromErrors(path, b)
+	problems = append(problems, unknownFieldErrors(path, b, reflect.TypeOf(t))...)
+	problems = append(problems, toValidationErrors(path, validateTaskMeta(tm))...)
+	problems = append(problems, templateErrors(path, b, ids)...)
+	// inputs that cannot be decoded cannot be validated further
+	if err := json.Unmarshal(b, t); err != nil {
+		return append(problems, decodeError(path, err))
+	}
+	return append(problems, toValidationErrors(path, t.ValidateInputs())...)
+}
+
+// templateErrors reports the references in the run command and inputs of a task that cannot be executed
+// References are executed as they are when the task runs, against stub outputs of the earlier tasks with the given IDs,
+// so references to other tasks fail as they would when the task runs
+func templateErrors(path string, b []byte, ids map[string]string) []ValidationError {
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil
+	}
+	fields := renderedFields(v)
+	data := templateData{Outputs: map[string]map[string]interface{}{}}
+	for _, field := range fields {
+		addStubOutputs(data.Outputs, v[field], ids)
+	}
+	funcs := FuncMapWithToYAML()
+
+	problems := []ValidationError{}
+	for _, field := range fields {
+		if v[field] == nil {
+			continue
+		}
+		_, err := renderValue(field, v[field], data, funcs)
+		problems = append(problems, toValidationErrors(path, err)...)
+	}
+	return problems
+}
+
+// addStubOutputs adds the outputs referenced by the strings of the decoded JSON value v to outputs
+// Only outputs of the tasks with the given IDs are added; their values are empty strings, or nil if they are ranged over
+func addStubOutputs(outputs map[string]map[string]interface{}, v interface{}, ids map[string]string) {
+	switch val := v.(type) {
+	case string:
+		if refs, err := references(val); err != nil || len(refs) == 0 {
+			// references that cannot be parsed are reported when they are executed
+			return
+		}
+		tree, _ := parseTemplate(val)
+		ranged := map[string]bool{}
+		walkTemplate(tree.Root, func(n parse.Node) {
+			if r, ok := n.(*parse.RangeNode); ok {
+				for _, field := range outputsFields(r.Pipe) {
+					ranged[strings.Join(field, ".")] = true
+				}
+			}
+		})
+		for _, field := range outputsFields(tree.Root) {
+			if len(field) < 2 {
+				continue
+			}
+			if _, ok := ids[field[1]]; !ok {
+				continue
+			}
+			if outputs[field[1]] == nil {
+				outputs[field[1]] = map[string]interface{}{}
+			}
+			var leaf interface{} = ""
+			if ranged[strings.Join(field, ".")] {
+				leaf = nil
+			}
+			addStubOutput(outputs[field[1]], field[2:], leaf)
+		}
+	case map[string]interface{}:
+		for _, e := range val {
+			addStubOutputs(outputs, e, ids)
+		}
+	case []interface{}:
+		for _, e := range val {
+			addStubOutputs(outputs, e, ids)
+		}
+	}
+}
+
+// addStubOutput adds a chain of field names to a stub output; the last field is set to leaf unless it has fields of its own
+func addStubOutput(m map[string]interface{}, chain []string, leaf interface{}) {
+	for i, name := range chain {
+		if i == len(chain)-1 {
+			if _, ok := m[name]; !ok {
+				m[name] = leaf
+			}
+			return
+		}
+		next, ok := m[name].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[name] = next
+		}
+		m = next
+	}
+}
+
+// toValidationErrors flattens an error, possibly joined, into validation errors under path
+func toValidationErrors(path string, err error) []ValidationError {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		problems := []ValidationError{}
+		for _, e := range joined.Unwrap() {
+			problems = append(problems, toValidationErrors(path, e)...)
+		}
+		return problems
+	}
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		return []ValidationError{{Path: joinPath(path, fe.field), Message: fe.msg}}
+	}
+	return []ValidationError{{Path: path, Message: err.Error()}}
+}
+
+// joinPath appends a field to a path
+func joinPath(path string, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// unknownFieldErrors reports the fields in the JSON data b that do not match any field of type t
+func unknownFieldErrors(path string, b []byte, t reflect.Type) []ValidationError {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil
+	}
+	problems := []ValidationError{}
+	for _, f := range unknownFields(path, v, t) {
+		problems = append(problems, ValidationError{Path: f, Message: "unknown field"})
+	}
+	return problems
+}
+
+var (
+	// jsonUnmarshalerType is the type of json.Unmarshaler
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	// textUnmarshalerType is the type of encoding.TextUnmarshaler
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// unknownFields returns the paths of the fields in v, a decoded JSON value,
+// that would be ignored when v is unmarshaled into a value of type t
+func unknownFields(path string, v interface{}, t reflect.Type) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	// types with custom unmarshaling decide for themselves
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return nil
+	}
+
+	unknown := []string{}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ft, ok := lookupJSONField(fields, k)
+			if !ok {
+				unknown = append(unknown, joinPath(path, k))
+				continue
+			}
+			unknown = append(unknown, unknownFields(joinPath(path, k), m[k], ft)...)
+		}
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			unknown = append(unknown, unknownFields(joinPath(path, k), m[k], t.Elem())...)
+		}
+	case reflect.Slice, reflect.Array:
+		s, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, e := range s {
+			unknown = append(unknown, unknownFields(fmt.Sprintf("%v[%d]", path, i), e, t.Elem())...)
+		}
+	}
+	return unknown
+}
+
+// jsonFields returns the JSON names of the fields of a struct type, including those of embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for n, nt := range jsonFields(ft) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = nt
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// lookupJSONField finds a field by name, ignoring case like encoding/json does
+func lookupJSONField(fields map[string]reflect.Type, name string) (reflect.Type, bool) {
+	if t, ok := fields[name]; ok {
+		return t, true
+	}
+	for n, t := range fields {
+		if strings.EqualFold(n, name) {
+			return t, true
+		}
+	}
+	return nil, false
+}
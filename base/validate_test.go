@@ -0,0 +1,159 @@
+package base
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateExperiment(t *testing.T) {
+	b, err := os.ReadFile(CompletePath("../testdata", "experiment.yaml"))
+	assert.NoError(t, err)
+	assert.Empty(t, ValidateExperiment(b))
+
+	// the grpc sample has misspelled and unsupported inputs
+	b, err = os.ReadFile(CompletePath("../testdata", "experiment_grpc.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, []ValidationError{
+		{Path: "spec[0].with.connect-timeeout", Message: "unknown field"},
+		{Path: "spec[0].with.protoURL", Message: "unknown field"},
+	}, ValidateExperiment(b))
+
+	problems := ValidateExperiment([]byte(`
+metadata:
+  name: myName
+deadlin: 10m
+deadline: "10"
+spec:
+- task: http
+  if: Result.NumCompletedTasks
+  timeout: 5x
+  retries: -1
+  onFailure: stop
+  with:
+    urll: http://httpbin.default/get
+    duration: "10"
+    errorRanges:
+    - lower: 500
+      upper: 400
+    - {}
+    percentiles: [0, 99.9]
+    endpoints:
+      a:
+        url: httpbin.default/a
+        connections: 0
+- task: grpc
+  with:
+    call: SayHello
+    concurrency: 5
+    connections: 10
+    load-schedule: ramp
+- task: notify
+- task: hello
+- run: ""
+finally:
+- task: ready
+  with:
+    timeout: soon
+`))
+	assert.Equal(t, []ValidationError{
+		{Path: "deadlin", Message: "unknown field"},
+		{Path: "deadline", Message: `invalid duration "10"`},
+		{Path: "spec[0].with.urll", Message: "unknown field"},
+		{Path: "spec[0].if", Message: problems[3].Message},
+		{Path: "spec[0].timeout", Message: `invalid duration "5x"`},
+		{Path: "spec[0].retries", Message: "must not be negative"},
+		{Path: "spec[0].onFailure", Message: `invalid value "stop"; must be abort or continue`},
+		{Path: "spec[0].with.duration", Message: `invalid duration "10"`},
+		{Path: "spec[0].with.errorRanges[0]", Message: "lower 500 is greater than upper 400"},
+		{Path: "spec[0].with.errorRanges[1]", Message: "at least one of lower and upper is required"},
+		{Path: "spec[0].with.percentiles[0]", Message: "0 is not in the range (0, 100]"},
+		{Path: "spec[0].with.endpoints.a.url", Message: `invalid URL "httpbin.default/a"; expected an absolute http or https URL`},
+		{Path: "spec[0].with.endpoints.a.connections", Message: "must be positive"},
+		{Path: "spec[1].with.call", Message: `invalid call "SayHello"; expected a fully qualified method name (example, helloworld.Greeter.SayHello)`},
+		{Path: "spec[1].with.host", Message: "host is required"},
+		{Path: "spec[1].with.connections", Message: "connections 10 is greater than concurrency 5"},
+		{Path: "spec[1].with.load-schedule", Message: `invalid schedule "ramp"; must be const, step or line`},
+		{Path: "spec[2].with.url", Message: "URL is required"},
+		{Path: "spec[3].task", Message: "unknown task \"hello\"; valid tasks are " + strings.Join(RegisteredTasks(), ", ")},
+		{Path: "spec[4].run", Message: "command cannot be empty"},
+		{Path: "finally[0].with.resource", Message: "resource is required"},
+		{Path: "finally[0].with.name", Message: "name is required"},
+		{Path: "finally[0].with.timeout", Message: `invalid duration "soon"`},
+	}, problems)
+	assert.Contains(t, problems[3].Message, "invalid condition")
+}
+
+func TestValidateExperimentInvalidYAML(t *testing.T) {
+	problems := ValidateExperiment([]byte("spec: [\n"))
+	assert.Equal(t, 1, len(problems))
+	assert.Contains(t, problems[0].Error(), "invalid YAML")
+
+	problems = ValidateExperiment([]byte(`
+spec:
+- task: http
+  run: echo hello
+- with:
+    url: http://httpbin.default/get
+- task: http
+  timeout: 1m
+  retries: -1
+  with:
+    url: [http://httpbin.default/get]
+`))
+	assert.Equal(t, []ValidationError{
+		{Path: "spec[0]", Message: "specify either task or run but not both"},
+		{Path: "spec[1]", Message: "task name or run command is required"},
+		{Path: "spec[2].retries", Message: "must not be negative"},
+		{Path: "spec[2].with.url", Message: "invalid value of type array; expected string"},
+	}, problems)
+	assert.Equal(t, "spec[0]: specify either task or run but not both", problems[0].Error())
+}
+
+func TestValidateExperimentOutputs(t *testing.T) {
+	problems := ValidateExperiment([]byte(`
+spec:
+- id: login
+  run: echo '{"token":"abc"}'
+- id: login
+  task: http
+  with:
+    url: "{{ .Outputs.login.json.url }}"
+    duration: "{{ .Outputs.login.stdout }}"
+    headers:
+      Authorization: Bearer {{ .Outputs.login.json.token
+finally:
+- id: 1st
+  run: echo done
+`))
+	assert.Equal(t, []ValidationError{
+		{Path: "spec[1].with.headers.Authorization", Message: problems[0].Message},
+		{Path: "spec[1].id", Message: `duplicate ID "login"; also used by spec[0]`},
+		{Path: "finally[0].id", Message: `invalid ID "1st"; must start with a letter and contain only letters, digits and underscores`},
+	}, problems)
+	assert.Contains(t, problems[0].Message, "invalid template")
+
+	// references are executed against the outputs of earlier tasks; other templates are left as is
+	problems = ValidateExperiment([]byte(`
+spec:
+- id: login
+  run: kubectl get pods -o go-template='{{range .items}}{{.metadata.name}}{{end}}'
+- run: echo {{ .Outputs.login.stdout | trim }} {{ .Outputs.later.stdout }}
+  with:
+    templates: true
+- task: http
+  with:
+    url: "{{ .Outputs.login.json.url }}"
+    headers:
+      Authorization: Bearer {{ .Outputs.login.json.token | b64enc }}
+      X-Tool: "{{ .Values.tool }}"
+      X-Keys: "{{ range $k, $v := .Outputs.login.json }}{{ $k }}={{ $v }},{{ end }}"
+- id: later
+  run: echo {{ .Outputs.nothing }}
+`))
+	assert.Len(t, problems, 1)
+	assert.Equal(t, "spec[1].run", problems[0].Path)
+	assert.Contains(t, problems[0].Message, `map has no entry for key "later"`)
+}
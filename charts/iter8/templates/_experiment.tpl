@@ -5,25 +5,43 @@
 metadata:
   name: {{ .Release.Name }}
   namespace: {{ .Release.Namespace }}
+{{- if .Values.deadline }}
+deadline: {{ .Values.deadline }}
+{{- end }}
 spec:
   {{- range .Values.tasks }}
-  {{- if eq "grpc" . }}
-  {{- include "task.grpc" $.Values.grpc -}}
-  {{- else if eq "http" . }}
-  {{- include "task.http" $.Values.http -}}
-  {{- else if eq "ready" . }}
-  {{- include "task.ready" $ -}}
-  {{- else if eq "slack" . }}
-  {{- include "task.slack" $.Values.slack -}}
-  {{- else if eq "github" . }}
-  {{- include "task.github" $.Values.github -}}
-  {{- else }}
-  {{- fail "task name must be one of grpc, http, ready, github, or slack" -}}
+  {{- include "experiment.task" (dict "task" . "root" $) -}}
   {{- end }}
+{{- if .Values.finally }}
+finally:
+  {{- range .Values.finally }}
+  {{- include "experiment.task" (dict "task" . "root" $) -}}
   {{- end }}
+{{- end }}
 result:
   startTime:         {{ now | toJson }}
   numCompletedTasks: 0
   failure:           false
   iter8Version:      {{ .Values.majorMinor }}
-{{- end }}
\ No newline at end of file
+{{- end }}
+
+{{- define "experiment.task" -}}
+{{- $root := .root }}
+{{- if eq "grpc" .task }}
+{{- include "task.grpc" $root.Values.grpc -}}
+{{- else if eq "http" .task }}
+{{- include "task.http" $root.Values.http -}}
+{{- else if eq "assess" .task }}
+{{- include "task.assess" $root.Values.assess -}}
+{{- else if eq "ready" .task }}
+{{- include "task.ready" $root -}}
+{{- else if eq "k8s" .task }}
+{{- include "task.k8s" $root.Values.k8s -}}
+{{- else if eq "slack" .task }}
+{{- include "task.slack" $root.Values.slack -}}
+{{- else if eq "github" .task }}
+{{- include "task.github" $root.Values.github -}}
+{{- else }}
+{{- fail "task name must be one of grpc, http, assess, ready, k8s, github, or slack" -}}
+{{- end }}
+{{- end }}
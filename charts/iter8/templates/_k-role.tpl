@@ -10,6 +10,69 @@ rules:
   resourceNames: [{{ .Release.Name | quote }}]
   resources: ["secrets"]
   verbs: ["get", "update"]
+{{- /* secrets referenced by valueFrom in the inputs of tasks are read when the tasks run */}}
+{{- $secrets := include "k.secretKeyRefs" .Values | splitList "\n" | compact | uniq | sortAlpha }}
+{{- if $secrets }}
+- apiGroups: [""]
+  resourceNames: {{ toJson $secrets }}
+  resources: ["secrets"]
+  verbs: ["get"]
+{{- end }}
+{{- /* objects changed by the k8s task are in the namespace of the release */ -}}
+{{- range $action := .Values.k8s }}
+{{- $group := $action.group }}
+{{- $name := $action.name }}
+{{- if eq "apply" $action.action }}
+{{- if not $action.resource }}
+{{- fail "please set the resource parameter of apply actions" }}
+{{- end }}
+{{- /* the group and name of the object are those of the action, or else those of the manifest; */}}
+{{- /* manifests with templates are only rendered when the task runs, so they may not be read here */}}
+{{- $manifest := dict }}
+{{- if kindIs "map" $action.manifest }}
+{{- $manifest = $action.manifest }}
+{{- else if and (kindIs "string" $action.manifest) (not (contains "{{" $action.manifest)) }}
+{{- $manifest = fromYaml $action.manifest }}
+{{- end }}
+{{- if not (hasKey $action "group") }}
+{{- if not (kindIs "string" $manifest.apiVersion) }}
+{{- fail "please set the group parameter of apply actions whose manifest apiVersion cannot be read by the chart" }}
+{{- end }}
+{{- $apiVersion := splitList "/" $manifest.apiVersion }}
+{{- $group = ternary (first $apiVersion) "" (eq 2 (len $apiVersion)) }}
+{{- end }}
+{{- if not $name }}
+{{- $name = dig "metadata" "name" "" $manifest }}
+{{- if not (kindIs "string" $name) }}
+{{- $name = "" }}
+{{- end }}
+{{- end }}
+{{- if not $name }}
+{{- fail "please set the name parameter of apply actions whose manifest name cannot be read by the chart" }}
+{{- end }}
+{{- end }}
+- apiGroups: [ {{ default "" $group | quote }} ]
+  resourceNames: [ {{ $name | quote }} ]
+  {{- if eq "apply" $action.action }}
+  resources: [ {{ $action.resource | quote }} ]
+  verbs: [ "get", "patch" ]
+{{- /* objects that do not exist yet are created, which cannot be restricted by name */}}
+- apiGroups: [ {{ default "" $group | quote }} ]
+  resources: [ {{ $action.resource | quote }} ]
+  verbs: [ "create" ]
+  {{- else if eq "patch" $action.action }}
+  resources: [ {{ $action.resource | quote }} ]
+  verbs: [ "get", "patch" ]
+  {{- else if eq "scale" $action.action }}
+  resources: [ {{ print $action.resource "/scale" | quote }} ]
+  verbs: [ "get", "patch" ]
+  {{- else if eq "delete" $action.action }}
+  resources: [ {{ $action.resource | quote }} ]
+  verbs: [ "delete" ]
+  {{- else }}
+  {{- fail "k8s action must be one of apply, patch, scale, or delete" }}
+  {{- end }}
+{{- end }} {{- /* range $action := .Values.k8s */}}
 {{- if .Values.ready }}
 ---
 {{- $namespace := coalesce $.Values.ready.namespace $.Release.Namespace }}    
@@ -23,17 +86,51 @@ metadata:
   annotations:
     iter8.tools/test: {{ .Release.Name }}
 rules:
-{{- $typesToCheck := omit .Values.ready "timeout" "namespace" }}
-{{- range $type, $name := $typesToCheck }}
-{{- $definition := get $.Values.resourceTypes $type }}
-{{- if not $definition }}
-{{- cat "no type definition for: " $type | fail }}
-{{- else }}
-- apiGroups: [ {{ get $definition "Group" | quote }} ]
-  resourceNames: [ {{ $name | quote }} ]
-  resources: [ {{ get $definition "Resource" | quote }} ]
-  verbs: [ "get" ]
-{{- end }} {{- /* if not $definition */}}
-{{- end }} {{- /* range $type, $name */}}
+{{- $typesToCheck := omit .Values.ready "timeout" "namespace" "objects" }}
+{{- range $type, $spec := $typesToCheck }}
+{{- include "ready.rule" (list $ $type $spec) }}
+{{- end }} {{- /* range $type, $spec */}}
+{{- range $object := .Values.ready.objects }}
+{{- include "ready.rule" (list $ $object.type $object) }}
+{{- end }} {{- /* range $object */}}
 {{- end }} {{- /* {{- if .Values.ready */}}
 {{- end }} {{- /* {{- if .Values.ready */}}
+
+{{- /* ready.rule renders the rule that allows the ready task to check an object, given (list $ type spec) */}}
+{{- /* objects are selected by name, or listed by label selector, which cannot be restricted by name */}}
+{{- define "ready.rule" }}
+{{- $object := include "ready.object" . | fromYaml }}
+- apiGroups: [ {{ $object.group | quote }} ]
+  {{- if $object.selector }}
+  resources: [ {{ $object.resource | quote }} ]
+  verbs: [ "list" ]
+  {{- else }}
+  resourceNames: [ {{ $object.name | quote }} ]
+  resources: [ {{ $object.resource | quote }} ]
+  verbs: [ "get" ]
+  {{- end }}
+{{- end }} {{- /* define "ready.rule" */}}
+
+
+{{- /* k.secretKeyRefs renders the names of the secrets referenced by valueFrom in a value, one per line */}}
+{{- /* references are maps with a single valueFrom key; references in payload templates of notifications are not read by the chart */}}
+{{- define "k.secretKeyRefs" }}
+{{- if kindIs "map" . }}
+{{- if and (hasKey . "valueFrom") (eq 1 (len .)) }}
+{{- if kindIs "map" .valueFrom }}
+{{- $name := dig "secretKeyRef" "name" "" .valueFrom }}
+{{- if kindIs "string" $name }}
+{{- $name }}{{ "\n" }}
+{{- end }}
+{{- end }}
+{{- else }}
+{{- range $v := . }}
+{{- include "k.secretKeyRefs" $v }}
+{{- end }}
+{{- end }}
+{{- else if kindIs "slice" . }}
+{{- range $v := . }}
+{{- include "k.secretKeyRefs" $v }}
+{{- end }}
+{{- end }}
+{{- end }} {{- /* define "k.secretKeyRefs" */}}
@@ -0,0 +1,13 @@
+{{- define "task.assess" -}}
+{{- /* Validate values */ -}}
+{{- if not . }}
+{{- fail "assess values object is nil" }}
+{{- end }}
+{{- if not (or .SLOs .objectives) }}
+{{- fail "please set the SLOs parameter or the objectives parameter" }}
+{{- end }}
+# task: assess SLOs and objectives using the results of the http and grpc tasks
+- task: assess
+  with:
+{{ toYaml . | indent 4 }}
+{{- end }}
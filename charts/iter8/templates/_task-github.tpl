@@ -20,6 +20,6 @@
     headers:
       Authorization: token {{ .token }}
       Accept: application/vnd.github+json
-    payloadTemplateURL: {{ default "https://raw.githubusercontent.com/iter8-tools/iter8/v0.16.5/templates/notify/_payload-github.tpl" .payloadTemplateURL }}
+{{- include "task.notify.delivery" (dict "values" . "template" "github") }}
     softFailure: {{ default true .softFailure }}
 {{ end }}
\ No newline at end of file
@@ -35,24 +35,28 @@
 - run: |
     curl -o /tmp/ghz.proto {{ $vals.protoURL }}
 {{- $_ := set $vals "proto" "/tmp/ghz.proto" }}
+{{- $_ := unset $vals "protoURL" }}
 {{- end }}
 {{- if $vals.dataURL }}
 # task: download JSON data file from URL
 - run: |
     curl -o /tmp/data.json {{ $vals.dataURL }}
 {{- $_ := set $vals "data-file" "/tmp/data.json" }}
+{{- $_ := unset $vals "dataURL" }}
 {{- end }}
 {{- if $vals.binaryDataURL }}
 # task: download binary data file from URL
 - run: |
     curl -o /tmp/data.bin {{ $vals.binaryDataURL }}
 {{- $_ := set $vals "binary-file" "/tmp/data.bin" }}
+{{- $_ := unset $vals "binaryDataURL" }}
 {{- end }}
 {{- if $vals.metadataURL }}
 # task: download metadata JSON file from URL
 - run: |
     curl -o /tmp/metadata.json {{ $vals.metadataURL }}
 {{- $_ := set $vals "metadata-file" "/tmp/metadata.json" }}
+{{- $_ := unset $vals "metadataURL" }}
 {{- end }}
 {{- /**************************/ -}}
 {{- /* Repeat above for each endpoint */ -}}
@@ -63,6 +67,7 @@
 - run: |
     curl -o {{ $protoFile }} {{ $endpoint.protoURL }}
 {{- $_ := set $endpoint "proto" $protoFile }}
+{{- $_ := unset $endpoint "protoURL" }}
 {{- end }}
 {{- if $endpoint.dataURL }}
 {{- $dataFile := print "/tmp/" $endpointID "_data.json" }}
@@ -70,6 +75,7 @@
 - run: |
     curl -o {{ $dataFile }} {{ $endpoint.dataURL }}
 {{- $_ := set $endpoint "data-file" $dataFile }}
+{{- $_ := unset $endpoint "dataURL" }}
 {{- end }}
 {{- if $endpoint.binaryDataURL }}
 {{- $binDataFile := print "/tmp/" $endpointID "_data.bin" }}
@@ -77,6 +83,7 @@
 - run: |
     curl -o {{ $binDataFile }} {{ $endpoint.binaryDataURL }}
 {{- $_ := set $endpoint "binary-file" $binDataFile }}
+{{- $_ := unset $endpoint "binaryDataURL" }}
 {{- end }}
 {{- if $endpoint.metadataURL }}
 {{- $metadataFile := print "/tmp/" $endpointID "_metadata.json" }}
@@ -84,6 +91,7 @@
 - run: |
     curl -o {{ $metadataFile }} {{ $endpoint.metadataURL }}
 {{- $_ := set $endpoint "metadata-file" $metadataFile }}
+{{- $_ := unset $endpoint "metadataURL" }}
 {{- end }}
 {{- end }}
 {{- /**************************/ -}}
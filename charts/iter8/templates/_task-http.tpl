@@ -23,6 +23,15 @@
 - run: |
     curl -o /tmp/payload.dat {{ $vals.payloadURL }}
 {{- $_ := set $vals "payloadFile" "/tmp/payload.dat" }}
+{{- $_ := unset $vals "payloadURL" }}
+{{- end }}
+{{- if $vals.payloadDataURL }}
+{{- $payloadDataFile := print "/tmp/" (base $vals.payloadDataURL) }}
+# task: download payload dataset from payload data URL
+- run: |
+    curl -o {{ $payloadDataFile }} {{ $vals.payloadDataURL }}
+{{- $_ := set $vals "payloadData" (merge (dict "path" $payloadDataFile) (default dict $vals.payloadData)) }}
+{{- $_ := unset $vals "payloadDataURL" }}
 {{- end }}
 {{- /**************************/ -}}
 {{- /* Repeat above for each endpoint */ -}}
@@ -33,6 +42,15 @@
 - run: |
     curl -o {{ $payloadFile }} {{ $endpoint.payloadURL }}
 {{- $_ := set $endpoint "payloadFile" $payloadFile }}
+{{- $_ := unset $endpoint "payloadURL" }}
+{{- end }}
+{{- if $endpoint.payloadDataURL }}
+{{- $payloadDataFile := print "/tmp/" $endpointID "_" (base $endpoint.payloadDataURL) }}
+# task: download payload dataset from payload data URL for endpoint
+- run: |
+    curl -o {{ $payloadDataFile }} {{ $endpoint.payloadDataURL }}
+{{- $_ := set $endpoint "payloadData" (merge (dict "path" $payloadDataFile) (default dict $endpoint.payloadData)) }}
+{{- $_ := unset $endpoint "payloadDataURL" }}
 {{- end }}
 {{- end }}
 {{- /**************************/ -}}
@@ -58,8 +76,8 @@
 {{- /**************************/ -}}
 {{- /* Main task */ -}}
 {{- /* remove warmup options if present */ -}}
-{{- $_ := unset . "warmupDuration" }}
-{{- $_ := unset . "warmupNumRequests" }}
+{{- $_ := unset $vals "warmupDuration" }}
+{{- $_ := unset $vals "warmupNumRequests" }}
 # task: generate HTTP requests for app
 # collect Iter8's built-in HTTP latency and error-related metrics
 - task: http
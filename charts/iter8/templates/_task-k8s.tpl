@@ -0,0 +1,19 @@
+{{- define "task.k8s" -}}
+{{- /* Validate values */ -}}
+{{- if not . }}
+{{- fail "k8s values object is nil" }}
+{{- end }}
+{{- range $i, $action := . }}
+{{- $vals := mustDeepCopy $action }}
+# task: {{ $vals.action }} a Kubernetes object
+- task: k8s
+{{- if $vals.id }}
+  id: {{ $vals.id | quote }}
+{{- end }}
+{{- if $vals.if }}
+  if: {{ $vals.if | quote }}
+{{- end }}
+  with:
+{{ toYaml (omit $vals "id" "if") | indent 4 }}
+{{- end }}
+{{- end }}
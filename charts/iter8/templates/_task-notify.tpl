@@ -0,0 +1,23 @@
+{{- define "task.notify.delivery" -}}
+{{- /* payload template and delivery options of a notify task; the payload template is built into Iter8 unless a URL is given */ -}}
+{{- with .values }}
+{{- if .payloadTemplateURL }}
+    payloadTemplateURL: {{ .payloadTemplateURL }}
+{{- else }}
+    payloadTemplateName: {{ $.template }}
+{{- end }}
+{{- if .timeout }}
+    timeout: {{ .timeout }}
+{{- end }}
+{{- if hasKey . "retries" }}
+    retries: {{ .retries }}
+{{- end }}
+{{- if .backoff }}
+    backoff: {{ .backoff }}
+{{- end }}
+{{- if .signature }}
+    signature:
+{{ toYaml .signature | indent 6 }}
+{{- end }}
+{{- end }}
+{{- end }}
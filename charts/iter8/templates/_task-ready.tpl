@@ -1,30 +1,58 @@
 {{- define "task.ready" }}
 {{- if .Values.ready }}
-{{- $typesToCheck := omit .Values.ready "timeout" "namespace" }}
-{{- range $type, $name := $typesToCheck }}
-{{- $definition := get $.Values.resourceTypes $type }}
-{{- if not $definition }}
-{{- cat "no type definition for: " $type | fail }}
-{{- else }}
+{{- $typesToCheck := omit .Values.ready "timeout" "namespace" "objects" }}
+{{- $namespace := coalesce $.Values.ready.namespace $.Release.Namespace }}
+{{- range $type, $spec := $typesToCheck }}
 # task: test for existence and readiness of a resource
 - task: ready
   with:
-    name: {{ $name | quote }}
-    group: {{ get $definition "Group" | quote }}
-    version: {{ get $definition "Version" | quote }}
-    resource: {{ get $definition "Resource" | quote }}
-    {{- if (hasKey $definition "conditions") }}
-    conditions:
-{{ toYaml (get $definition "conditions") | indent 4 }}
-    {{- end }} {{- /* if (hasKey $definition "conditions") */}}
-{{- $namespace := coalesce $.Values.ready.namespace $.Release.Namespace }}    
+{{ include "ready.object" (list $ $type $spec) | indent 4 }}
+{{- if $namespace }}
+    namespace: {{ $namespace }}
+{{- end }} {{- /* if $namespace */}}
+{{- if $.Values.ready.timeout }}
+    timeout: {{ $.Values.ready.timeout }}
+{{- end }} {{- /* if $.Values.ready.timeout */}}
+{{- end }} {{- /* range $type, $spec */}}
+{{- if .Values.ready.objects }}
+{{- $objects := list }}
+{{- range $object := .Values.ready.objects }}
+{{- $objects = append $objects (include "ready.object" (list $ $object.type $object) | fromYaml) }}
+{{- end }} {{- /* range $object */}}
+# task: test for existence and readiness of resources
+- task: ready
+  with:
+    objects:
+{{ toYaml $objects | indent 4 }}
 {{- if $namespace }}
     namespace: {{ $namespace }}
 {{- end }} {{- /* if $namespace */}}
 {{- if $.Values.ready.timeout }}
     timeout: {{ $.Values.ready.timeout }}
 {{- end }} {{- /* if $.Values.ready.timeout */}}
-{{- end }} {{- /* if not $definition */}}
-{{- end }} {{- /* range $type, $name */}}
+{{- end }} {{- /* if .Values.ready.objects */}}
 {{- end }} {{- /* {{- if .Values.ready */}}
 {{- end }} {{- /* define "task.ready" */}}
+
+{{- /* ready.object renders the inputs of the ready task for an object of a resource type, given (list $ type spec) */}}
+{{- /* spec is either the name of the object, or a map with its name or selector and, optionally, conditions and jsonPath */}}
+{{- define "ready.object" }}
+{{- $root := index . 0 }}
+{{- $type := index . 1 }}
+{{- $spec := index . 2 }}
+{{- $definition := get $root.Values.resourceTypes (toString $type) }}
+{{- if not $definition }}
+{{- cat "no type definition for: " $type | fail }}
+{{- end }}
+{{- if kindIs "string" $spec }}
+{{- $spec = dict "name" $spec }}
+{{- end }}
+{{- if not (or $spec.name $spec.selector) }}
+{{- cat "please set the name or selector of the ready object of type:" $type | fail }}
+{{- end }}
+{{- $object := dict "group" (get $definition "Group") "version" (get $definition "Version") "resource" (get $definition "Resource") }}
+{{- if (hasKey $definition "conditions") }}
+{{- $_ := set $object "conditions" (get $definition "conditions") }}
+{{- end }}
+{{- toYaml (merge (pick $spec "name" "selector" "conditions" "jsonPath") $object) }}
+{{- end }} {{- /* define "ready.object" */}}
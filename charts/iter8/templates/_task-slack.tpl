@@ -11,6 +11,6 @@
   with:
     url: {{ .url }}
     method: POST
-    payloadTemplateURL: {{ default "https://raw.githubusercontent.com/iter8-tools/iter8/v0.16.5/templates/notify/_payload-slack.tpl" .payloadTemplateURL }}
+{{- include "task.notify.delivery" (dict "values" . "template" "slack") }}
     softFailure: {{ default true .softFailure }}
 {{ end }} 
\ No newline at end of file
@@ -27,10 +27,13 @@ func newKRunCmd(kd *driver.KubeDriver, _ io.Writer) *cobra.Command {
 		Long:         krunDesc,
 		SilenceUsage: true,
 		Hidden:       true,
-		RunE: func(_ *cobra.Command, _ []string) error {
-			return actor.KubeRun()
+		RunE: func(c *cobra.Command, _ []string) error {
+			ctx, stop := signalContext(c.Context())
+			defer stop()
+			return actor.KubeRun(ctx)
 		},
 	}
 	addTestFlag(cmd, &actor.Test)
+	addFreshFlag(cmd, &actor.Fresh)
 	return cmd
 }
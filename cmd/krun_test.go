@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"testing"
 
 	"fortio.org/fortio/fhttp"
@@ -31,7 +32,7 @@ func TestKRun(t *testing.T) {
 	// create and configure HTTP endpoint for testing
 	mux, addr := fhttp.DynamicHTTPServer(false)
 	url := fmt.Sprintf("http://127.0.0.1:%d/get", addr.Port)
-	var verifyHandlerCalled bool
+	var verifyHandlerCalled atomic.Bool
 	mux.HandleFunc("/get", base.GetTrackingHandler(&verifyHandlerCalled))
 
 	// mock metrics server
@@ -91,6 +92,6 @@ func TestKRun(t *testing.T) {
 
 	runTestActionCmd(t, tests)
 	// sanity check -- handler was called
-	assert.True(t, verifyHandlerCalled)
+	assert.True(t, verifyHandlerCalled.Load())
 	assert.True(t, metricsServerCalled)
 }
@@ -58,6 +58,15 @@ func init() {
 	// add k
 	rootCmd.AddCommand(kcmd)
 
+	// add run
+	rootCmd.AddCommand(newRunCmd())
+
+	// add schema
+	rootCmd.AddCommand(newSchemaCmd())
+
+	// add validate
+	rootCmd.AddCommand(newValidateCmd())
+
 	// add version
 	rootCmd.AddCommand(newVersionCmd())
 
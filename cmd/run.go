@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	ia "github.com/iter8-tools/iter8/action"
+	"github.com/spf13/cobra"
+)
+
+// runDesc is the description of the run command
+const runDesc = `
+Run a performance test locally. This command reads a test specified in the experiment.yaml file in the run directory and writes the result into the result.yaml file in the same directory.
+
+	$ iter8 run --runDir {{ run directory }}
+
+This command does not require access to a Kubernetes cluster or to the Iter8 metrics service. It is intended for running tests on a local machine or in CI pipelines.
+
+If the test is interrupted (SIGINT or SIGTERM), the running task is stopped, the finally tasks are run, and the partial result is written with the test marked as aborted. A second interrupt terminates the command immediately.
+`
+
+// newRunCmd creates the local run command
+func newRunCmd() *cobra.Command {
+	actor := ia.NewRunOpts(nil)
+	cmd := &cobra.Command{
+		Use:          "run",
+		Short:        "Run a performance test locally",
+		Long:         runDesc,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, _ []string) error {
+			ctx, stop := signalContext(c.Context())
+			defer stop()
+			return actor.LocalRun(ctx)
+		},
+	}
+	addRunDirFlag(cmd, &actor.RunDir)
+	addFreshFlag(cmd, &actor.Fresh)
+	return cmd
+}
+
+// signalContext returns a context that is cancelled on the first SIGINT or SIGTERM
+// Once cancelled, signals are no longer caught, so a second signal terminates the process
+func signalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// addRunDirFlag adds the run directory flag
+func addRunDirFlag(cmd *cobra.Command, runDirP *string) {
+	cmd.Flags().StringVar(runDirP, "runDir", ".", "directory where the experiment.yaml file is located and the result.yaml file will be written")
+}
+
+// addFreshFlag adds the fresh flag
+func addFreshFlag(cmd *cobra.Command, freshP *bool) {
+	cmd.Flags().BoolVar(freshP, "fresh", false, "ignore the result of any previous interrupted run and start from the first task")
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+
+	"fortio.org/fortio/fhttp"
+	"github.com/iter8-tools/iter8/base"
+	id "github.com/iter8-tools/iter8/driver"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	// create and configure HTTP endpoint for testing
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	url := fmt.Sprintf("http://127.0.0.1:%d/get", addr.Port)
+	var verifyHandlerCalled atomic.Bool
+	mux.HandleFunc("/get", base.GetTrackingHandler(&verifyHandlerCalled))
+
+	dir := t.TempDir()
+	_ = os.Chdir(dir)
+
+	// create experiment.yaml
+	base.CreateExperimentYaml(t, base.CompletePath("../testdata", base.ExperimentTemplateFile), url, base.ExperimentFile)
+
+	tests := []cmdTestCase{
+		// run
+		{
+			name:   "run",
+			cmd:    fmt.Sprintf("run --runDir %v", dir),
+			golden: base.CompletePath("../testdata", "output/run.txt"),
+		},
+	}
+
+	runTestActionCmd(t, tests)
+	// sanity check -- handler was called
+	assert.True(t, verifyHandlerCalled.Load())
+	assert.FileExists(t, path.Join(dir, id.ResultFile))
+}
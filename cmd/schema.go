@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/iter8-tools/iter8/base"
+	"github.com/iter8-tools/iter8/base/log"
+	"github.com/spf13/cobra"
+)
+
+// schemaDesc is the description of the schema command
+const schemaDesc = `
+Print the JSON Schema of performance tests. The schema describes the tasks of a test and the inputs of each task, and is generated from the version of the Iter8 CLI used.
+
+	$ iter8 schema > iter8-schema.json
+
+Editors and linters can use the schema to autocomplete and check tests. For example, editors based on the YAML language server check an experiment.yaml file that starts with the following comment.
+
+	# yaml-language-server: $schema=iter8-schema.json
+`
+
+// newSchemaCmd creates the schema command
+func newSchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "schema",
+		Short:        "Print the JSON Schema of performance tests",
+		Long:         schemaDesc,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, _ []string) error {
+			b, err := json.MarshalIndent(base.ExperimentSchema(), "", "  ")
+			if err != nil {
+				log.Logger.WithStackTrace(err.Error()).Error("unable to marshal schema")
+				return err
+			}
+			fmt.Fprintln(c.OutOrStdout(), string(b))
+			return nil
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema(t *testing.T) {
+	_, out, err := executeActionCommandC(storageFixture(), "schema")
+	assert.NoError(t, err)
+
+	schema := map[string]interface{}{}
+	err = json.Unmarshal([]byte(out), &schema)
+	assert.NoError(t, err)
+	assert.Contains(t, schema, "definitions")
+}
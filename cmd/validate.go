@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+
+	ia "github.com/iter8-tools/iter8/action"
+	"github.com/spf13/cobra"
+)
+
+// validateDesc is the description of the validate command
+const validateDesc = `
+Validate a performance test without running it. This command reports every problem found in the test, along with the task and field it was found in.
+
+	$ iter8 validate -f experiment.yaml
+
+The test may also be read from Kubernetes manifests rendered from the Iter8 chart. This is intended for use in CI pipelines before the chart is installed.
+
+	$ helm template {{ test name }} iter8 --repo https://iter8-tools.github.io/iter8 -f values.yaml | iter8 validate -f -
+`
+
+// newValidateCmd creates the validate command
+func newValidateCmd() *cobra.Command {
+	actor := ia.NewValidateOpts()
+	cmd := &cobra.Command{
+		Use:          "validate",
+		Short:        "Validate a performance test without running it",
+		Long:         validateDesc,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, _ []string) error {
+			problems, err := actor.LocalValidate(c.InOrStdin())
+			if err != nil {
+				return err
+			}
+			out := c.OutOrStdout()
+			if len(problems) == 0 {
+				fmt.Fprintln(out, "test is valid")
+				return nil
+			}
+			for _, p := range problems {
+				fmt.Fprintln(out, p.Error())
+			}
+			return fmt.Errorf("test is invalid: found %v problems", len(problems))
+		},
+	}
+	cmd.Flags().StringVarP(&actor.File, "file", "f", actor.File, "experiment file to validate; use - to read standard input")
+	return cmd
+}
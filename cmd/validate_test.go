@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/iter8-tools/iter8/base"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []cmdTestCase{
+		// valid
+		{
+			name:   "valid",
+			cmd:    fmt.Sprintf("validate -f %v", base.CompletePath("../testdata", "experiment.yaml")),
+			golden: base.CompletePath("../testdata", "output/validate.txt"),
+		},
+		// invalid
+		{
+			name:      "invalid",
+			cmd:       fmt.Sprintf("validate -f %v", base.CompletePath("../testdata", "experiment_grpc.yaml")),
+			golden:    base.CompletePath("../testdata", "output/validate-invalid.txt"),
+			wantError: true,
+		},
+	}
+
+	runTestActionCmd(t, tests)
+}
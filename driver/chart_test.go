@@ -0,0 +1,85 @@
+package driver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// renderRole renders the role of the Iter8 chart with the given values
+func renderRole(t *testing.T, values map[string]interface{}) rbacv1.Role {
+	chart, err := loader.Load("../charts/iter8")
+	assert.NoError(t, err)
+
+	vals, err := chartutil.ToRenderValues(chart, values, chartutil.ReleaseOptions{
+		Name:      myName,
+		Namespace: myNamespace,
+	}, chartutil.DefaultCapabilities)
+	assert.NoError(t, err)
+
+	manifests, err := engine.Render(chart, vals)
+	assert.NoError(t, err)
+
+	var role rbacv1.Role
+	for _, doc := range strings.Split(manifests["iter8/templates/k8s.yaml"], "\n---") {
+		if strings.Contains(doc, "kind: Role\n") {
+			assert.NoError(t, yaml.Unmarshal([]byte(doc), &role))
+			break
+		}
+	}
+	return role
+}
+
+func TestChartRoleSecretKeyRefs(t *testing.T) {
+	secretRef := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"valueFrom": map[string]interface{}{
+				"secretKeyRef": map[string]interface{}{"name": name, "key": "token"},
+			},
+		}
+	}
+
+	role := renderRole(t, map[string]interface{}{
+		"tasks": []interface{}{"http", "slack"},
+		"http": map[string]interface{}{
+			"url": "https://httpbin.default/get",
+			"headers": map[string]interface{}{
+				"Authorization": secretRef("creds"),
+			},
+			"endpoints": map[string]interface{}{
+				"post": map[string]interface{}{
+					"url":     "https://httpbin.default/post",
+					"headers": map[string]interface{}{"Authorization": secretRef("creds")},
+				},
+			},
+		},
+		"slack": map[string]interface{}{
+			"url": "https://hooks.slack.com/services/id",
+			"signature": map[string]interface{}{
+				"secret": secretRef("hooks"),
+			},
+		},
+	})
+
+	assert.Len(t, role.Rules, 2)
+	assert.Equal(t, []string{myName}, role.Rules[0].ResourceNames)
+	assert.Equal(t, rbacv1.PolicyRule{
+		APIGroups:     []string{""},
+		ResourceNames: []string{"creds", "hooks"},
+		Resources:     []string{"secrets"},
+		Verbs:         []string{"get"},
+	}, role.Rules[1])
+
+	// without references, only the secret of the release may be read
+	role = renderRole(t, map[string]interface{}{
+		"tasks": []interface{}{"http"},
+		"http":  map[string]interface{}{"url": "https://httpbin.default/get"},
+	})
+	assert.Len(t, role.Rules, 1)
+}
@@ -0,0 +1,83 @@
+package driver
+
+import (
+	"errors"
+	"os"
+	"path"
+
+	"github.com/iter8-tools/iter8/base"
+	"github.com/iter8-tools/iter8/base/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ResultFile is the name of the experiment result file, and of the key of the experiment secret with the result
+	ResultFile = "result.yaml"
+)
+
+// FileDriver enables reading experiment spec and writing experiment result files
+type FileDriver struct {
+	// RunDir is the directory where the experiment.yaml file is to be found
+	RunDir string
+}
+
+// NewFileDriver creates and returns a new FileDriver
+func NewFileDriver(runDir string) *FileDriver {
+	return &FileDriver{
+		RunDir: runDir,
+	}
+}
+
+// Read the experiment from the experiment.yaml file in the run directory
+func (f *FileDriver) Read() (*base.Experiment, error) {
+	b, err := os.ReadFile(path.Join(f.RunDir, base.ExperimentFile))
+	if err != nil {
+		log.Logger.WithStackTrace(err.Error()).Error("unable to read experiment")
+		return nil, errors.New("unable to read experiment")
+	}
+
+	return ExperimentFromBytes(b)
+}
+
+// Write the experiment result to the result.yaml file in the run directory
+func (f *FileDriver) Write(exp *base.Experiment) error {
+	b, err := yaml.Marshal(exp.Result)
+	if err != nil {
+		log.Logger.WithStackTrace(err.Error()).Error("unable to marshal experiment result")
+		return errors.New("unable to marshal experiment result")
+	}
+
+	err = os.WriteFile(path.Join(f.RunDir, ResultFile), b, 0600)
+	if err != nil {
+		log.Logger.WithStackTrace(err.Error()).Error("unable to write experiment result")
+		return errors.New("unable to write experiment result")
+	}
+
+	return nil
+}
+
+// ReadResult reads the experiment result from the result.yaml file in the run directory
+func (f *FileDriver) ReadResult(_ *base.Experiment) (*base.ExperimentResult, error) {
+	b, err := os.ReadFile(path.Join(f.RunDir, ResultFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		log.Logger.WithStackTrace(err.Error()).Error("unable to read experiment result")
+		return nil, errors.New("unable to read experiment result")
+	}
+
+	r := &base.ExperimentResult{}
+	err = yaml.Unmarshal(b, r)
+	if err != nil {
+		log.Logger.WithStackTrace(err.Error()).Error("unable to unmarshal experiment result")
+		return nil, errors.New("unable to unmarshal experiment result")
+	}
+
+	return r, nil
+}
+
+// GetRevision is always 0 for local experiments
+func (f *FileDriver) GetRevision() int {
+	return 0
+}
@@ -0,0 +1,109 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+
+	"fortio.org/fortio/fhttp"
+	"github.com/iter8-tools/iter8/base"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+func TestFileRun(t *testing.T) {
+	// create and configure HTTP endpoint for testing
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	url := fmt.Sprintf("http://127.0.0.1:%d/get", addr.Port)
+	var verifyHandlerCalled atomic.Bool
+	mux.HandleFunc("/get", base.GetTrackingHandler(&verifyHandlerCalled))
+
+	dir := t.TempDir()
+	_ = os.Chdir(dir)
+
+	// create experiment.yaml
+	base.CreateExperimentYaml(t, base.CompletePath("../testdata/drivertests", "experiment.tpl"), url, base.ExperimentFile)
+
+	fd := NewFileDriver(dir)
+	err := base.RunExperiment(context.Background(), false, fd)
+	assert.NoError(t, err)
+	// sanity check -- handler was called
+	assert.True(t, verifyHandlerCalled.Load())
+
+	// result.yaml was written next to experiment.yaml
+	b, err := os.ReadFile(path.Join(dir, ResultFile))
+	assert.NoError(t, err)
+	result := base.ExperimentResult{}
+	err = yaml.Unmarshal(b, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, myName, result.Name)
+	assert.Equal(t, myNamespace, result.Namespace)
+	assert.Equal(t, 1, result.NumCompletedTasks)
+	assert.False(t, result.Failure)
+	assert.NotNil(t, result.Insights)
+	assert.Contains(t, result.Insights.TaskData, base.CollectHTTPTaskName)
+}
+
+func TestFileResume(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.Chdir(dir)
+
+	// the first task fails if it is run
+	err := os.WriteFile(base.ExperimentFile, []byte(`
+metadata:
+  name: myName
+  namespace: myNamespace
+spec:
+- run: exit 1
+- run: echo hello
+`), 0600)
+	assert.NoError(t, err)
+
+	// result of a run that was interrupted after the first task
+	err = os.WriteFile(ResultFile, []byte(`
+name: myName
+namespace: myNamespace
+numCompletedTasks: 1
+insights:
+  numVersions: 1
+  taskData:
+    hello: world
+`), 0600)
+	assert.NoError(t, err)
+
+	fd := NewFileDriver(dir)
+	err = base.RunExperiment(context.Background(), false, fd)
+	assert.NoError(t, err)
+
+	result, err := fd.ReadResult(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.NumCompletedTasks)
+	assert.False(t, result.Failure)
+	assert.Equal(t, "world", result.Insights.TaskData["hello"])
+
+	// a fresh run executes the first task again
+	err = base.RunExperiment(context.Background(), true, fd)
+	assert.NoError(t, err)
+
+	result, err = fd.ReadResult(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.NumCompletedTasks)
+	assert.True(t, result.Failure)
+	assert.Nil(t, result.Insights)
+}
+
+func TestFileReadError(t *testing.T) {
+	fd := NewFileDriver(t.TempDir())
+	exp, err := fd.Read()
+	assert.Error(t, err)
+	assert.Nil(t, exp)
+	assert.Equal(t, 0, fd.GetRevision())
+
+	// no previous result
+	result, err := fd.ReadResult(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
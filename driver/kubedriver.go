@@ -27,6 +27,7 @@ import (
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -215,9 +216,84 @@ func (kd *KubeDriver) Write(exp *base.Experiment) error {
 		return fmt.Errorf(errorMessage)
 	}
 
+	// the result in the metrics service is redacted, so the result used to resume the experiment is kept in its secret
+	return kd.writeResultToSecret(exp.Result)
+}
+
+// writeResultToSecret writes the experiment result, as is, to the experiment secret
+func (kd *KubeDriver) writeResultToSecret(r *base.ExperimentResult) error {
+	b, err := yaml.Marshal(r)
+	if err != nil {
+		e := errors.New("unable to marshal experiment result")
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return e
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		s, err := kd.getExperimentSecret()
+		if err != nil {
+			return err
+		}
+		if s.Data == nil {
+			s.Data = map[string][]byte{}
+		}
+		s.Data[ResultFile] = b
+		_, err = kd.Clientset.CoreV1().Secrets(kd.Namespace()).Update(context.Background(), s, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		e := errors.New("unable to write experiment result to secret")
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return e
+	}
 	return nil
 }
 
+// readResultFromSecret reads the experiment result from the experiment secret, if it has been written
+func (kd *KubeDriver) readResultFromSecret() (*base.ExperimentResult, error) {
+	s, err := kd.getExperimentSecret()
+	if err != nil {
+		return nil, err
+	}
+	b, ok := s.Data[ResultFile]
+	if !ok {
+		return nil, nil
+	}
+	r := &base.ExperimentResult{}
+	if err = yaml.Unmarshal(b, r); err != nil {
+		e := errors.New("unable to unmarshal experiment result")
+		log.Logger.WithStackTrace(err.Error()).Error(e)
+		return nil, e
+	}
+	return r, nil
+}
+
+// ReadResult reads the experiment result from the experiment secret or, if it has not been written there, from the metrics service
+// The result in the metrics service is redacted, so the values of secrets in its outputs and task data are lost
+func (kd *KubeDriver) ReadResult(exp *base.Experiment) (*base.ExperimentResult, error) {
+	r, err := kd.readResultFromSecret()
+	if err != nil || r != nil {
+		return r, err
+	}
+
+	// get URL of metrics server from environment variable
+	metricsServerURL, ok := os.LookupEnv(base.MetricsServerURL)
+	if !ok {
+		errorMessage := "could not look up METRICS_SERVER_URL environment variable"
+		log.Logger.Error(errorMessage)
+		return nil, fmt.Errorf(errorMessage)
+	}
+
+	r, err = base.GetExperimentResultFromMetricsService(metricsServerURL, exp.Metadata.Namespace, exp.Metadata.Name)
+	if err != nil {
+		errorMessage := "could not read experiment result from metrics service"
+		log.Logger.Error(errorMessage)
+		return nil, fmt.Errorf(errorMessage)
+	}
+
+	return r, nil
+}
+
 // GetRevision gets the experiment revision
 func (kd *KubeDriver) GetRevision() int {
 	return kd.revision
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"testing"
 
 	"fortio.org/fortio/fhttp"
@@ -31,7 +32,7 @@ func TestKubeRun(t *testing.T) {
 	// create and configure HTTP endpoint for testing
 	mux, addr := fhttp.DynamicHTTPServer(false)
 	url := fmt.Sprintf("http://127.0.0.1:%d/get", addr.Port)
-	var verifyHandlerCalled bool
+	var verifyHandlerCalled atomic.Bool
 	mux.HandleFunc("/get", base.GetTrackingHandler(&verifyHandlerCalled))
 
 	// mock metrics server
@@ -79,9 +80,39 @@ func TestKubeRun(t *testing.T) {
 		StringData: map[string]string{base.ExperimentFile: string(byteArray)},
 	}, metav1.CreateOptions{})
 
-	err = base.RunExperiment(kd)
+	err = base.RunExperiment(context.Background(), false, kd)
 	assert.NoError(t, err)
 	// sanity check -- handler was called
-	assert.True(t, verifyHandlerCalled)
+	assert.True(t, verifyHandlerCalled.Load())
 	assert.True(t, metricsServerCalled)
+
+	// the result is also kept in the experiment secret, from which it is read to resume the experiment
+	r, err := kd.ReadResult(&base.Experiment{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, r.Revision)
+	assert.Equal(t, 1, r.NumCompletedTasks)
+}
+
+func TestKubeReadResultFromSecret(t *testing.T) {
+	// the result in the secret is not redacted, unlike the one in the metrics service
+	kd := NewFakeKubeDriver(cli.New())
+	_, err := kd.Clientset.CoreV1().Secrets("default").Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "default",
+			Namespace: "default",
+		},
+		StringData: map[string]string{ResultFile: `
+revision: 2
+numCompletedTasks: 1
+outputs:
+  login:
+    stdout: t0ken
+`},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	r, err := kd.ReadResult(&base.Experiment{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, r.Revision)
+	assert.Equal(t, "t0ken", r.Outputs["login"]["stdout"])
 }
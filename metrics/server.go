@@ -3,11 +3,13 @@ package metrics
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
 	"time"
 
@@ -20,7 +22,6 @@ import (
 	"github.com/montanaflynn/stats"
 	"gonum.org/v1/plot/plotter"
 
-	"fortio.org/fortio/fhttp"
 	fstats "fortio.org/fortio/stats"
 )
 
@@ -29,6 +30,7 @@ const (
 	MetricsConfigFileEnv = "METRICS_CONFIG_FILE"
 	defaultPortNumber    = 8080
 	timeFormat           = "02 Jan 06 15:04 MST"
+	taskTimeFormat       = "02 Jan 06 15:04:05 MST"
 )
 
 // versionSummarizedMetric adds version to summary data
@@ -86,6 +88,36 @@ type dashboardExperimentResult struct {
 
 	// Iter8Version is the version of Iter8 CLI that created this result object
 	Iter8Version string `json:"Iter8 version"`
+
+	// Tasks is the execution record of each task
+	Tasks []dashboardTaskResult `json:"Tasks,omitempty"`
+}
+
+// dashboardTaskResult is a capitalized version of TaskResult used to display data in Grafana
+type dashboardTaskResult struct {
+	// Index is the 1-based position of the task in the spec or finally list
+	Index int
+
+	// Name is the name of the task
+	Name string
+
+	// Finally is true if the task is in the finally list
+	Finally bool
+
+	// Status is one of succeeded, failed or skipped
+	Status string
+
+	// StartTime is the time when the task started
+	StartTime string `json:"Start time"`
+
+	// EndTime is the time when the task ended
+	EndTime string `json:"End time"`
+
+	// Duration is the time taken by the task
+	Duration string
+
+	// Error is the error message of a failed task
+	Error string
 }
 
 // httpEndpointRow is the data needed to produce a single row for an HTTP experiment in the Iter8 Grafana dashboard
@@ -97,12 +129,107 @@ type httpEndpointRow struct {
 	ErrorStatistics storage.SummarizedMetric `json:"Error statistics"`
 
 	ReturnCodes map[int]int64 `json:"Return codes"`
+
+	ResponseCheckFailures map[string]int64 `json:"Response check failures,omitempty"`
+}
+
+// versionRow is the data needed to compare an endpoint with the endpoints of other versions in the Iter8 Grafana dashboard
+type versionRow struct {
+	// Version is the version and track of the endpoint
+	Version string
+
+	// Endpoint is the name of the endpoint
+	Endpoint string
+
+	Count      uint64
+	ErrorCount float64 `json:"Error count"`
+	ErrorRate  float64 `json:"Error rate"`
+
+	// latencies are in milliseconds
+	Mean float64 `json:"Mean latency"`
+	Min  float64 `json:"Min latency"`
+	Max  float64 `json:"Max latency"`
+}
+
+// versionPercentile is a latency percentile of an endpoint, used to compare versions side by side in the Iter8 Grafana dashboard
+type versionPercentile struct {
+	// Version labels the endpoint with its version and track, and also with its name if the version has other endpoints
+	Version string
+
+	// Percentile is the percentile (example, p99)
+	Percentile string
+
+	// Value is the latency in milliseconds
+	Value float64
+}
+
+// failedEndpoint is an endpoint that could not be tested, shown in the Iter8 Grafana dashboard
+type failedEndpoint struct {
+	// Version is the version and track of the endpoint
+	Version string
+
+	// Endpoint is the name of the endpoint
+	Endpoint string
+
+	// Error is the error of the load generator
+	Error string
+}
+
+// stageRow is the data needed to show a stage of the load profile of an endpoint in the Iter8 Grafana dashboard
+type stageRow struct {
+	// Endpoint is the name of the endpoint
+	Endpoint string
+
+	// Stage is the name of the stage
+	Stage string
+
+	RequestedQPS string  `json:"Requested QPS"`
+	ActualQPS    float64 `json:"Actual QPS"`
+	Count        uint64
+	ErrorCount   float64 `json:"Error count"`
+	ErrorRate    float64 `json:"Error rate"`
+
+	// latencies are in milliseconds
+	Mean float64 `json:"Mean latency"`
+	P50  float64 `json:"p50 latency"`
+	P90  float64 `json:"p90 latency"`
+	P99  float64 `json:"p99 latency"`
+}
+
+// responseCheckRow is the number of responses of an endpoint that failed a response check, shown in the Iter8 Grafana dashboard
+type responseCheckRow struct {
+	// Version is the version and track of the endpoint
+	Version string
+
+	// Endpoint is the name of the endpoint
+	Endpoint string
+
+	// Check is the name of the response check
+	Check string
+
+	Failures    int64
+	FailureRate float64 `json:"Failure rate"`
 }
 
 type httpDashboard struct {
 	// key is the endpoint
 	Endpoints map[string]httpEndpointRow
 
+	// Versions compares the endpoints of each version side by side
+	Versions []versionRow
+
+	// Percentiles compares the latency percentiles of the endpoints of each version side by side
+	Percentiles []versionPercentile
+
+	// Stages are the stages of the load profiles of endpoints, in order
+	Stages []stageRow
+
+	// ResponseChecks are the numbers of responses that failed each response check of the endpoints
+	ResponseChecks []responseCheckRow
+
+	// FailedEndpoints are the endpoints that could not be tested
+	FailedEndpoints []failedEndpoint
+
 	ExperimentResult dashboardExperimentResult
 }
 
@@ -122,6 +249,15 @@ type ghzDashboard struct {
 	// key is the endpoint
 	Endpoints map[string]ghzEndpointRow
 
+	// Versions compares the endpoints of each version side by side
+	Versions []versionRow
+
+	// Percentiles compares the latency percentiles of the endpoints of each version side by side
+	Percentiles []versionPercentile
+
+	// FailedEndpoints are the endpoints that could not be tested
+	FailedEndpoints []failedEndpoint
+
 	ExperimentResult dashboardExperimentResult
 }
 
@@ -148,7 +284,7 @@ func Start(stopCh <-chan struct{}) error {
 	}
 
 	// configure endpoints
-	http.HandleFunc(util.TestResultPath, putExperimentResult)
+	http.HandleFunc(util.TestResultPath, handleExperimentResult)
 	http.HandleFunc(util.AbnDashboard, getAbnDashboard)
 	http.HandleFunc(util.HTTPDashboardPath, getHTTPDashboard)
 	http.HandleFunc(util.GRPCDashboardPath, getGRPCDashboard)
@@ -478,8 +614,12 @@ func getHTTPStatistics(fortioHistogram *fstats.HistogramData, _ float64) storage
 	}
 }
 
-func getHTTPEndpointRow(httpRunnerResults *fhttp.HTTPRunnerResults) httpEndpointRow {
+func getHTTPEndpointRow(httpResult *util.HTTPEndpointResult) httpEndpointRow {
 	row := httpEndpointRow{}
+	httpRunnerResults := httpResult.HTTPRunnerResults
+	if httpRunnerResults == nil {
+		return row
+	}
 	if httpRunnerResults.DurationHistogram != nil {
 		row.Durations = getHTTPHistogram(httpRunnerResults.DurationHistogram.Data, 1)
 		row.Statistics = getHTTPStatistics(httpRunnerResults.DurationHistogram, 1)
@@ -491,22 +631,230 @@ func getHTTPEndpointRow(httpRunnerResults *fhttp.HTTPRunnerResults) httpEndpoint
 	}
 
 	row.ReturnCodes = httpRunnerResults.RetCodes
+	row.ResponseCheckFailures = httpResult.ResponseCheckFailures
 
 	return row
 }
 
+// getDashboardExperimentResult converts an experiment result into the form displayed in Grafana
+func getDashboardExperimentResult(experimentResult *util.ExperimentResult) dashboardExperimentResult {
+	result := dashboardExperimentResult{
+		Name:              experimentResult.Name,
+		Namespace:         experimentResult.Namespace,
+		Revision:          experimentResult.Revision,
+		StartTime:         experimentResult.StartTime.Time.Format(timeFormat),
+		NumCompletedTasks: experimentResult.NumCompletedTasks,
+		Failure:           experimentResult.Failure,
+		Iter8Version:      experimentResult.Iter8Version,
+	}
+
+	for _, tr := range experimentResult.TaskResults {
+		result.Tasks = append(result.Tasks, dashboardTaskResult{
+			Index:     tr.Index,
+			Name:      tr.Name,
+			Finally:   tr.Finally,
+			Status:    tr.Status,
+			StartTime: tr.StartTime.Time.Format(taskTimeFormat),
+			EndTime:   tr.EndTime.Time.Format(taskTimeFormat),
+			Duration:  tr.Duration,
+			Error:     tr.Error,
+		})
+	}
+
+	return result
+}
+
+// sortEndpointsByVersion sorts the endpoints tested by a task by the index of their version, and then by name
+func sortEndpointsByVersion(in *util.Insights, task string, endpoints []string) {
+	sort.Slice(endpoints, func(i, j int) bool {
+		vi, _ := in.EndpointVersion(task, endpoints[i])
+		vj, _ := in.EndpointVersion(task, endpoints[j])
+		if vi != vj {
+			return vi < vj
+		}
+		return endpoints[i] < endpoints[j]
+	})
+}
+
+// getVersionLabels labels the endpoints tested by a task with their version and track
+// Endpoints are also labelled with their name if their version has other endpoints
+func getVersionLabels(in *util.Insights, task string, endpoints []string) map[string]string {
+	numEndpoints := map[string]int{}
+	for _, endpoint := range endpoints {
+		numEndpoints[in.EndpointVersionStr(task, endpoint)]++
+	}
+	labels := map[string]string{}
+	for _, endpoint := range endpoints {
+		label := in.EndpointVersionStr(task, endpoint)
+		if numEndpoints[label] > 1 {
+			label += ": " + endpoint
+		}
+		labels[endpoint] = label
+	}
+	return labels
+}
+
+// getHTTPVersionComparison compares the endpoints of each version of an HTTP experiment side by side
+func getHTTPVersionComparison(in *util.Insights, httpResult util.HTTPResult) ([]versionRow, []versionPercentile) {
+	endpoints := []string{}
+	for endpoint := range httpResult {
+		endpoints = append(endpoints, endpoint)
+	}
+	sortEndpointsByVersion(in, util.CollectHTTPTaskName, endpoints)
+	labels := getVersionLabels(in, util.CollectHTTPTaskName, endpoints)
+
+	rows := []versionRow{}
+	percentiles := []versionPercentile{}
+	for _, endpoint := range endpoints {
+		if httpResult[endpoint] == nil {
+			continue
+		}
+		r := httpResult[endpoint].HTTPRunnerResults
+		if r == nil || r.DurationHistogram == nil {
+			continue
+		}
+		row := versionRow{
+			Version:  in.EndpointVersionStr(util.CollectHTTPTaskName, endpoint),
+			Endpoint: endpoint,
+			Count:    uint64(r.DurationHistogram.Count),
+			Mean:     r.DurationHistogram.Avg * 1000,
+			Min:      r.DurationHistogram.Min * 1000,
+			Max:      r.DurationHistogram.Max * 1000,
+		}
+		if r.ErrorsDurationHistogram != nil {
+			row.ErrorCount = float64(r.ErrorsDurationHistogram.Count)
+		}
+		if row.Count > 0 {
+			row.ErrorRate = row.ErrorCount / float64(row.Count)
+		}
+		rows = append(rows, row)
+
+		for _, p := range r.DurationHistogram.Percentiles {
+			percentiles = append(percentiles, versionPercentile{
+				Version:    labels[endpoint],
+				Percentile: "p" + strconv.FormatFloat(p.Percentile, 'f', -1, 64),
+				Value:      p.Value * 1000,
+			})
+		}
+	}
+	return rows, percentiles
+}
+
+// getResponseCheckFailures returns the number of responses of each endpoint of an HTTP experiment that failed each response check
+func getResponseCheckFailures(in *util.Insights, httpResult util.HTTPResult) []responseCheckRow {
+	endpoints := []string{}
+	for endpoint, r := range httpResult {
+		if r != nil && len(r.ResponseCheckFailures) > 0 {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	sortEndpointsByVersion(in, util.CollectHTTPTaskName, endpoints)
+
+	rows := []responseCheckRow{}
+	for _, endpoint := range endpoints {
+		r := httpResult[endpoint]
+		checks := []string{}
+		for check := range r.ResponseCheckFailures {
+			checks = append(checks, check)
+		}
+		sort.Strings(checks)
+		for _, check := range checks {
+			row := responseCheckRow{
+				Version:  in.EndpointVersionStr(util.CollectHTTPTaskName, endpoint),
+				Endpoint: endpoint,
+				Check:    check,
+				Failures: r.ResponseCheckFailures[check],
+			}
+			if r.HTTPRunnerResults != nil && r.DurationHistogram != nil && r.DurationHistogram.Count > 0 {
+				row.FailureRate = float64(row.Failures) / float64(r.DurationHistogram.Count)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// getFailedEndpoints returns the endpoints that a task could not test, together with their errors
+func getFailedEndpoints(in *util.Insights, task string) []failedEndpoint {
+	failed := []failedEndpoint{}
+	if in == nil {
+		return failed
+	}
+	endpoints := []string{}
+	for endpoint := range in.EndpointErrors[task] {
+		endpoints = append(endpoints, endpoint)
+	}
+	sortEndpointsByVersion(in, task, endpoints)
+	for _, endpoint := range endpoints {
+		failed = append(failed, failedEndpoint{
+			Version:  in.EndpointVersionStr(task, endpoint),
+			Endpoint: endpoint,
+			Error:    in.EndpointErrors[task][endpoint],
+		})
+	}
+	return failed
+}
+
+// getHTTPStages returns the stages of the load profiles of the endpoints of an HTTP experiment
+func getHTTPStages(in *util.Insights) []stageRow {
+	rows := []stageRow{}
+	if in == nil || in.StageData[util.CollectHTTPTaskName] == nil {
+		return rows
+	}
+
+	stageDataBytes, err := json.Marshal(in.StageData[util.CollectHTTPTaskName])
+	if err != nil {
+		log.Logger.Error("cannot marshal http stage data")
+		return rows
+	}
+	stageResult := util.HTTPStageResult{}
+	if err = json.Unmarshal(stageDataBytes, &stageResult); err != nil {
+		log.Logger.Error("cannot unmarshal http stage data into HTTPStageResult")
+		return rows
+	}
+
+	endpoints := []string{}
+	for endpoint := range stageResult {
+		endpoints = append(endpoints, endpoint)
+	}
+	sortEndpointsByVersion(in, util.CollectHTTPTaskName, endpoints)
+	for _, endpoint := range endpoints {
+		for _, r := range stageResult[endpoint] {
+			if r == nil || r.DurationHistogram == nil {
+				continue
+			}
+			row := stageRow{
+				Endpoint:     endpoint,
+				Stage:        r.Labels,
+				RequestedQPS: r.RequestedQPS,
+				ActualQPS:    r.ActualQPS,
+				Count:        uint64(r.DurationHistogram.Count),
+				Mean:         r.DurationHistogram.Avg * 1000,
+			}
+			if r.ErrorsDurationHistogram != nil {
+				row.ErrorCount = float64(r.ErrorsDurationHistogram.Count)
+			}
+			if row.Count > 0 {
+				row.ErrorRate = row.ErrorCount / float64(row.Count)
+				row.P50 = r.DurationHistogram.CalcPercentile(50) * 1000
+				row.P90 = r.DurationHistogram.CalcPercentile(90) * 1000
+				row.P99 = r.DurationHistogram.CalcPercentile(99) * 1000
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
 func getHTTPDashboardHelper(experimentResult *util.ExperimentResult) httpDashboard {
 	dashboard := httpDashboard{
-		Endpoints: map[string]httpEndpointRow{},
-		ExperimentResult: dashboardExperimentResult{
-			Name:              experimentResult.Name,
-			Namespace:         experimentResult.Namespace,
-			Revision:          experimentResult.Revision,
-			StartTime:         experimentResult.StartTime.Time.Format(timeFormat),
-			NumCompletedTasks: experimentResult.NumCompletedTasks,
-			Failure:           experimentResult.Failure,
-			Iter8Version:      experimentResult.Iter8Version,
-		},
+		Endpoints:        map[string]httpEndpointRow{},
+		Versions:         []versionRow{},
+		Percentiles:      []versionPercentile{},
+		Stages:           getHTTPStages(experimentResult.Insights),
+		ResponseChecks:   []responseCheckRow{},
+		FailedEndpoints:  getFailedEndpoints(experimentResult.Insights, util.CollectHTTPTaskName),
+		ExperimentResult: getDashboardExperimentResult(experimentResult),
 	}
 
 	// get raw data from ExperimentResult
@@ -534,6 +882,8 @@ func getHTTPDashboardHelper(experimentResult *util.ExperimentResult) httpDashboa
 		endpointResult := endpointResult
 		dashboard.Endpoints[endpoint] = getHTTPEndpointRow(endpointResult)
 	}
+	dashboard.Versions, dashboard.Percentiles = getHTTPVersionComparison(experimentResult.Insights, httpResult)
+	dashboard.ResponseChecks = getResponseCheckFailures(experimentResult.Insights, httpResult)
 
 	return dashboard
 }
@@ -633,18 +983,55 @@ func getGRPCEndpointRow(ghzRunnerReport *runner.Report) ghzEndpointRow {
 	return row
 }
 
+// getGRPCVersionComparison compares the endpoints of each version of a gRPC experiment side by side
+func getGRPCVersionComparison(in *util.Insights, ghzResult util.GHZResult) ([]versionRow, []versionPercentile) {
+	endpoints := []string{}
+	for endpoint := range ghzResult {
+		endpoints = append(endpoints, endpoint)
+	}
+	sortEndpointsByVersion(in, util.CollectGRPCTaskName, endpoints)
+	labels := getVersionLabels(in, util.CollectGRPCTaskName, endpoints)
+
+	rows := []versionRow{}
+	percentiles := []versionPercentile{}
+	for _, endpoint := range endpoints {
+		r := ghzResult[endpoint]
+		if r == nil {
+			continue
+		}
+		statistics := getGRPCStatistics(r)
+		row := versionRow{
+			Version:    in.EndpointVersionStr(util.CollectGRPCTaskName, endpoint),
+			Endpoint:   endpoint,
+			Count:      statistics.Count,
+			ErrorCount: statistics.ErrorCount,
+			Mean:       float64(r.Average) / float64(time.Millisecond),
+			Min:        float64(r.Fastest) / float64(time.Millisecond),
+			Max:        float64(r.Slowest) / float64(time.Millisecond),
+		}
+		if row.Count > 0 {
+			row.ErrorRate = row.ErrorCount / float64(row.Count)
+		}
+		rows = append(rows, row)
+
+		for _, ld := range r.LatencyDistribution {
+			percentiles = append(percentiles, versionPercentile{
+				Version:    labels[endpoint],
+				Percentile: "p" + strconv.Itoa(ld.Percentage),
+				Value:      float64(ld.Latency) / float64(time.Millisecond),
+			})
+		}
+	}
+	return rows, percentiles
+}
+
 func getGRPCDashboardHelper(experimentResult *util.ExperimentResult) ghzDashboard {
 	dashboard := ghzDashboard{
-		Endpoints: map[string]ghzEndpointRow{},
-		ExperimentResult: dashboardExperimentResult{
-			Name:              experimentResult.Name,
-			Namespace:         experimentResult.Namespace,
-			Revision:          experimentResult.Revision,
-			StartTime:         experimentResult.StartTime.Time.Format(timeFormat),
-			NumCompletedTasks: experimentResult.NumCompletedTasks,
-			Failure:           experimentResult.Failure,
-			Iter8Version:      experimentResult.Iter8Version,
-		},
+		Endpoints:        map[string]ghzEndpointRow{},
+		Versions:         []versionRow{},
+		Percentiles:      []versionPercentile{},
+		FailedEndpoints:  getFailedEndpoints(experimentResult.Insights, util.CollectGRPCTaskName),
+		ExperimentResult: getDashboardExperimentResult(experimentResult),
 	}
 
 	// get raw data from ExperimentResult
@@ -671,6 +1058,7 @@ func getGRPCDashboardHelper(experimentResult *util.ExperimentResult) ghzDashboar
 		endpointResult := endpointResult
 		dashboard.Endpoints[endpoint] = getGRPCEndpointRow(endpointResult)
 	}
+	dashboard.Versions, dashboard.Percentiles = getGRPCVersionComparison(experimentResult.Insights, ghzResult)
 
 	return dashboard
 }
@@ -730,6 +1118,70 @@ func getGRPCDashboard(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(dashboardBytes)
 }
 
+// handleExperimentResult dispatches requests to /testResult based on the HTTP method
+func handleExperimentResult(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		getExperimentResult(w, r)
+		return
+	}
+	putExperimentResult(w, r)
+}
+
+// getExperimentResult handles GET /testResult with query parameter test=name and namespace=namespace
+func getExperimentResult(w http.ResponseWriter, r *http.Request) {
+	log.Logger.Trace("getExperimentResult called")
+	defer log.Logger.Trace("getExperimentResult completed")
+
+	// verify request (query parameters)
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		http.Error(w, "no namespace specified", http.StatusBadRequest)
+		return
+	}
+
+	test := r.URL.Query().Get("test")
+	if test == "" {
+		http.Error(w, "no test specified", http.StatusBadRequest)
+		return
+	}
+
+	log.Logger.Tracef("getExperimentResult called for namespace %s and test %s", namespace, test)
+
+	if storageclient.MetricsClient == nil {
+		http.Error(w, "no metrics client", http.StatusInternalServerError)
+		return
+	}
+
+	// get testResult from metrics client
+	testResult, err := storageclient.MetricsClient.GetExperimentResult(namespace, test)
+	if errors.Is(err, storage.ErrNotFound) {
+		errorMessage := fmt.Sprintf("cannot get experiment result with namespace %s, test %s", namespace, test)
+		log.Logger.Debug(errorMessage)
+		http.Error(w, errorMessage, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		// callers resume from the result, so failures other than a missing result must not look like one
+		errorMessage := fmt.Sprintf("cannot get experiment result with namespace %s, test %s", namespace, test)
+		log.Logger.WithStackTrace(err.Error()).Error(errorMessage)
+		http.Error(w, errorMessage, http.StatusInternalServerError)
+		return
+	}
+
+	// JSON marshal the result
+	testResultBytes, err := json.Marshal(testResult)
+	if err != nil {
+		errorMessage := "cannot JSON marshal experiment result"
+		log.Logger.Error(errorMessage)
+		http.Error(w, errorMessage, http.StatusInternalServerError)
+		return
+	}
+
+	// finally, send response
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(testResultBytes)
+}
+
 // putExperimentResult handles PUT /testResult with query parameter test=name and namespace=namespace
 func putExperimentResult(w http.ResponseWriter, r *http.Request) {
 	log.Logger.Trace("putExperimentResult called")
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -19,9 +20,11 @@ import (
 	"github.com/dgraph-io/badger/v4"
 	util "github.com/iter8-tools/iter8/base"
 	"github.com/iter8-tools/iter8/controllers"
+	"github.com/iter8-tools/iter8/storage"
 	"github.com/iter8-tools/iter8/storage/badgerdb"
 	storageclient "github.com/iter8-tools/iter8/storage/client"
 	"github.com/stretchr/testify/assert"
+	helmtime "helm.sh/helm/v3/pkg/time"
 )
 
 const (
@@ -315,7 +318,7 @@ const fortioResultJSON = `{
 	}
 }`
 
-const fortioDashboardJSON = `{"Endpoints":{"http://httpbin.default/get":{"Durations":[{"Version":"0","Bucket":"4.2 - 5","Value":5},{"Version":"0","Bucket":"5 - 6","Value":5},{"Version":"0","Bucket":"6 - 7","Value":4},{"Version":"0","Bucket":"7 - 8","Value":5},{"Version":"0","Bucket":"8 - 9","Value":5},{"Version":"0","Bucket":"9 - 10","Value":4},{"Version":"0","Bucket":"10 - 11","Value":5},{"Version":"0","Bucket":"11 - 12","Value":3},{"Version":"0","Bucket":"12 - 14","Value":12},{"Version":"0","Bucket":"14 - 16","Value":7},{"Version":"0","Bucket":"16 - 18","Value":10},{"Version":"0","Bucket":"18 - 20","Value":9},{"Version":"0","Bucket":"20 - 25","Value":11},{"Version":"0","Bucket":"25 - 30","Value":8},{"Version":"0","Bucket":"30 - 35","Value":5},{"Version":"0","Bucket":"35 - 40","Value":1},{"Version":"0","Bucket":"40 - 40.4","Value":1}],"Statistics":{"Count":100,"Mean":15.977100850000001,"StdDev":8.340658047253257,"Min":4.2238750000000005,"Max":40.490041999999995},"Error durations":[],"Error statistics":{"Count":0,"Mean":0,"StdDev":0,"Min":0,"Max":0},"Return codes":{"200":100}}},"ExperimentResult":{"Name":"my-name","Namespace":"my-namespace","Revision":0,"Start time":"01 Jan 01 00:00 UTC","Completed tasks":5,"Failure":false,"Insights":null,"Iter8 version":""}}`
+const fortioDashboardJSON = `{"Endpoints":{"http://httpbin.default/get":{"Durations":[{"Version":"0","Bucket":"4.2 - 5","Value":5},{"Version":"0","Bucket":"5 - 6","Value":5},{"Version":"0","Bucket":"6 - 7","Value":4},{"Version":"0","Bucket":"7 - 8","Value":5},{"Version":"0","Bucket":"8 - 9","Value":5},{"Version":"0","Bucket":"9 - 10","Value":4},{"Version":"0","Bucket":"10 - 11","Value":5},{"Version":"0","Bucket":"11 - 12","Value":3},{"Version":"0","Bucket":"12 - 14","Value":12},{"Version":"0","Bucket":"14 - 16","Value":7},{"Version":"0","Bucket":"16 - 18","Value":10},{"Version":"0","Bucket":"18 - 20","Value":9},{"Version":"0","Bucket":"20 - 25","Value":11},{"Version":"0","Bucket":"25 - 30","Value":8},{"Version":"0","Bucket":"30 - 35","Value":5},{"Version":"0","Bucket":"35 - 40","Value":1},{"Version":"0","Bucket":"40 - 40.4","Value":1}],"Statistics":{"Count":100,"Mean":15.977100850000001,"StdDev":8.340658047253257,"Min":4.2238750000000005,"Max":40.490041999999995},"Error durations":[],"Error statistics":{"Count":0,"Mean":0,"StdDev":0,"Min":0,"Max":0},"Return codes":{"200":100}}},"Versions":[{"Version":"version 0","Endpoint":"http://httpbin.default/get","Count":100,"Error count":0,"Error rate":0,"Mean latency":15.977100850000001,"Min latency":4.2238750000000005,"Max latency":40.490041999999995}],"Percentiles":[{"Version":"version 0","Percentile":"p50","Value":14.571428571428571},{"Version":"version 0","Percentile":"p75","Value":20.454545454545453},{"Version":"version 0","Percentile":"p90","Value":28.125},{"Version":"version 0","Percentile":"p95","Value":32},{"Version":"version 0","Percentile":"p99","Value":40},{"Version":"version 0","Percentile":"p99.9","Value":40.441037800000004}],"Stages":[],"ResponseChecks":[],"FailedEndpoints":[],"ExperimentResult":{"Name":"my-name","Namespace":"my-namespace","Revision":0,"Start time":"01 Jan 01 00:00 UTC","Completed tasks":5,"Failure":false,"Insights":null,"Iter8 version":""}}`
 
 const ghzResultJSON = `{
 	"routeguide.RouteGuide.GetFeature": {
@@ -506,7 +509,7 @@ const ghzResultJSON = `{
 	}
 }`
 
-const ghzDashboardJSON = `{"Endpoints":{"routeguide.RouteGuide.GetFeature":{"Durations":[{"Version":"0","Bucket":"0.032","Value":1},{"Version":"0","Bucket":"19.603","Value":167},{"Version":"0","Bucket":"39.174","Value":0},{"Version":"0","Bucket":"58.744","Value":0},{"Version":"0","Bucket":"78.315","Value":0},{"Version":"0","Bucket":"97.886","Value":3},{"Version":"0","Bucket":"117.457","Value":13},{"Version":"0","Bucket":"137.028","Value":0},{"Version":"0","Bucket":"156.599","Value":0},{"Version":"0","Bucket":"176.17","Value":0},{"Version":"0","Bucket":"195.74","Value":16}],"Statistics":{"Count":200,"ErrorCount":200},"Status codes":{"Unavailable":200}}},"ExperimentResult":{"Name":"my-name","Namespace":"my-namespace","Revision":0,"Start time":"01 Jan 01 00:00 UTC","Completed tasks":5,"Failure":false,"Insights":null,"Iter8 version":""}}`
+const ghzDashboardJSON = `{"Endpoints":{"routeguide.RouteGuide.GetFeature":{"Durations":[{"Version":"0","Bucket":"0.032","Value":1},{"Version":"0","Bucket":"19.603","Value":167},{"Version":"0","Bucket":"39.174","Value":0},{"Version":"0","Bucket":"58.744","Value":0},{"Version":"0","Bucket":"78.315","Value":0},{"Version":"0","Bucket":"97.886","Value":3},{"Version":"0","Bucket":"117.457","Value":13},{"Version":"0","Bucket":"137.028","Value":0},{"Version":"0","Bucket":"156.599","Value":0},{"Version":"0","Bucket":"176.17","Value":0},{"Version":"0","Bucket":"195.74","Value":16}],"Statistics":{"Count":200,"ErrorCount":200},"Status codes":{"Unavailable":200}}},"Versions":[{"Version":"version 0","Endpoint":"routeguide.RouteGuide.GetFeature","Count":200,"Error count":200,"Error rate":1,"Mean latency":25.208185,"Min latency":0.032375,"Max latency":195.740917}],"Percentiles":[{"Version":"version 0","Percentile":"p10","Value":0.035584},{"Version":"version 0","Percentile":"p25","Value":0.039958},{"Version":"version 0","Percentile":"p50","Value":0.086208},{"Version":"version 0","Percentile":"p75","Value":12.777625},{"Version":"version 0","Percentile":"p90","Value":106.714334},{"Version":"version 0","Percentile":"p95","Value":189.847},{"Version":"version 0","Percentile":"p99","Value":195.400792}],"FailedEndpoints":[],"ExperimentResult":{"Name":"my-name","Namespace":"my-namespace","Revision":0,"Start time":"01 Jan 01 00:00 UTC","Completed tasks":5,"Failure":false,"Insights":null,"Iter8 version":""}}`
 
 func TestStart(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
@@ -889,6 +892,188 @@ func TestGetGRPCDashboardHelper(t *testing.T) {
 	)
 }
 
+func TestGetHTTPVersionComparison(t *testing.T) {
+	fortioResult := util.HTTPResult{}
+	err := json.Unmarshal([]byte(fortioResultJSON), &fortioResult)
+	assert.NoError(t, err)
+	r := fortioResult["http://httpbin.default/get"]
+
+	httpResult := util.HTTPResult{"stable": r, "candidate-a": r, "candidate-b": r}
+	in := &util.Insights{
+		NumVersions:  2,
+		VersionNames: []util.VersionInfo{{Track: "stable", Version: "v1"}, {Track: "candidate", Version: "v2"}},
+		EndpointVersions: map[string]map[string]int{
+			util.CollectHTTPTaskName: {"stable": 0, "candidate-a": 1, "candidate-b": 1},
+		},
+	}
+
+	rows, percentiles := getHTTPVersionComparison(in, httpResult)
+	versions := []string{}
+	endpoints := []string{}
+	for _, row := range rows {
+		versions = append(versions, row.Version)
+		endpoints = append(endpoints, row.Endpoint)
+		assert.Equal(t, uint64(100), row.Count)
+	}
+	assert.Equal(t, []string{"stable (v1)", "candidate (v2)", "candidate (v2)"}, versions)
+	assert.Equal(t, []string{"stable", "candidate-a", "candidate-b"}, endpoints)
+
+	// series are labelled with the endpoint only if the version has several endpoints
+	assert.Equal(t, 18, len(percentiles))
+	assert.Equal(t, versionPercentile{Version: "stable (v1)", Percentile: "p50", Value: 14.571428571428571}, percentiles[0])
+	assert.Equal(t, "candidate (v2): candidate-a", percentiles[6].Version)
+	assert.Equal(t, "candidate (v2): candidate-b", percentiles[12].Version)
+}
+
+func TestGetHTTPStages(t *testing.T) {
+	fortioResult := util.HTTPResult{}
+	err := json.Unmarshal([]byte(fortioResultJSON), &fortioResult)
+	assert.NoError(t, err)
+	r := fortioResult["http://httpbin.default/get"]
+
+	rampUp, steady := *r.HTTPRunnerResults, *r.HTTPRunnerResults
+	rampUp.Labels, steady.Labels = "ramp-up", "steady"
+	in := &util.Insights{
+		StageData: map[string]interface{}{
+			util.CollectHTTPTaskName: util.HTTPStageResult{"http://httpbin.default/get": {&rampUp, &steady}},
+		},
+	}
+
+	rows := getHTTPStages(in)
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, "ramp-up", rows[0].Stage)
+	assert.Equal(t, "steady", rows[1].Stage)
+	assert.Equal(t, "http://httpbin.default/get", rows[1].Endpoint)
+	assert.Equal(t, uint64(100), rows[1].Count)
+	assert.Equal(t, r.DurationHistogram.CalcPercentile(99)*1000, rows[1].P99)
+
+	assert.Equal(t, []stageRow{}, getHTTPStages(&util.Insights{}))
+}
+
+func TestGetResponseCheckFailures(t *testing.T) {
+	fortioResult := util.HTTPResult{}
+	err := json.Unmarshal([]byte(fortioResultJSON), &fortioResult)
+	assert.NoError(t, err)
+	r := fortioResult["http://httpbin.default/get"]
+
+	in := &util.Insights{
+		NumVersions:  2,
+		VersionNames: []util.VersionInfo{{Track: "stable"}, {Track: "candidate"}},
+		EndpointVersions: map[string]map[string]int{
+			util.CollectHTTPTaskName: {"a": 1, "b": 0},
+		},
+	}
+	httpResult := util.HTTPResult{
+		"a": &util.HTTPEndpointResult{HTTPRunnerResults: r.HTTPRunnerResults, ResponseCheckFailures: map[string]int64{"jsonSchema": 5, "bodyRegex": 10}},
+		"b": r,
+	}
+
+	assert.Equal(t, []responseCheckRow{
+		{Version: "candidate", Endpoint: "a", Check: "bodyRegex", Failures: 10, FailureRate: 0.1},
+		{Version: "candidate", Endpoint: "a", Check: "jsonSchema", Failures: 5, FailureRate: 0.05},
+	}, getResponseCheckFailures(in, httpResult))
+	assert.Equal(t, uint64(100), getHTTPEndpointRow(httpResult["a"]).Statistics.Count)
+	assert.Equal(t, map[string]int64{"jsonSchema": 5, "bodyRegex": 10}, getHTTPEndpointRow(httpResult["a"]).ResponseCheckFailures)
+	assert.Equal(t, []responseCheckRow{}, getResponseCheckFailures(in, util.HTTPResult{"b": r}))
+}
+
+func TestGetFailedEndpoints(t *testing.T) {
+	in := &util.Insights{
+		NumVersions:  2,
+		VersionNames: []util.VersionInfo{{Track: "stable", Version: "v1"}, {Track: "candidate", Version: "v2"}},
+		EndpointVersions: map[string]map[string]int{
+			util.CollectHTTPTaskName: {"stable": 0, "candidate-a": 1, "candidate-b": 1},
+		},
+		EndpointErrors: map[string]map[string]string{
+			util.CollectHTTPTaskName: {"candidate-b": "connection refused", "stable": "timeout"},
+		},
+	}
+
+	assert.Equal(t, []failedEndpoint{
+		{Version: "stable (v1)", Endpoint: "stable", Error: "timeout"},
+		{Version: "candidate (v2)", Endpoint: "candidate-b", Error: "connection refused"},
+	}, getFailedEndpoints(in, util.CollectHTTPTaskName))
+	assert.Equal(t, []failedEndpoint{}, getFailedEndpoints(in, util.CollectGRPCTaskName))
+	assert.Equal(t, []failedEndpoint{}, getFailedEndpoints(nil, util.CollectGRPCTaskName))
+}
+
+func TestGetGRPCVersionComparison(t *testing.T) {
+	ghzResult := util.GHZResult{}
+	err := json.Unmarshal([]byte(ghzResultJSON), &ghzResult)
+	assert.NoError(t, err)
+	r := ghzResult["routeguide.RouteGuide.GetFeature"]
+
+	in := &util.Insights{
+		NumVersions:  2,
+		VersionNames: []util.VersionInfo{{Track: "stable"}, {Track: "candidate"}},
+		EndpointVersions: map[string]map[string]int{
+			util.CollectGRPCTaskName: {"a": 1, "b": 0},
+		},
+	}
+
+	rows, percentiles := getGRPCVersionComparison(in, util.GHZResult{"a": r, "b": r})
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, versionRow{
+		Version:    "stable",
+		Endpoint:   "b",
+		Count:      200,
+		ErrorCount: 200,
+		ErrorRate:  1,
+		Mean:       25.208185,
+		Min:        0.032375,
+		Max:        195.740917,
+	}, rows[0])
+	assert.Equal(t, "candidate", rows[1].Version)
+	assert.Equal(t, 14, len(percentiles))
+	assert.Equal(t, versionPercentile{Version: "candidate", Percentile: "p10", Value: 0.035584}, percentiles[7])
+}
+
+func TestGetDashboardExperimentResult(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	experimentResult := util.ExperimentResult{
+		Name:              myName,
+		Namespace:         myNamespace,
+		NumCompletedTasks: 2,
+		Failure:           true,
+		TaskResults: []util.TaskResult{{
+			Name:      util.ReadinessTaskName,
+			Index:     1,
+			Status:    util.TaskSucceeded,
+			StartTime: helmtime.Time{Time: start},
+			EndTime:   helmtime.Time{Time: start.Add(2 * time.Second)},
+			Duration:  "2s",
+		}, {
+			Name:      util.CollectHTTPTaskName,
+			Index:     2,
+			Status:    util.TaskFailed,
+			StartTime: helmtime.Time{Time: start.Add(2 * time.Second)},
+			EndTime:   helmtime.Time{Time: start.Add(3 * time.Second)},
+			Duration:  "1s",
+			Error:     "oops",
+		}},
+	}
+
+	result := getDashboardExperimentResult(&experimentResult)
+	assert.Equal(t, myName, result.Name)
+	assert.True(t, result.Failure)
+	assert.Equal(t, []dashboardTaskResult{{
+		Index:     1,
+		Name:      util.ReadinessTaskName,
+		Status:    util.TaskSucceeded,
+		StartTime: "02 Jan 24 03:04:05 UTC",
+		EndTime:   "02 Jan 24 03:04:07 UTC",
+		Duration:  "2s",
+	}, {
+		Index:     2,
+		Name:      util.CollectHTTPTaskName,
+		Status:    util.TaskFailed,
+		StartTime: "02 Jan 24 03:04:07 UTC",
+		EndTime:   "02 Jan 24 03:04:08 UTC",
+		Duration:  "1s",
+		Error:     "oops",
+	}}, result.Tasks)
+}
+
 func TestPutExperimentResultInvalidMethod(t *testing.T) {
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, util.TestResultPath, nil)
@@ -993,6 +1178,82 @@ func TestPutExperimentResult(t *testing.T) {
 	assert.Equal(t, &experimentResult, result)
 }
 
+func TestGetExperimentResult(t *testing.T) {
+	// instantiate metrics client
+	tempDirPath := t.TempDir()
+	client, err := badgerdb.GetClient(badger.DefaultOptions(tempDirPath), badgerdb.AdditionalOptions{})
+	assert.NoError(t, err)
+	storageclient.MetricsClient = client
+
+	u, err := url.ParseRequestURI(util.TestResultPath)
+	assert.NoError(t, err)
+	params := url.Values{
+		"namespace": {"default"},
+		"test":      {"default"},
+	}
+	u.RawQuery = params.Encode()
+	urlStr := fmt.Sprintf("%v", u)
+
+	// no result stored yet
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, urlStr, nil)
+	handleExperimentResult(w, req)
+	res := w.Result()
+	defer func() {
+		err := res.Body.Close()
+		assert.NoError(t, err)
+	}()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	experimentResult := util.ExperimentResult{
+		Name:              myName,
+		Namespace:         myNamespace,
+		NumCompletedTasks: 5,
+	}
+	err = client.SetExperimentResult("default", "default", &experimentResult)
+	assert.NoError(t, err)
+
+	// result is returned
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, urlStr, nil)
+	handleExperimentResult(w, req)
+	res2 := w.Result()
+	defer func() {
+		err := res2.Body.Close()
+		assert.NoError(t, err)
+	}()
+	assert.Equal(t, http.StatusOK, res2.StatusCode)
+
+	body, err := io.ReadAll(res2.Body)
+	assert.NoError(t, err)
+	result := util.ExperimentResult{}
+	err = json.Unmarshal(body, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, experimentResult, result)
+
+	// other failures are not reported as a missing result
+	storageclient.MetricsClient = failingResultClient{client}
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, urlStr, nil)
+	handleExperimentResult(w, req)
+	res3 := w.Result()
+	defer func() {
+		err := res3.Body.Close()
+		assert.NoError(t, err)
+	}()
+	assert.Equal(t, http.StatusInternalServerError, res3.StatusCode)
+}
+
+// failingResultClient is a storage client that cannot read experiment results
+type failingResultClient struct {
+	storage.Interface
+}
+
+// GetExperimentResult fails
+func (cl failingResultClient) GetExperimentResult(_, _ string) (*util.ExperimentResult, error) {
+	return nil, errors.New("storage is unavailable")
+}
+
 func TestGetHTTPDashboardInvalidMethod(t *testing.T) {
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, util.HTTPDashboardPath, nil)
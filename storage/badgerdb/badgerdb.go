@@ -305,6 +305,9 @@ func (cl Client) GetExperimentResult(namespace, experiment string) (*base.Experi
 		var valCopy []byte
 		err := cl.db.View(func(txn *badger.Txn) error {
 			item, err := txn.Get([]byte(storage.GetExperimentResultKey(namespace, experiment)))
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return fmt.Errorf("no ExperimentResult with name: \"%s\" and namespace: %s: %w", experiment, namespace, storage.ErrNotFound)
+			}
 			if err != nil {
 				return fmt.Errorf("cannot get ExperimentResult with name: \"%s\" and namespace: %s: %e", experiment, namespace, err)
 			}
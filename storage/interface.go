@@ -1,7 +1,14 @@
 // Package storage provides the storage client for the controllers package
 package storage
 
-import "github.com/iter8-tools/iter8/base"
+import (
+	"errors"
+
+	"github.com/iter8-tools/iter8/base"
+)
+
+// ErrNotFound is returned when a requested object is not in the store
+var ErrNotFound = errors.New("not found")
 
 // SummarizedMetric is a metric summary
 type SummarizedMetric struct {
@@ -70,6 +77,7 @@ type Interface interface {
 	SetUser(applicationName string, version int, signature, user string) error
 
 	// GetExperimentResult returns the experiment result for a particular namespace and experiment
+	// The error wraps ErrNotFound if there is no such result
 	GetExperimentResult(namespace, experiment string) (*base.ExperimentResult, error)
 
 	// SetExperimentResult records an expeirment result
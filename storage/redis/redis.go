@@ -4,6 +4,7 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -163,7 +164,11 @@ func (cl Client) SetExperimentResult(namespace, experiment string, data *base.Ex
 // GetExperimentResult returns an experiment result. See storage.Interface
 func (cl Client) GetExperimentResult(namespace, experiment string) (*base.ExperimentResult, error) {
 	return storage.GetExperimentResult(func() ([]byte, error) {
-		return cl.rdb.Get(context.Background(), storage.GetExperimentResultKey(namespace, experiment)).Bytes()
+		b, err := cl.rdb.Get(context.Background(), storage.GetExperimentResultKey(namespace, experiment)).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("no ExperimentResult with name: \"%s\" and namespace: %s: %w", experiment, namespace, storage.ErrNotFound)
+		}
+		return b, err
 	})
 }
 
@@ -168,6 +168,10 @@ func TestGetExperimentResult(t *testing.T) {
 	namespace := "my-namespace"
 	experiment := "my-experiment"
 
+	// no result stored yet
+	_, err = client.GetExperimentResult(namespace, experiment)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
 	experimentResult := base.ExperimentResult{
 		Name:      experiment,
 		Namespace: namespace,